@@ -0,0 +1,31 @@
+// mock-oidc serves a mock OpenID provider for trying the OIDC login locally:
+//
+//	go run ./cmd/mock-oidc
+//	OIDC_ISSUER=http://localhost:9090 OIDC_CLIENT_ID=social-network OIDC_CLIENT_SECRET=secret go run .
+//
+// Every sign-in succeeds as -email, or as the login_hint of the request.
+package main
+
+import (
+	"SOCIAL-NETWORK/pkg/oidc/oidctest"
+	"flag"
+	"log"
+	"net/http"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:9090", "address to listen on")
+	clientID := flag.String("client-id", "social-network", "client ID the backend uses")
+	clientSecret := flag.String("client-secret", "secret", "client secret the backend uses, empty for a public client")
+	email := flag.String("email", "mock.user@example.com", "email of the user that signs in")
+	flag.Parse()
+
+	server, err := oidctest.New("http://"+*addr, *clientID, *clientSecret)
+	if err != nil {
+		log.Fatal(err)
+	}
+	server.User.Email = *email
+
+	log.Printf("Mock OpenID provider at %s", server.Issuer)
+	log.Fatal(http.ListenAndServe(*addr, server))
+}
@@ -0,0 +1,271 @@
+package backend
+
+import (
+	tools "SOCIAL-NETWORK/pkg"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// TokenScope is what a personal access token may be used for. A route lists
+// the scopes that may call it when registered with handle.
+type TokenScope string
+
+const (
+	// ScopeRead covers the routes that only read: feeds, profiles, messages, groups
+	ScopeRead TokenScope = "read"
+	// ScopePosts covers writing posts and comments and liking them
+	ScopePosts TokenScope = "posts"
+	// ScopeMessages covers sending and managing private messages
+	ScopeMessages TokenScope = "messages"
+	// ScopeGroups covers creating and running groups, their posts, events and chat
+	ScopeGroups TokenScope = "groups"
+)
+
+var tokenScopes = []TokenScope{ScopeRead, ScopePosts, ScopeMessages, ScopeGroups}
+
+const (
+	accessTokenPrefix     = "snt_"
+	maxAccessTokens       = 25
+	maxAccessTokenDays    = 365
+	defaultAccessTokenTTL = 30
+	// last_used_at is written at most this often per token
+	accessTokenTouchInterval = time.Minute
+)
+
+var (
+	errInvalidAccessToken = errors.New("Invalid or expired token")
+	errAccessTokenScope   = errors.New("This token is not allowed to make this request")
+)
+
+type AccessToken struct {
+	ID         int          `json:"id"`
+	Name       string       `json:"name"`
+	Scopes     []TokenScope `json:"scopes"`
+	Hint       string       `json:"hint"`
+	CreatedAt  time.Time    `json:"createdAt"`
+	ExpiresAt  time.Time    `json:"expiresAt"`
+	LastUsedAt *time.Time   `json:"lastUsedAt"`
+}
+
+type NewAccessToken struct {
+	Name          string       `json:"name"`
+	Scopes        []TokenScope `json:"scopes"`
+	ExpiresInDays int          `json:"expiresInDays"`
+}
+
+// BearerToken returns the token of an "Authorization: Bearer" header
+func BearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// CheckAccessToken returns the user of a live token that has one of the
+// allowed scopes
+func (S *Server) CheckAccessToken(token string, allowed []TokenScope) (int, error) {
+	var id, userID int
+	var scopes string
+	var lastUsed sql.NullTime
+	now := time.Now()
+	err := S.db.QueryRow(`
+		SELECT id, user_id, scopes, last_used_at FROM api_tokens
+		WHERE token_hash = ? AND expires_at > ?`,
+		HashToken(token), S.db.Timestamp(now)).Scan(&id, &userID, &scopes, &lastUsed)
+	if err == sql.ErrNoRows {
+		return 0, errInvalidAccessToken
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	granted := parseTokenScopes(scopes)
+	if !slices.ContainsFunc(allowed, func(s TokenScope) bool { return slices.Contains(granted, s) }) {
+		return 0, errAccessTokenScope
+	}
+
+	if !lastUsed.Valid || now.Sub(lastUsed.Time) > accessTokenTouchInterval {
+		if _, err := S.db.Exec(`UPDATE api_tokens SET last_used_at = ? WHERE id = ?`, S.db.Timestamp(now), id); err != nil {
+			return 0, err
+		}
+	}
+	return userID, nil
+}
+
+func parseTokenScopes(s string) []TokenScope {
+	var scopes []TokenScope
+	for _, scope := range strings.Split(s, ",") {
+		if scope != "" {
+			scopes = append(scopes, TokenScope(scope))
+		}
+	}
+	return scopes
+}
+
+func joinTokenScopes(scopes []TokenScope) string {
+	parts := make([]string, len(scopes))
+	for i, s := range scopes {
+		parts[i] = string(s)
+	}
+	return strings.Join(parts, ",")
+}
+
+// GetAccessTokens lists the live tokens of userID, newest first
+func (S *Server) GetAccessTokens(userID int) ([]AccessToken, error) {
+	rows, err := S.db.Query(`
+		SELECT id, name, scopes, token_hint, created_at, expires_at, last_used_at
+		FROM api_tokens
+		WHERE user_id = ? AND expires_at > ?
+		ORDER BY created_at DESC, id DESC`, userID, S.db.Timestamp(time.Now()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []AccessToken{}
+	for rows.Next() {
+		var t AccessToken
+		var scopes string
+		var createdAt, lastUsedAt sql.NullTime
+		if err := rows.Scan(&t.ID, &t.Name, &scopes, &t.Hint, &createdAt, &t.ExpiresAt, &lastUsedAt); err != nil {
+			return nil, err
+		}
+		t.Scopes = parseTokenScopes(scopes)
+		t.CreatedAt = createdAt.Time
+		if lastUsedAt.Valid {
+			t.LastUsedAt = &lastUsedAt.Time
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// AccessTokensHandler lists the caller's tokens on GET and creates one on
+// POST. The token itself is only in the answer to the POST.
+func (S *Server) AccessTokensHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := CurrentUser(r)
+
+	switch r.Method {
+	case http.MethodGet:
+		tokens, err := S.GetAccessTokens(userID)
+		if err != nil {
+			http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tokens)
+	case http.MethodPost:
+		S.createAccessToken(w, r, userID)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (S *Server) createAccessToken(w http.ResponseWriter, r *http.Request, userID int) {
+	var req NewAccessToken
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		tools.SendJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || utf8.RuneCountInString(req.Name) > 50 {
+		tools.SendJSONError(w, "Name must be 1 to 50 characters", http.StatusBadRequest)
+		return
+	}
+	if len(req.Scopes) == 0 {
+		tools.SendJSONError(w, "Choose at least one scope", http.StatusBadRequest)
+		return
+	}
+	var scopes []TokenScope
+	for _, s := range req.Scopes {
+		if !slices.Contains(tokenScopes, s) {
+			tools.SendJSONError(w, "Unknown scope "+string(s), http.StatusBadRequest)
+			return
+		}
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	if req.ExpiresInDays == 0 {
+		req.ExpiresInDays = defaultAccessTokenTTL
+	}
+	if req.ExpiresInDays < 1 || req.ExpiresInDays > maxAccessTokenDays {
+		tools.SendJSONError(w, "Tokens expire after 1 to "+strconv.Itoa(maxAccessTokenDays)+" days", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	var count int
+	if err := S.db.QueryRow(`SELECT COUNT(*) FROM api_tokens WHERE user_id = ? AND expires_at > ?`,
+		userID, S.db.Timestamp(now)).Scan(&count); err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if count >= maxAccessTokens {
+		tools.SendJSONError(w, "You have too many tokens, revoke one first", http.StatusConflict)
+		return
+	}
+
+	secret, _, err := NewSecretToken()
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	token := accessTokenPrefix + secret
+	created := AccessToken{
+		Name:      req.Name,
+		Scopes:    scopes,
+		Hint:      token[len(token)-4:],
+		CreatedAt: now,
+		ExpiresAt: now.AddDate(0, 0, req.ExpiresInDays),
+	}
+	err = S.db.QueryRow(`
+		INSERT INTO api_tokens (user_id, name, token_hash, token_hint, scopes, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		userID, created.Name, HashToken(token), created.Hint, joinTokenScopes(scopes),
+		S.db.Timestamp(created.ExpiresAt), S.db.Timestamp(now)).Scan(&created.ID)
+	if err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":       token,
+		"accessToken": created,
+	})
+}
+
+// RevokeAccessTokenHandler deletes one of the caller's tokens,
+// DELETE /api/tokens/{id}
+func (S *Server) RevokeAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, _ := CurrentUser(r)
+	id := tools.StringToInt(strings.TrimPrefix(r.URL.Path, "/api/tokens/"))
+
+	res, err := S.db.Exec(`DELETE FROM api_tokens WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tools.SendJSONError(w, "Token not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"revoked": 1})
+}
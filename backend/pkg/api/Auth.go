@@ -2,8 +2,10 @@ package backend
 
 import (
 	tools "SOCIAL-NETWORK/pkg"
+	"database/sql"
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"time"
 
@@ -15,8 +17,8 @@ func (S *Server) LoggedHandler(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/404", http.StatusSeeOther)
 		return
 	}
-	id, _, err := S.CheckSession(r)
-	if err != nil {
+	id, _ := CurrentUser(r)
+	if id == 0 {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"user":     nil,
@@ -38,27 +40,27 @@ func (S *Server) LoggedHandler(w http.ResponseWriter, r *http.Request) {
 		"loggedIn": true,
 	})
 }
-func (S *Server) MakeToken(Writer http.ResponseWriter, id int) {
+
+// MakeToken starts a session for user id on the device that sent r. A
+// remember-me session gets the longer timeouts and a persistent cookie.
+func (S *Server) MakeToken(Writer http.ResponseWriter, r *http.Request, id int, remember bool) {
 	sessionID := uuid.NewV4().String()
-	expirationTime := time.Now().Add(24 * time.Hour)
+	now := time.Now()
+	idle, absolute := S.sessionConfig.Timeouts(remember)
+	absoluteExpiry := now.Add(absolute)
+	expirationTime := minTime(now.Add(idle), absoluteExpiry)
 
-	_, err := S.db.Exec("INSERT INTO sessions (session_id, user_id, expires_at) VALUES (?, ?, ?)",
-		sessionID, id, expirationTime)
+	_, err := S.db.Exec(`INSERT INTO sessions (session_id, user_id, expires_at, absolute_expires_at, remember, user_agent, ip, created_at, last_seen_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		sessionID, id, S.db.Timestamp(expirationTime), S.db.Timestamp(absoluteExpiry), remember,
+		r.UserAgent(), ClientIP(r), S.db.Timestamp(now), S.db.Timestamp(now))
 	if err != nil {
 		fmt.Println("Error creating session:", err)
 		http.Error(Writer, "Error creating session", http.StatusInternalServerError)
 		return
 	}
 
-	http.SetCookie(Writer, &http.Cookie{
-		Name:     "session_token",
-		Value:    sessionID,
-		Expires:  expirationTime,
-		HttpOnly: true,
-		Path:     "/",
-		SameSite: http.SameSiteLaxMode,
-		Secure:   false,
-	})
+	S.setSessionCookie(Writer, sessionID, remember, absoluteExpiry)
 }
 func (S *Server) CheckSession(r *http.Request) (int, string, error) {
 
@@ -68,13 +70,21 @@ func (S *Server) CheckSession(r *http.Request) (int, string, error) {
 	}
 	sessionID := cookie.Value
 	var userID int
+	var remember bool
+	var lastSeen, absoluteExpiry sql.NullTime
 	err = S.db.QueryRow(`
-        SELECT user_id FROM sessions 
-        WHERE session_id = ? AND expires_at > CURRENT_TIMESTAMP
-    `, sessionID).Scan(&userID)
+        SELECT user_id, last_seen_at, remember, absolute_expires_at FROM sessions 
+        WHERE session_id = ? AND expires_at > ?
+    `, sessionID, S.db.Timestamp(time.Now())).Scan(&userID, &lastSeen, &remember, &absoluteExpiry)
 
 	if err != nil {
 		return 0, "", fmt.Errorf("invalid or expired session")
 	}
+	// using the session pushes its idle expiry forward
+	if !lastSeen.Valid || time.Since(lastSeen.Time) > S.sessionConfig.TouchInterval(remember) {
+		if err := S.TouchSession(sessionID, r, remember, absoluteExpiry); err != nil {
+			log.Printf("Error updating session: %v", err)
+		}
+	}
 	return userID, sessionID, nil
-}
\ No newline at end of file
+}
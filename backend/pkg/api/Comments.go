@@ -3,10 +3,13 @@ package backend
 import (
 	tools "SOCIAL-NETWORK/pkg"
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func (S *Server) CreateCommentHandler(w http.ResponseWriter, r *http.Request) {
@@ -15,11 +18,7 @@ func (S *Server) CreateCommentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	currentUserID, _, err := S.CheckSession(r)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
+	currentUserID, _ := CurrentUser(r)
 
 	var body struct {
 		Content         string  `json:"content"`
@@ -27,46 +26,192 @@ func (S *Server) CreateCommentHandler(w http.ResponseWriter, r *http.Request) {
 		PostID          int     `json:"postId"`
 	}
 
-	err = json.NewDecoder(r.Body).Decode(&body)
+	err := json.NewDecoder(r.Body).Decode(&body)
 	if err != nil {
 		fmt.Println("decode error : ", err)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
+	if strings.TrimSpace(body.Content) == "" {
+		tools.SendJSONError(w, "Comment cannot be empty", http.StatusBadRequest)
+		return
+	}
 
-	commentID, err := S.CreateComment(currentUserID, body.Content, body.PostID, body.ParentCommentId)
+	// same rules as GetPostFromID, group posts included
+	canSee, err := S.CanSeePost(currentUserID, body.PostID)
 	if err != nil {
 		http.Error(w, "Failed to create comment", http.StatusInternalServerError)
 		return
 	}
+	if !canSee {
+		tools.SendJSONError(w, "Post not found", http.StatusNotFound)
+		return
+	}
 
-	fmt.Println(commentID)
+	postAuthorID, err := S.GetUserIdFromPostID(body.PostID)
+	if err != nil {
+		http.Error(w, "Failed to create comment", http.StatusInternalServerError)
+		return
+	}
+
+	var parent CommentTarget
+	var parentID int
+	if body.ParentCommentId != nil {
+		parentID, err = strconv.Atoi(*body.ParentCommentId)
+		if err != nil {
+			tools.SendJSONError(w, "Invalid parent comment", http.StatusBadRequest)
+			return
+		}
+		parent, err = S.GetCommentTarget(parentID)
+		if err == sql.ErrNoRows || (err == nil && (parent.PostID != body.PostID ||
+			(parent.IsHidden && parent.AuthorID != currentUserID && postAuthorID != currentUserID))) {
+			tools.SendJSONError(w, "Parent comment not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to create comment", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	commentID, err := S.CreateComment(currentUserID, body.Content, body.PostID, body.ParentCommentId)
+	if err != nil {
+		http.Error(w, "Failed to create comment", http.StatusInternalServerError)
+		return
+	}
 
 	comment, err := S.GetCommentByID(commentID, r)
 	if err != nil {
 		http.Error(w, "Failed to get comment", http.StatusInternalServerError)
 		return
 	}
+
+	S.NotifyComment(currentUserID, body.PostID, postAuthorID, parentID, parent)
+	S.PushPostViewers(body.PostID, commentID, "comment-created", map[string]interface{}{
+		"postId":  body.PostID,
+		"comment": comment,
+	})
+
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(comment)
 }
 
+// NotifyComment tells the post author about a new comment and, for a reply
+// (parentID != 0), the author of the parent comment. Someone who is both only
+// gets the reply.
+func (S *Server) NotifyComment(actorID, postID, postAuthorID, parentID int, parent CommentTarget) {
+	send := func(receiverID int, notifType, content string, commentID int) {
+		if receiverID == actorID {
+			return
+		}
+		notification := Notification{ID: receiverID, ActorID: actorID, Type: notifType, Content: content, IsRead: false,
+			PostID: postID, CommentID: commentID}
+		if err := S.IsertNotification(notification); err != nil {
+			fmt.Println("Error inserting notification:", err)
+			return
+		}
+		S.PushNotification("-new", receiverID, notification)
+	}
+
+	if parentID != 0 {
+		send(parent.AuthorID, "reply", "Replied To Your Comment", parentID)
+		if parent.AuthorID == postAuthorID {
+			return
+		}
+	}
+	send(postAuthorID, "comment", "Commented On Your Post", 0)
+}
+
+// GetCommentsHandler returns one page of comments of /api/get-comments/{postID}
+// with their replies nested up to ?depth= levels (default 3).
+// ?sort= is oldest (default), newest or top (most liked), ?cursor= and ?limit= page
+// through the top-level comments. With ?parent={commentID} it pages through the
+// replies of that comment instead ("load more replies"), always oldest first.
 func (S *Server) GetCommentsHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
+	if r.Method != http.MethodPost && r.Method != http.MethodGet {
 		http.Redirect(w, r, "/404", http.StatusSeeOther)
 		return
 	}
 
-	postID := strings.TrimPrefix(r.URL.Path, "/api/get-comments/")
+	currentUserID, _ := CurrentUser(r)
+	postID := tools.StringToInt(strings.TrimPrefix(r.URL.Path, "/api/get-comments/"))
+	query := r.URL.Query()
 
-	comments, err := S.GetComments(tools.StringToInt(postID), r)
+	canSee, err := S.CanSeePost(currentUserID, postID)
 	if err != nil {
 		http.Error(w, "Failed to get comments", http.StatusInternalServerError)
 		return
 	}
+	if !canSee {
+		tools.SendJSONError(w, "Post not found", http.StatusNotFound)
+		return
+	}
 
+	page := CommentPage{PostID: postID, Sort: query.Get("sort"), Limit: defaultCommentPageSize, Depth: defaultCommentDepth}
+	if page.Sort == "" {
+		page.Sort = "oldest"
+	}
+	if _, ok := commentSorts[page.Sort]; !ok {
+		tools.SendJSONError(w, "Invalid sort", http.StatusBadRequest)
+		return
+	}
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			tools.SendJSONError(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		page.Limit = min(n, maxCommentPageSize)
+	}
+	if v := query.Get("depth"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			tools.SendJSONError(w, "Invalid depth", http.StatusBadRequest)
+			return
+		}
+		page.Depth = min(n, maxCommentDepth)
+	}
+	if v := query.Get("parent"); v != "" {
+		parentID, err := strconv.Atoi(v)
+		if err != nil {
+			tools.SendJSONError(w, "Invalid parent", http.StatusBadRequest)
+			return
+		}
+		// the replies of a comment the caller can't see stay out of reach too
+		parent, canSee, err := S.CanSeeComment(currentUserID, parentID)
+		if err != nil {
+			http.Error(w, "Failed to get comments", http.StatusInternalServerError)
+			return
+		}
+		if !canSee || parent.PostID != postID {
+			tools.SendJSONError(w, "Parent comment not found", http.StatusNotFound)
+			return
+		}
+		page.ParentID = sql.NullInt64{Int64: int64(parentID), Valid: true}
+		page.Sort = "oldest"
+	}
+	if v := query.Get("cursor"); v != "" {
+		c, err := DecodeCommentCursor(v, page.Sort)
+		if err != nil {
+			tools.SendJSONError(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		page.Cursor = &c
+	}
+
+	comments, next, err := S.GetComments(r, page)
+	if err != nil {
+		fmt.Println("GetComments error:", err)
+		http.Error(w, "Failed to get comments", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(comments)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"comments":   comments,
+		"nextCursor": next,
+	})
 }
 
 func (S *Server) LikeCommentHandler(w http.ResponseWriter, r *http.Request) {
@@ -75,15 +220,21 @@ func (S *Server) LikeCommentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	currentUserID, _, err := S.CheckSession(r)
+	currentUserID, _ := CurrentUser(r)
+
+	commentID := tools.StringToInt(strings.TrimPrefix(r.URL.Path, "/api/like-comment/"))
+
+	_, canSee, err := S.CanSeeComment(currentUserID, commentID)
 	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	if !canSee {
+		tools.SendJSONError(w, "Comment not found", http.StatusNotFound)
 		return
 	}
 
-	commentID := strings.TrimPrefix(r.URL.Path, "/api/like-comment/")
-
-	liked, err := S.LikeComment(tools.StringToInt(commentID), currentUserID)
+	liked, err := S.LikeComment(commentID, currentUserID)
 	if err != nil {
 		fmt.Println("liked comment error db : ", err)
 		http.Error(w, "Failed to like comment", http.StatusInternalServerError)
@@ -95,121 +246,296 @@ func (S *Server) LikeCommentHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (S *Server) CreateComment(userID int, content string, postID int, parentCommentID *string) (int, error) {
-	sqlRes, err := S.db.Exec("INSERT INTO comments (user_id, content, post_id, parent_comment_id) VALUES (?, ?, ?, ?)", userID, content, postID, parentCommentID)
+	tx, err := S.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var commentID int
+	err = tx.QueryRow("INSERT INTO comments (user_id, content, post_id, parent_comment_id) VALUES (?, ?, ?, ?) RETURNING id", userID, content, postID, parentCommentID).Scan(&commentID)
 	if err != nil {
 		return 0, err
 	}
-	lastID, _ := sqlRes.LastInsertId()
-	return int(lastID), nil
+	var parentID sql.NullInt64
+	if parentCommentID != nil {
+		parentID = sql.NullInt64{Int64: int64(tools.StringToInt(*parentCommentID)), Valid: true}
+	}
+	if err := AdjustCommentCount(tx, postID, parentID, 1); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	if err := S.LinkCommentTags(commentID, userID, postID, content); err != nil {
+		fmt.Println("Error linking comment tags:", err)
+	}
+	return commentID, nil
+}
+
+const (
+	defaultCommentPageSize = 20
+	maxCommentPageSize     = 50
+	// replies shown under each comment before "load more replies"
+	commentRepliesPreview = 3
+	defaultCommentDepth   = 3
+	maxCommentDepth       = 10
+)
+
+// commentSorts maps a sort mode to its ORDER BY and the cursor condition for
+// the rows after (key, id)
+var commentSorts = map[string]struct{ order, after string }{
+	"oldest": {`c.created_at ASC, c.id ASC`, `(c.created_at > ? OR (c.created_at = ? AND c.id > ?))`},
+	"newest": {`c.created_at DESC, c.id DESC`, `(c.created_at < ? OR (c.created_at = ? AND c.id < ?))`},
+	"top":    {`c.likes DESC, c.id DESC`, `(c.likes < ? OR (c.likes = ? AND c.id < ?))`},
+}
+
+// CommentPage selects the direct children of ParentID (top-level comments when
+// not valid) on a post. Depth is how many levels of replies to nest below them.
+type CommentPage struct {
+	PostID   int
+	ParentID sql.NullInt64
+	Sort     string
+	Cursor   *CommentCursor
+	Limit    int
+	Depth    int
 }
 
-func (S *Server) GetComments(postID int, r *http.Request) ([]Comment, error) {
-	currentUserID, _, _ := S.CheckSession(r)
+// CommentCursor points at the last comment of a page. Key is its created_at,
+// or its like count for the "top" sort.
+type CommentCursor struct {
+	Key string
+	ID  int
+
+	createdAt time.Time
+	likes     int
+}
 
+func (c CommentCursor) Encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.Key + "|" + strconv.Itoa(c.ID)))
+}
+
+// DecodeCommentCursor parses a cursor made for the given sort
+func DecodeCommentCursor(s, sort string) (CommentCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return CommentCursor{}, err
+	}
+	key, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return CommentCursor{}, fmt.Errorf("malformed cursor")
+	}
+	c := CommentCursor{Key: key}
+	if c.ID, err = strconv.Atoi(id); err != nil {
+		return CommentCursor{}, err
+	}
+	if sort == "top" {
+		c.likes, err = strconv.Atoi(key)
+	} else {
+		c.createdAt, err = time.Parse(time.RFC3339Nano, key)
+	}
+	return c, err
+}
+
+// GetComments returns one page of comments with their replies nested page.Depth
+// levels deep, and the cursor of the next page (empty on the last one).
+// Every nested comment carries a preview of its first replies and the cursor
+// to load the rest; below page.Depth only repliesCount is filled.
+// The page and its replies are read with one recursive query that follows at
+// most commentRepliesPreview+1 replies per comment, the extra one telling
+// whether there are more.
+func (S *Server) GetComments(r *http.Request, page CommentPage) ([]Comment, string, error) {
+	currentUserID, _ := CurrentUser(r)
+	sort := commentSorts[page.Sort]
+
+	where := `c.post_id = ? AND ` + visibleCommentSQL("c")
+	args := []any{page.PostID, currentUserID, currentUserID}
+	if page.ParentID.Valid {
+		where += ` AND c.parent_comment_id = ?`
+		args = append(args, page.ParentID.Int64)
+	} else {
+		where += ` AND c.parent_comment_id IS NULL`
+	}
+	if page.Cursor != nil {
+		var key any = S.db.Timestamp(page.Cursor.createdAt)
+		if page.Sort == "top" {
+			key = page.Cursor.likes
+		}
+		where += ` AND ` + sort.after
+		args = append(args, key, key, page.Cursor.ID)
+	}
+	args = append(args, page.Limit+1,
+		currentUserID, currentUserID, commentRepliesPreview+1, page.Depth, page.Limit,
+		currentUserID)
+
+	// pos keeps the page in its sort order, replies are always oldest first
 	rows, err := S.db.Query(`
-		SELECT 
-			c.id, c.content, c.created_at, c.parent_comment_id,c.likes as like_count,
-			u.first_name || ' ' || u.last_name AS name, 
+		WITH RECURSIVE page AS (
+			SELECT c.id, ROW_NUMBER() OVER (ORDER BY `+sort.order+`) AS pos
+			FROM comments c
+			WHERE `+where+`
+			ORDER BY `+sort.order+`
+			LIMIT ?
+		), tree (id, depth, pos) AS (
+			SELECT id, 0, CAST(pos AS INTEGER) FROM page
+			UNION ALL
+			SELECT c.id, t.depth + 1, 0
+			FROM tree t
+			JOIN comments c ON c.id IN (
+				SELECT r.id FROM comments r
+				WHERE r.parent_comment_id = t.id AND `+visibleCommentSQL("r")+`
+				ORDER BY r.created_at, r.id
+				LIMIT ?)
+			WHERE t.depth < ? AND t.pos <= ?
+		)
+		SELECT
+			c.id, c.content, c.created_at, c.parent_comment_id, c.likes AS like_count,
+			c.replies, c.is_hidden,
+			u.id, u.first_name || ' ' || u.last_name AS name,
 			u.nickname, u.avatar,
-			EXISTS(SELECT 1 FROM likes l WHERE l.comment_id = c.id AND l.user_id = ?) as is_liked
-		FROM comments c
+			EXISTS(SELECT 1 FROM likes l WHERE l.comment_id = c.id AND l.user_id = ?) AS is_liked,
+			EXISTS(SELECT 1 FROM comment_revisions cr WHERE cr.comment_id = c.id) AS is_edited,
+			t.depth
+		FROM tree t
+		JOIN comments c ON c.id = t.id
 		JOIN users u ON c.user_id = u.id
-		WHERE c.post_id = ?
-		ORDER BY c.created_at ASC
-	`, currentUserID, postID)
+		ORDER BY t.depth, t.pos, c.created_at, c.id`, args...)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
-	defer rows.Close()
-
-	commentsMap := make(map[int][]Comment)
-	var allComments []Comment
-
+	comments := []Comment{}
+	replies := make(map[int][]Comment)
 	for rows.Next() {
-		var comment Comment
-		var parentCommentID sql.NullInt64
-		var authorName, authorUsername, authorAvatar sql.NullString
-
-		if err := rows.Scan(
-			&comment.ID,
-			&comment.Content,
-			&comment.CreatedAt,
-			&parentCommentID,
-			&comment.Likes,
-			&authorName,
-			&authorUsername,
-			&authorAvatar,
-			&comment.IsLiked,
-		); err != nil {
-			return nil, err
-		}
-
-		// handle nullable parent_id
-		if parentCommentID.Valid {
-			id := int(parentCommentID.Int64)
-			comment.ParentCommentID = id
+		var depth int
+		comment, err := scanComment(rows, &depth)
+		if err != nil {
+			rows.Close()
+			return nil, "", err
 		}
-
-		// author
-		comment.Author.Name = authorName.String
-		comment.Author.Username = authorUsername.String
-		comment.Author.Avatar = authorAvatar.String
-
-		comment.Replies = []Comment{}
-
-		if comment.ParentCommentID != 0 {
-			commentsMap[comment.ParentCommentID] = append(commentsMap[comment.ParentCommentID], comment)
+		if depth == 0 {
+			comments = append(comments, comment)
 		} else {
-			allComments = append(allComments, comment)
+			replies[comment.ParentCommentID] = append(replies[comment.ParentCommentID], comment)
 		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
 
+	next := ""
+	if len(comments) > page.Limit {
+		comments = comments[:page.Limit]
+		last := comments[len(comments)-1]
+		key := last.CreatedAt
+		if page.Sort == "top" {
+			key = strconv.Itoa(last.Likes)
+		}
+		next = CommentCursor{Key: key, ID: tools.StringToInt(last.ID)}.Encode()
+	}
+	for i := range comments {
+		nestReplies(&comments[i], replies)
 	}
 
-	var rootComments []Comment
-	for _, parent := range allComments {
-		if commentsMap[tools.StringToInt(parent.ID)] != nil {
-			parent.Replies = append(parent.Replies, commentsMap[tools.StringToInt(parent.ID)]...)
+	return comments, next, nil
+}
 
-		}
-		rootComments = append(rootComments, parent)
+// nestReplies moves the replies of comment out of replies and into it, keeping
+// commentRepliesPreview of them and the cursor to the rest
+func nestReplies(comment *Comment, replies map[int][]Comment) {
+	children := replies[tools.StringToInt(comment.ID)]
+	if len(children) == 0 {
+		return
+	}
+	if len(children) > commentRepliesPreview {
+		children = children[:commentRepliesPreview]
+		last := children[len(children)-1]
+		comment.NextRepliesCursor = CommentCursor{Key: last.CreatedAt, ID: tools.StringToInt(last.ID)}.Encode()
 	}
-	return rootComments, nil
+	for i := range children {
+		nestReplies(&children[i], replies)
+	}
+	comment.Replies = children
 }
 
+// visibleCommentSQL keeps the comments (under alias) the viewer may read:
+// hidden ones only show to their author and the post's author. repliesCount
+// leaves those out, so it can't be used to skip looking for replies. It takes
+// the viewer id twice.
+func visibleCommentSQL(alias string) string {
+	return visibleCommentSQLFor(alias, "?")
+}
+
+// visibleCommentSQLFor is visibleCommentSQL for the viewer id in the SQL
+// expression viewer
+func visibleCommentSQLFor(alias, viewer string) string {
+	return fmt.Sprintf(`(%[1]s.is_hidden = FALSE OR %[1]s.user_id = %[2]s OR EXISTS(
+		SELECT 1 FROM posts p WHERE p.id = %[1]s.post_id AND p.user_id = %[2]s))`, alias, viewer)
+}
+
+// commentAncestorsSQL is a recursive CTE of the comment given as its
+// parameter and every comment above it. The read path stops at a hidden
+// comment, so a comment is only visible when all of them are.
+const commentAncestorsSQL = `
+	WITH RECURSIVE ancestors(id, parent_comment_id, user_id, post_id, is_hidden) AS (
+		SELECT id, parent_comment_id, user_id, post_id, is_hidden FROM comments WHERE id = ?
+		UNION ALL
+		SELECT c.id, c.parent_comment_id, c.user_id, c.post_id, c.is_hidden
+		FROM comments c JOIN ancestors a ON c.id = a.parent_comment_id
+	)`
+
 func (S *Server) GetCommentByID(commentID int, r *http.Request) (Comment, error) {
-	currentUserID, _, _ := S.CheckSession(r)
+	currentUserID, _ := CurrentUser(r)
 
 	row := S.db.QueryRow(`
 		SELECT 
 			c.id, c.content, c.created_at, c.parent_comment_id,c.likes as like_count,
-			u.first_name || ' ' || u.last_name AS name, 
+			c.replies, c.is_hidden,
+			u.id, u.first_name || ' ' || u.last_name AS name, 
 			u.nickname, u.avatar,
-			EXISTS(SELECT 1 FROM likes l WHERE l.comment_id = c.id AND l.user_id = ?) as is_liked
+			EXISTS(SELECT 1 FROM likes l WHERE l.comment_id = c.id AND l.user_id = ?) as is_liked,
+			EXISTS(SELECT 1 FROM comment_revisions cr WHERE cr.comment_id = c.id) as is_edited
 		FROM comments c
 		JOIN users u ON c.user_id = u.id
 		WHERE c.id = ?
 	`, currentUserID, commentID)
 
+	comment, err := scanComment(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Comment{}, nil // comment not found
+		}
+		fmt.Println("get one comment error : ", err)
+		return Comment{}, err
+	}
+
+	return comment, nil
+}
+
+// scanComment reads one row of the comment SELECT used by GetComments and
+// GetCommentByID, and any columns after it into extra
+func scanComment(row interface{ Scan(...any) error }, extra ...any) (Comment, error) {
 	var comment Comment
 	var parentCommentID sql.NullInt64
 	var authorName, authorUsername, authorAvatar sql.NullString
 
-	err := row.Scan(
+	err := row.Scan(append([]any{
 		&comment.ID,
 		&comment.Content,
 		&comment.CreatedAt,
 		&parentCommentID,
 		&comment.Likes,
+		&comment.RepliesCount,
+		&comment.IsHidden,
+		&comment.Author.ID,
 		&authorName,
 		&authorUsername,
 		&authorAvatar,
 		&comment.IsLiked,
-	)
+		&comment.IsEdited,
+	}, extra...)...)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return Comment{}, nil // comment not found
-		}
-		fmt.Println("get one comment error : ", err)
 		return Comment{}, err
 	}
 
@@ -239,10 +565,13 @@ func (S *Server) LikeComment(commentID int, userID int) (bool, error) {
 		return false, err
 	}
 
-	AuthorID, err := S.GetCommentAuthorID(commentID)
+	target, err := S.GetCommentTarget(commentID)
 	if err != nil {
 		return false, err
 	}
+	AuthorID := target.AuthorID
+	notification := Notification{ID: AuthorID, ActorID: userID, Type: "like", Content: "Like Your Comment", IsRead: false,
+		PostID: target.PostID, CommentID: commentID}
 
 	if exists {
 		_, err = S.db.Exec("DELETE FROM likes WHERE user_id=? AND comment_id=?", userID, commentID)
@@ -253,7 +582,7 @@ func (S *Server) LikeComment(commentID int, userID int) (bool, error) {
 		if err != nil {
 			return false, err
 		}
-		S.DeleteNotification(tools.IntToString(userID), tools.IntToString(AuthorID), "like")
+		S.RemoveNotificationActor(notification)
 		S.PushNotification("-delete", AuthorID, Notification{})
 		return false, nil
 	} else {
@@ -266,8 +595,6 @@ func (S *Server) LikeComment(commentID int, userID int) (bool, error) {
 			return false, err
 		}
 		if AuthorID != userID {
-			notification := Notification{ID: AuthorID, ActorID: userID, Type: "like", Content: "Like Your Comment", IsRead: false}
-
 			S.IsertNotification(notification)
 			S.PushNotification("-new", AuthorID, notification)
 		}
@@ -284,3 +611,338 @@ func (S *Server) GetCommentAuthorID(commentID int) (int, error) {
 	}
 	return userID, nil
 }
+
+// EditCommentHandler lets the author change a comment, the previous text is
+// kept in comment_revisions.
+func (S *Server) EditCommentHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch && r.Method != http.MethodPut {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUserID, _ := CurrentUser(r)
+	commentID := tools.StringToInt(strings.TrimPrefix(r.URL.Path, "/api/edit-comment/"))
+
+	target, err := S.GetCommentTarget(commentID)
+	if err == sql.ErrNoRows {
+		tools.SendJSONError(w, "Comment not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	if target.AuthorID != currentUserID {
+		tools.SendJSONError(w, "You can only edit your own comments", http.StatusForbidden)
+		return
+	}
+
+	var body struct {
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(body.Content) == "" {
+		tools.SendJSONError(w, "Content cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	if body.Content != target.Content {
+		tx, err := S.db.Begin()
+		if err != nil {
+			http.Error(w, "DB Error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.Exec(`INSERT INTO comment_revisions (comment_id, content) VALUES (?, ?)`,
+			commentID, target.Content); err != nil {
+			http.Error(w, "DB Error", http.StatusInternalServerError)
+			return
+		}
+		if _, err := tx.Exec(`UPDATE comments SET content = ? WHERE id = ?`, body.Content, commentID); err != nil {
+			http.Error(w, "DB Error", http.StatusInternalServerError)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "DB Error", http.StatusInternalServerError)
+			return
+		}
+		if err := S.LinkCommentTags(commentID, currentUserID, target.PostID, body.Content); err != nil {
+			fmt.Println("Error linking comment tags:", err)
+		}
+	}
+
+	comment, err := S.GetCommentByID(commentID, r)
+	if err != nil {
+		http.Error(w, "Failed to get comment", http.StatusInternalServerError)
+		return
+	}
+
+	S.PushPostViewers(target.PostID, commentID, "comment-updated", map[string]interface{}{
+		"postId":  target.PostID,
+		"comment": comment,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comment)
+}
+
+// DeleteCommentHandler deletes a comment and its whole reply thread. Allowed
+// for the comment author and for the author of the post.
+func (S *Server) DeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUserID, _ := CurrentUser(r)
+	commentID := tools.StringToInt(strings.TrimPrefix(r.URL.Path, "/api/delete-comment/"))
+
+	target, err := S.GetCommentTarget(commentID)
+	if err == sql.ErrNoRows {
+		tools.SendJSONError(w, "Comment not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	if target.AuthorID != currentUserID && target.PostAuthorID != currentUserID {
+		tools.SendJSONError(w, "You can't delete this comment", http.StatusForbidden)
+		return
+	}
+
+	tx, err := S.db.Begin()
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	ids, err := GetCommentThreadIDs(tx, commentID)
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	in := Placeholders(len(ids))
+	for _, stmt := range []string{
+		`DELETE FROM notification_actors WHERE notification_id IN (SELECT id FROM notifications WHERE comment_id IN (` + in + `))`,
+		`DELETE FROM notifications WHERE comment_id IN (` + in + `)`,
+		`DELETE FROM likes WHERE comment_id IN (` + in + `)`,
+		`DELETE FROM comment_hashtags WHERE comment_id IN (` + in + `)`,
+		`DELETE FROM comment_mentions WHERE comment_id IN (` + in + `)`,
+		`DELETE FROM comment_revisions WHERE comment_id IN (` + in + `)`,
+		`DELETE FROM comments WHERE id IN (` + in + `)`,
+	} {
+		if _, err := tx.Exec(stmt, args...); err != nil {
+			fmt.Println("DeleteCommentHandler error:", err)
+			http.Error(w, "DB Error", http.StatusInternalServerError)
+			return
+		}
+	}
+	if !target.IsHidden {
+		if err := AdjustCommentCount(tx, target.PostID, target.ParentID, -1); err != nil {
+			http.Error(w, "DB Error", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+
+	S.PushPostViewers(target.PostID, 0, "comment-deleted", map[string]interface{}{
+		"postId":          target.PostID,
+		"commentId":       commentID,
+		"parentCommentId": target.ParentID.Int64,
+		"deletedIds":      ids,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "deletedIds": ids})
+}
+
+// HideCommentHandler toggles a comment on the current user's post between
+// hidden and shown. Hidden comments stay visible to their author and the post author.
+func (S *Server) HideCommentHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUserID, _ := CurrentUser(r)
+	commentID := tools.StringToInt(strings.TrimPrefix(r.URL.Path, "/api/hide-comment/"))
+
+	target, err := S.GetCommentTarget(commentID)
+	if err == sql.ErrNoRows {
+		tools.SendJSONError(w, "Comment not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	if target.PostAuthorID != currentUserID {
+		tools.SendJSONError(w, "Only the post author can hide comments", http.StatusForbidden)
+		return
+	}
+
+	hidden := !target.IsHidden
+	delta := 1
+	if hidden {
+		delta = -1
+	}
+
+	tx, err := S.db.Begin()
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE comments SET is_hidden = ? WHERE id = ?`, hidden, commentID); err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	if err := AdjustCommentCount(tx, target.PostID, target.ParentID, delta); err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+
+	if hidden {
+		S.PushPostViewers(target.PostID, 0, "comment-deleted", map[string]interface{}{
+			"postId":          target.PostID,
+			"commentId":       commentID,
+			"parentCommentId": target.ParentID.Int64,
+			"deletedIds":      []int{commentID},
+		})
+	} else if comment, err := S.GetCommentByID(commentID, r); err == nil {
+		S.PushPostViewers(target.PostID, commentID, "comment-updated", map[string]interface{}{
+			"postId":  target.PostID,
+			"comment": comment,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"hidden": hidden})
+}
+
+// GetCommentRevisionsHandler returns the previous versions of a comment, newest first
+func (S *Server) GetCommentRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	currentUserID, _ := CurrentUser(r)
+	commentID := tools.StringToInt(strings.TrimPrefix(r.URL.Path, "/api/comment-revisions/"))
+
+	_, canSee, err := S.CanSeeComment(currentUserID, commentID)
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	if !canSee {
+		tools.SendJSONError(w, "Comment not found", http.StatusNotFound)
+		return
+	}
+
+	rows, err := S.db.Query(`
+		SELECT id, content, created_at
+		FROM comment_revisions
+		WHERE comment_id = ?
+		ORDER BY created_at DESC, id DESC`, commentID)
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	revisions := []CommentRevision{}
+	for rows.Next() {
+		var rev CommentRevision
+		if err := rows.Scan(&rev.ID, &rev.Content, &rev.CreatedAt); err != nil {
+			http.Error(w, "DB Error", http.StatusInternalServerError)
+			return
+		}
+		revisions = append(revisions, rev)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"revisions": revisions})
+}
+
+// GetCommentTarget loads what the comment handlers need to authorize a change
+func (S *Server) GetCommentTarget(commentID int) (CommentTarget, error) {
+	var t CommentTarget
+	err := S.db.QueryRow(`
+		SELECT c.user_id, c.post_id, c.parent_comment_id, c.content, c.is_hidden, p.user_id
+		FROM comments c
+		JOIN posts p ON p.id = c.post_id
+		WHERE c.id = ?`, commentID,
+	).Scan(&t.AuthorID, &t.PostID, &t.ParentID, &t.Content, &t.IsHidden, &t.PostAuthorID)
+	return t, err
+}
+
+// CanSeeComment reports whether userID can see commentID: they can see its
+// post, and neither the comment nor one it replies to is hidden from them.
+// The comment's target comes with it when it exists.
+func (S *Server) CanSeeComment(userID, commentID int) (CommentTarget, bool, error) {
+	target, err := S.GetCommentTarget(commentID)
+	if err == sql.ErrNoRows {
+		return target, false, nil
+	}
+	if err != nil {
+		return target, false, err
+	}
+
+	var hidden bool
+	err = S.db.QueryRow(commentAncestorsSQL+`
+		SELECT EXISTS(SELECT 1 FROM ancestors a WHERE NOT `+visibleCommentSQL("a")+`)`,
+		commentID, userID, userID).Scan(&hidden)
+	if err != nil || hidden {
+		return target, false, err
+	}
+
+	canSee, err := S.CanSeePost(userID, target.PostID)
+	return target, canSee, err
+}
+
+// GetCommentThreadIDs returns commentID and the ids of all replies below it
+func GetCommentThreadIDs(tx *Tx, commentID int) ([]int, error) {
+	rows, err := tx.Query(`
+		WITH RECURSIVE thread(id) AS (
+			SELECT id FROM comments WHERE id = ?
+			UNION ALL
+			SELECT c.id FROM comments c JOIN thread t ON c.parent_comment_id = t.id
+		)
+		SELECT id FROM thread`, commentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// AdjustCommentCount moves the counter a visible comment counts toward:
+// comments.replies of its parent, or posts.comments for a top-level comment.
+func AdjustCommentCount(tx *Tx, postID int, parentID sql.NullInt64, delta int) error {
+	if parentID.Valid {
+		_, err := tx.Exec(`UPDATE comments SET replies = replies + ? WHERE id = ?`, delta, parentID.Int64)
+		return err
+	}
+	_, err := tx.Exec(`UPDATE posts SET comments = comments + ? WHERE id = ?`, delta, postID)
+	return err
+}
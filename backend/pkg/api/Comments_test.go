@@ -0,0 +1,231 @@
+package backend
+
+import (
+	tools "SOCIAL-NETWORK/pkg"
+	"database/sql"
+	"net/http"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+// addComment has user comment on postID, as a reply to parent unless it is 0
+func addComment(t *testing.T, S *Server, user testUser, postID, parent int) int {
+	t.Helper()
+	var parentID *string
+	if parent != 0 {
+		p := strconv.Itoa(parent)
+		parentID = &p
+	}
+	id, err := S.CreateComment(user.ID, "comment", postID, parentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// commentIDs returns the ids of comments in order
+func commentIDs(comments []Comment) []int {
+	ids := []int{}
+	for _, c := range comments {
+		ids = append(ids, tools.StringToInt(c.ID))
+	}
+	return ids
+}
+
+func TestGetCommentsTree(t *testing.T) {
+	S := newTestServer(t)
+	alice := createTestUser(t, S, "alice", false)
+	bob := createTestUser(t, S, "bob", false)
+	carol := createTestUser(t, S, "carol", false)
+	dave := createTestUser(t, S, "dave", false)
+
+	post := createPost(t, S, alice, "/api/create-post", map[string]any{"content": "hello", "privacy": "public"})
+	var roots, replies []int
+	for range 4 {
+		roots = append(roots, addComment(t, S, bob, post, 0))
+	}
+	for range 5 {
+		replies = append(replies, addComment(t, S, carol, post, roots[0]))
+	}
+	b1 := addComment(t, S, bob, post, replies[0])
+	b2 := addComment(t, S, bob, post, replies[0])
+	c1 := addComment(t, S, carol, post, b1)
+	hidden := addComment(t, S, carol, post, roots[1])
+	if _, err := S.db.Exec(`UPDATE comments SET is_hidden = TRUE WHERE id = ?`, hidden); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(viewer testUser, page CommentPage) ([]Comment, string) {
+		t.Helper()
+		page.PostID = post
+		if page.Sort == "" {
+			page.Sort = "oldest"
+		}
+		comments, next, err := S.GetComments(viewerRequest(viewer.ID), page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return comments, next
+	}
+	expect := func(what string, comments []Comment, want ...int) {
+		t.Helper()
+		if got := commentIDs(comments); !slices.Equal(got, want) {
+			t.Errorf("%s = %v, want %v", what, got, want)
+		}
+	}
+
+	comments, next := get(dave, CommentPage{Limit: 3, Depth: 2})
+	expect("first page", comments, roots[:3]...)
+	if next == "" {
+		t.Fatal("no cursor to the last comment")
+	}
+	first := comments[0]
+	expect("replies", first.Replies, replies[:3]...)
+	if first.NextRepliesCursor == "" {
+		t.Error("no cursor to the other replies")
+	}
+	a1 := first.Replies[0]
+	expect("replies to the first reply", a1.Replies, b1, b2)
+	if a1.NextRepliesCursor != "" {
+		t.Errorf("cursor %q past all replies", a1.NextRepliesCursor)
+	}
+	// below the depth only the count is there
+	if b := a1.Replies[0]; len(b.Replies) != 0 || b.RepliesCount != 1 {
+		t.Errorf("below the depth: %d replies, %d counted, want 0 and 1", len(b.Replies), b.RepliesCount)
+	}
+	expect("replies to a reply of a later reply", first.Replies[1].Replies)
+
+	cursor, err := DecodeCommentCursor(next, "oldest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	comments, next = get(dave, CommentPage{Limit: 3, Depth: 2, Cursor: &cursor})
+	expect("second page", comments, roots[3])
+	if next != "" {
+		t.Errorf("cursor %q past the last comment", next)
+	}
+
+	// "load more replies"
+	cursor, err = DecodeCommentCursor(first.NextRepliesCursor, "oldest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	comments, next = get(dave, CommentPage{ParentID: sql.NullInt64{Int64: int64(roots[0]), Valid: true}, Cursor: &cursor, Limit: 10, Depth: 3})
+	expect("more replies", comments, replies[3:]...)
+	if next != "" {
+		t.Errorf("cursor %q past the last reply", next)
+	}
+
+	// replies stay oldest first under any sort
+	comments, _ = get(dave, CommentPage{Sort: "newest", Limit: 10, Depth: 3})
+	expect("newest first", comments, roots[3], roots[2], roots[1], roots[0])
+	expect("replies under newest first", comments[3].Replies, replies[:3]...)
+	expect("deepest reply", comments[3].Replies[0].Replies[0].Replies, c1)
+
+	// a hidden reply only shows to its author and the post's author
+	for _, tt := range []struct {
+		viewer testUser
+		want   []int
+	}{
+		{dave, nil},
+		{bob, nil},
+		{carol, []int{hidden}},
+		{alice, []int{hidden}},
+	} {
+		comments, _ := get(tt.viewer, CommentPage{Limit: 10, Depth: 1})
+		expect("replies to user "+strconv.Itoa(tt.viewer.ID), comments[1].Replies, tt.want...)
+	}
+}
+
+func TestLikeCommentMustBeVisible(t *testing.T) {
+	S := newTestServer(t)
+	alice := createTestUser(t, S, "alice", false)
+	bob := createTestUser(t, S, "bob", false)
+	carol := createTestUser(t, S, "carol", false)
+
+	post := createPost(t, S, alice, "/api/create-post", map[string]any{"content": "hello", "privacy": "public"})
+	private := createPost(t, S, alice, "/api/create-post", map[string]any{"content": "secret", "privacy": "private"})
+	visible := addComment(t, S, alice, post, 0)
+	hidden := addComment(t, S, carol, post, 0)
+	underHidden := addComment(t, S, alice, post, hidden)
+	onPrivate := addComment(t, S, alice, private, 0)
+	deleted := addComment(t, S, alice, post, 0)
+	if _, err := S.db.Exec(`UPDATE comments SET is_hidden = TRUE WHERE id = ?`, hidden); err != nil {
+		t.Fatal(err)
+	}
+	if rec := do(t, S, &alice, http.MethodDelete, "/api/delete-comment/"+strconv.Itoa(deleted), nil); rec.Code != http.StatusOK {
+		t.Fatalf("delete: got %d %s", rec.Code, rec.Body)
+	}
+
+	like := func(user testUser, id int) int {
+		t.Helper()
+		return do(t, S, &user, http.MethodPost, "/api/like-comment/"+strconv.Itoa(id), nil).Code
+	}
+	for _, tt := range []struct {
+		name string
+		user testUser
+		id   int
+		want int
+	}{
+		{"visible", bob, visible, http.StatusOK},
+		{"missing", bob, deleted + 100, http.StatusNotFound},
+		{"deleted", bob, deleted, http.StatusNotFound},
+		{"hidden", bob, hidden, http.StatusNotFound},
+		{"reply to a hidden comment", bob, underHidden, http.StatusNotFound},
+		{"on a post bob can't see", bob, onPrivate, http.StatusNotFound},
+		// the author of the hidden comment still sees its thread
+		{"reply to own hidden comment", carol, underHidden, http.StatusOK},
+	} {
+		if got := like(tt.user, tt.id); got != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, got, tt.want)
+		}
+	}
+	if n := count(t, S, `SELECT COUNT(*) FROM likes WHERE user_id = ?`, bob.ID); n != 1 {
+		t.Errorf("bob has %d likes, want 1", n)
+	}
+}
+
+func TestGetRepliesOfHiddenOrForeignParent(t *testing.T) {
+	S := newTestServer(t)
+	alice := createTestUser(t, S, "alice", false)
+	bob := createTestUser(t, S, "bob", false)
+	carol := createTestUser(t, S, "carol", false)
+
+	post := createPost(t, S, alice, "/api/create-post", map[string]any{"content": "hello", "privacy": "public"})
+	other := createPost(t, S, alice, "/api/create-post", map[string]any{"content": "other", "privacy": "public"})
+	visible := addComment(t, S, carol, post, 0)
+	addComment(t, S, carol, post, visible)
+	hidden := addComment(t, S, carol, post, 0)
+	addComment(t, S, carol, post, hidden)
+	underHidden := addComment(t, S, carol, post, hidden)
+	addComment(t, S, carol, post, underHidden)
+	elsewhere := addComment(t, S, carol, other, 0)
+	addComment(t, S, carol, other, elsewhere)
+	if _, err := S.db.Exec(`UPDATE comments SET is_hidden = TRUE WHERE id = ?`, hidden); err != nil {
+		t.Fatal(err)
+	}
+
+	replies := func(user testUser, parent int) int {
+		t.Helper()
+		return do(t, S, &user, http.MethodGet, "/api/get-comments/"+strconv.Itoa(post)+"?parent="+strconv.Itoa(parent), nil).Code
+	}
+	for _, tt := range []struct {
+		name   string
+		user   testUser
+		parent int
+		want   int
+	}{
+		{"visible parent", bob, visible, http.StatusOK},
+		{"hidden parent", bob, hidden, http.StatusNotFound},
+		{"parent under a hidden comment", bob, underHidden, http.StatusNotFound},
+		{"parent on another post", bob, elsewhere, http.StatusNotFound},
+		{"missing parent", bob, elsewhere + 100, http.StatusNotFound},
+		{"own hidden parent", carol, hidden, http.StatusOK},
+		{"hidden parent on own post", alice, underHidden, http.StatusOK},
+	} {
+		if got := replies(tt.user, tt.parent); got != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package backend
+
+import (
+	tools "SOCIAL-NETWORK/pkg"
+	"database/sql"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	emailVerificationTTL = 48 * time.Hour
+	// a verification email can be sent again once the last one is this old
+	verificationResendCooldown = 2 * time.Minute
+	// and at most this many go out per user in a day
+	maxVerificationsPerDay = 5
+)
+
+type EmailVerificationConfirm struct {
+	Token string `json:"token"`
+}
+
+// IsEmailVerified reports whether userID confirmed their current email address
+func (S *Server) IsEmailVerified(userID int) (bool, error) {
+	var verified bool
+	err := S.db.QueryRow(`SELECT email_verified_at IS NOT NULL FROM users WHERE id = ?`, userID).Scan(&verified)
+	return verified, err
+}
+
+// SendEmailVerification stores a new verification token for userID and queues
+// the email carrying the link
+func (S *Server) SendEmailVerification(userID int) error {
+	var email, name string
+	if err := S.db.QueryRow(`SELECT email, first_name FROM users WHERE id = ?`, userID).Scan(&email, &name); err != nil {
+		return err
+	}
+
+	token, hash, err := NewSecretToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if _, err := S.db.Exec(`
+		INSERT INTO email_verifications (user_id, token_hash, expires_at, created_at) VALUES (?, ?, ?, ?)`,
+		userID, hash, S.db.Timestamp(now.Add(emailVerificationTTL)), S.db.Timestamp(now)); err != nil {
+		return err
+	}
+
+	return S.QueueEmail(email, "verify_email", map[string]any{
+		"Name":      name,
+		"Link":      AppURL() + "/auth/verify-email?token=" + token,
+		"ExpiresIn": "48 hours",
+	})
+}
+
+// VerifyEmailHandler marks the account of a token from a verification email
+// as verified. It works without a session so the link opens anywhere.
+func (S *Server) VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		tools.SendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req EmailVerificationConfirm
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		tools.SendJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err := S.VerifyEmail(req.Token)
+	if err == sql.ErrNoRows {
+		tools.SendJSONError(w, "This verification link is invalid or has expired", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"emailVerified": true})
+}
+
+// VerifyEmail spends a verification token. An unknown or expired token gives
+// sql.ErrNoRows.
+func (S *Server) VerifyEmail(token string) error {
+	tx, err := S.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := S.db.Timestamp(time.Now())
+	var userID int
+	if err := tx.QueryRow(`
+		DELETE FROM email_verifications WHERE token_hash = ? AND expires_at > ?
+		RETURNING user_id`, HashToken(token), now).Scan(&userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		UPDATE users SET email_verified_at = ? WHERE id = ? AND email_verified_at IS NULL`, now, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM email_verifications WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ResendVerificationHandler sends the caller a new verification link, at most
+// once per verificationResendCooldown and maxVerificationsPerDay times a day
+func (S *Server) ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		tools.SendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, _ := CurrentUser(r)
+
+	verified, err := S.IsEmailVerified(userID)
+	if err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if verified {
+		tools.SendJSONError(w, "Email already verified", http.StatusConflict)
+		return
+	}
+
+	retryAfter, err := S.VerificationRetryAfter(userID, time.Now())
+	if err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		tools.SendJSONError(w, "Please wait before asking for another email", http.StatusTooManyRequests)
+		return
+	}
+
+	if err := S.SendEmailVerification(userID); err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Verification email sent"})
+}
+
+// VerificationRetryAfter is how long userID has to wait before another
+// verification email may be sent, 0 when one may go out now
+func (S *Server) VerificationRetryAfter(userID int, now time.Time) (time.Duration, error) {
+	rows, err := S.db.Query(`
+		SELECT created_at FROM email_verifications
+		WHERE user_id = ? AND created_at > ?
+		ORDER BY created_at DESC`, userID, S.db.Timestamp(now.Add(-24*time.Hour)))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var sent []time.Time
+	for rows.Next() {
+		var t time.Time
+		if err := rows.Scan(&t); err != nil {
+			return 0, err
+		}
+		sent = append(sent, t)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var wait time.Duration
+	if len(sent) > 0 {
+		wait = sent[0].Add(verificationResendCooldown).Sub(now)
+	}
+	if len(sent) >= maxVerificationsPerDay {
+		// the oldest of the day has to fall out of the window
+		wait = max(wait, sent[len(sent)-1].Add(24*time.Hour).Sub(now))
+	}
+	return max(wait, 0), nil
+}
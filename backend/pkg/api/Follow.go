@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -14,28 +15,29 @@ func (S *Server) CancelFollowRequestHandler(w http.ResponseWriter, r *http.Reque
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	var body struct {
-		FollowerID  string `json:"follower"`
-		FollowingID string `json:"following"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, "invalid body", http.StatusBadRequest)
+	currentUserID, _ := CurrentUser(r)
+	target, ok := S.ReadFollowTarget(w, r, currentUserID)
+	if !ok {
 		return
 	}
 
-	_, err := S.db.Exec(`
+	res, err := S.db.Exec(`
 		DELETE FROM follow_requests 
 		WHERE sender_id = ? AND receiver_id = ?`,
-		body.FollowerID, body.FollowingID,
+		currentUserID, target.ID,
 	)
 	if err != nil {
 		http.Error(w, "failed to cancel follow request", http.StatusInternalServerError)
 		return
 	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "follow request not found", http.StatusNotFound)
+		return
+	}
 	//dellete notification from database
-	S.DeleteNotification(body.FollowerID, body.FollowingID, "follow_request")
+	S.DeleteNotification(tools.IntToString(currentUserID), tools.IntToString(target.ID), "follow_request")
 
-	S.PushNotification("-delete", tools.StringToInt(body.FollowingID), Notification{})
+	S.PushNotification("-delete", target.ID, Notification{})
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "follow request cancelled"})
@@ -46,6 +48,8 @@ func (S *Server) AcceptFollowRequestHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	currentUserID, _ := CurrentUser(r)
+
 	var FollowerID, FollowingID string
 	id := r.URL.Path[len("/api/accept-follow-request/"):]
 
@@ -55,6 +59,11 @@ func (S *Server) AcceptFollowRequestHandler(w http.ResponseWriter, r *http.Reque
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	// only the receiver of the request can accept it
+	if FollowingID != tools.IntToString(currentUserID) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
 
 	tx, err := S.db.Begin()
 	if err != nil {
@@ -63,7 +72,7 @@ func (S *Server) AcceptFollowRequestHandler(w http.ResponseWriter, r *http.Reque
 	}
 	defer tx.Rollback()
 
-	_, err = tx.Exec(`
+	res, err := tx.Exec(`
 		DELETE FROM follow_requests 
 		WHERE sender_id = ? AND receiver_id = ?`,
 		FollowerID, FollowingID,
@@ -72,6 +81,10 @@ func (S *Server) AcceptFollowRequestHandler(w http.ResponseWriter, r *http.Reque
 		http.Error(w, "failed to delete follow request", http.StatusInternalServerError)
 		return
 	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "follow request not found", http.StatusNotFound)
+		return
+	}
 
 	_, err = tx.Exec(`
 		INSERT INTO follows (follower_id, following_id) 
@@ -115,6 +128,8 @@ func (S *Server) DeclineFollowRequestHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	currentUserID, _ := CurrentUser(r)
+
 	var FollowerID, FollowingID string
 	id := r.URL.Path[len("/api/decline-follow-request/"):]
 
@@ -124,8 +139,13 @@ func (S *Server) DeclineFollowRequestHandler(w http.ResponseWriter, r *http.Requ
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	// only the receiver of the request can decline it
+	if FollowingID != tools.IntToString(currentUserID) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
 
-	_, err = S.db.Exec(`
+	res, err := S.db.Exec(`
 		DELETE FROM follow_requests 
 		WHERE sender_id = ? AND receiver_id = ?`,
 		FollowerID, FollowingID,
@@ -134,6 +154,10 @@ func (S *Server) DeclineFollowRequestHandler(w http.ResponseWriter, r *http.Requ
 		http.Error(w, "failed to decline follow request", http.StatusInternalServerError)
 		return
 	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "follow request not found", http.StatusNotFound)
+		return
+	}
 	S.DeleteNotification(FollowerID, FollowingID, "follow_request")
 
 	S.PushNotification("-read", tools.StringToInt(FollowingID), Notification{})
@@ -146,12 +170,13 @@ func (S *Server) SendFollowRequestHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	var req struct {
-		Follower  string `json:"follower"`
-		Following string `json:"following"`
+	currentUserID, _ := CurrentUser(r)
+	target, ok := S.ReadFollowTarget(w, r, currentUserID)
+	if !ok {
+		return
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !target.IsPrivate {
+		http.Error(w, "This account is public, follow it directly", http.StatusBadRequest)
 		return
 	}
 
@@ -161,7 +186,7 @@ func (S *Server) SendFollowRequestHandler(w http.ResponseWriter, r *http.Request
 		SELECT COUNT(*) 
 		FROM follow_requests 
 		WHERE sender_id = ? AND receiver_id = ? AND status = 'pending'
-	`, req.Follower, req.Following).Scan(&exists)
+	`, currentUserID, target.ID).Scan(&exists)
 	if err != nil {
 		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -174,15 +199,15 @@ func (S *Server) SendFollowRequestHandler(w http.ResponseWriter, r *http.Request
 	_, err = S.db.Exec(`
 		INSERT INTO follow_requests (sender_id, receiver_id, status) 
 		VALUES (?, ?, 'pending')
-	`, req.Follower, req.Following)
+	`, currentUserID, target.ID)
 	if err != nil {
 		http.Error(w, "Error inserting follow request: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	notification := Notification{
-		ID:        tools.StringToInt(req.Following),
-		ActorID:   tools.StringToInt(req.Follower),
+		ID:        target.ID,
+		ActorID:   currentUserID,
 		Type:      "follow_request",
 		Content:   "Follow request",
 		IsRead:    false,
@@ -193,7 +218,7 @@ func (S *Server) SendFollowRequestHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	S.PushNotification("-new", tools.StringToInt(req.Following), notification)
+	S.PushNotification("-new", target.ID, notification)
 
 	json.NewEncoder(w).Encode(map[string]string{
 		"message": "Follow request sent",
@@ -205,24 +230,25 @@ func (S *Server) FollowHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var body struct {
-		Follower  string `json:"follower"`
-		Following string `json:"following"`
+	currentUserID, _ := CurrentUser(r)
+	target, ok := S.ReadFollowTarget(w, r, currentUserID)
+	if !ok {
+		return
 	}
-
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, "invalid body", http.StatusBadRequest)
+	// private accounts go through the follow_requests flow
+	if target.IsPrivate {
+		http.Error(w, "This account is private, send a follow request", http.StatusForbidden)
 		return
 	}
 
-	if err := S.FollowUser(body.Follower, body.Following); err != nil {
+	if err := S.FollowUser(tools.IntToString(currentUserID), tools.IntToString(target.ID)); err != nil {
 		http.Error(w, "failed to follow", http.StatusInternalServerError)
 		return
 	}
 
 	notification := Notification{
-		ID:        tools.StringToInt(body.Following),
-		ActorID:   tools.StringToInt(body.Follower),
+		ID:        target.ID,
+		ActorID:   currentUserID,
 		Type:      "follow",
 		Content:   "Follow",
 		IsRead:    false,
@@ -235,7 +261,7 @@ func (S *Server) FollowHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	S.PushNotification("-new", tools.StringToInt(body.Following), notification)
+	S.PushNotification("-new", target.ID, notification)
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
@@ -248,30 +274,73 @@ func (S *Server) UnfollowHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var body struct {
-		Follower  string `json:"follower"`
-		Following string `json:"following"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, "invalid body", http.StatusBadRequest)
+	currentUserID, _ := CurrentUser(r)
+	target, ok := S.ReadFollowTarget(w, r, currentUserID)
+	if !ok {
 		return
 	}
 
-	if err := S.UnfollowUser(body.Follower, body.Following); err != nil {
+	follower, following := tools.IntToString(currentUserID), tools.IntToString(target.ID)
+	if err := S.UnfollowUser(follower, following); err != nil {
 		http.Error(w, "failed to unfollow", http.StatusInternalServerError)
 		return
 	}
 
-	S.DeleteNotification(body.Follower, body.Following, "follow")
+	S.DeleteNotification(follower, following, "follow")
 
-	S.PushNotification("-delete", tools.StringToInt(body.Following), Notification{})
+	S.PushNotification("-delete", target.ID, Notification{})
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
 		"message": "unfollowed successfully",
 	})
 }
+
+// ReadFollowTarget decodes {"following": id} or {"url": url} from the body and
+// loads the target user. It writes the error response itself and returns false
+// when the request can't go on.
+func (S *Server) ReadFollowTarget(w http.ResponseWriter, r *http.Request, currentUserID int) (FollowTarget, bool) {
+	var body struct {
+		Following string `json:"following"`
+		Url       string `json:"url"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return FollowTarget{}, false
+	}
+	if body.Following == "" && body.Url == "" {
+		http.Error(w, "target user required", http.StatusBadRequest)
+		return FollowTarget{}, false
+	}
+
+	query, arg := `SELECT id, is_private FROM users WHERE url = ?`, interface{}(body.Url)
+	if body.Following != "" {
+		id, err := strconv.Atoi(body.Following)
+		if err != nil {
+			http.Error(w, "invalid user id", http.StatusBadRequest)
+			return FollowTarget{}, false
+		}
+		query, arg = `SELECT id, is_private FROM users WHERE id = ?`, id
+	}
+
+	var target FollowTarget
+	err := S.db.QueryRow(query, arg).Scan(&target.ID, &target.IsPrivate)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "user not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "DB error", http.StatusInternalServerError)
+		}
+		return FollowTarget{}, false
+	}
+
+	if target.ID == currentUserID {
+		http.Error(w, "you cannot follow yourself", http.StatusBadRequest)
+		return FollowTarget{}, false
+	}
+	return target, true
+}
+
 func (S *Server) FollowUser(follower, following string) error {
 	if follower == following {
 		return fmt.Errorf("you cannot follow yourself")
@@ -320,7 +389,7 @@ func (S *Server) GetFollowingCount(url string) (int, error) {
 	return count, nil
 }
 func (S *Server) GetFollowRequestStatus(r *http.Request, followingURL string) (string, error) {
-	follower, _, _ := S.CheckSession(r)
+	follower, _ := CurrentUser(r)
 	var followingID int
 	err := S.db.QueryRow(`SELECT id FROM users WHERE url = ?`, followingURL).Scan(&followingID)
 	if err != nil {
@@ -338,7 +407,7 @@ func (S *Server) GetFollowRequestStatus(r *http.Request, followingURL string) (s
 	return status, nil
 }
 func (S *Server) IsFollowing(r *http.Request, followingURL, followingID string) (bool, error) {
-	followerID, _, _ := S.CheckSession(r)
+	followerID, _ := CurrentUser(r)
 	if followingID == "" {
 		err := S.db.QueryRow(`SELECT id FROM users WHERE url = ?`, followingURL).Scan(&followingID)
 		if err != nil {
@@ -355,7 +424,7 @@ func (S *Server) IsFollowing(r *http.Request, followingURL, followingID string)
 }
 
 func (S *Server) IsFollower(r *http.Request, followingURL, followingID string) (bool, error) {
-	followerID, _, _ := S.CheckSession(r)
+	followerID, _ := CurrentUser(r)
 	if followingID == "" {
 		err := S.db.QueryRow(`SELECT id FROM users WHERE url = ?`, followingURL).Scan(&followingID)
 		if err != nil {
@@ -377,7 +446,7 @@ func (S *Server) GetFollowersHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	currentUser, _, _ := S.CheckSession(r)
+	currentUser, _ := CurrentUser(r)
 	followers, err := S.GetFollowers(currentUser)
 	if err != nil {
 		http.Error(w, "failed to get followers", http.StatusInternalServerError)
@@ -0,0 +1,190 @@
+package backend
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestFollowIgnoresFollowerInBody(t *testing.T) {
+	S := newTestServer(t)
+	alice := createTestUser(t, S, "alice", false)
+	bob := createTestUser(t, S, "bob", false)
+	carol := createTestUser(t, S, "carol", false)
+
+	// alice tries to make carol follow bob
+	rec := do(t, S, &alice, http.MethodPost, "/api/follow", map[string]string{
+		"follower":  strconv.Itoa(carol.ID),
+		"following": strconv.Itoa(bob.ID),
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("follow: got %d %s", rec.Code, rec.Body)
+	}
+	if n := count(t, S, `SELECT COUNT(*) FROM follows WHERE follower_id = ?`, carol.ID); n != 0 {
+		t.Errorf("carol follows %d users, want 0", n)
+	}
+	if n := count(t, S, `SELECT COUNT(*) FROM follows WHERE follower_id = ? AND following_id = ?`, alice.ID, bob.ID); n != 1 {
+		t.Errorf("alice follows bob %d times, want 1", n)
+	}
+
+	// unfollowing on carol's behalf only ever touches alice's follows
+	if _, err := S.db.Exec(`INSERT INTO follows (follower_id, following_id) VALUES (?, ?)`, carol.ID, bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	rec = do(t, S, &alice, http.MethodPost, "/api/unfollow", map[string]string{
+		"follower":  strconv.Itoa(carol.ID),
+		"following": strconv.Itoa(bob.ID),
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unfollow: got %d %s", rec.Code, rec.Body)
+	}
+	if n := count(t, S, `SELECT COUNT(*) FROM follows WHERE follower_id = ? AND following_id = ?`, carol.ID, bob.ID); n != 1 {
+		t.Errorf("carol follows bob %d times after alice's unfollow, want 1", n)
+	}
+}
+
+func TestFollowSelf(t *testing.T) {
+	S := newTestServer(t)
+	alice := createTestUser(t, S, "alice", false)
+
+	rec := do(t, S, &alice, http.MethodPost, "/api/follow", map[string]string{"following": strconv.Itoa(alice.ID)})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("got %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestFollowPrivateAccount(t *testing.T) {
+	S := newTestServer(t)
+	alice := createTestUser(t, S, "alice", false)
+	bob := createTestUser(t, S, "bob", true)
+
+	for _, body := range []map[string]string{
+		{"following": strconv.Itoa(bob.ID)},
+		{"url": "bob"},
+	} {
+		rec := do(t, S, &alice, http.MethodPost, "/api/follow", body)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("follow %v: got %d, want %d", body, rec.Code, http.StatusForbidden)
+		}
+	}
+	if n := count(t, S, `SELECT COUNT(*) FROM follows WHERE following_id = ?`, bob.ID); n != 0 {
+		t.Errorf("bob has %d followers, want 0", n)
+	}
+}
+
+// sendFollowRequest has from ask to follow to and returns the id of the
+// follow_request notification to receives
+func sendFollowRequest(t *testing.T, S *Server, from, to testUser) string {
+	t.Helper()
+	rec := do(t, S, &from, http.MethodPost, "/api/send-follow-request", map[string]string{"following": strconv.Itoa(to.ID)})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("send follow request: got %d %s", rec.Code, rec.Body)
+	}
+	var id int
+	if err := S.db.QueryRow(`SELECT id FROM notifications WHERE user_id = ? AND actor_id = ? AND type = 'follow_request'`,
+		to.ID, from.ID).Scan(&id); err != nil {
+		t.Fatalf("follow request notification: %v", err)
+	}
+	return strconv.Itoa(id)
+}
+
+func TestAnswerFollowRequestOnlyAsReceiver(t *testing.T) {
+	for _, action := range []string{"accept", "decline"} {
+		t.Run(action, func(t *testing.T) {
+			S := newTestServer(t)
+			alice := createTestUser(t, S, "alice", false)
+			bob := createTestUser(t, S, "bob", true)
+			carol := createTestUser(t, S, "carol", false)
+			notificationID := sendFollowRequest(t, S, alice, bob)
+			path := "/api/" + action + "-follow-request/" + notificationID
+
+			// neither a third user nor the sender can answer it
+			for _, user := range []testUser{carol, alice} {
+				rec := do(t, S, &user, http.MethodPost, path, nil)
+				if rec.Code != http.StatusForbidden {
+					t.Errorf("user %d: got %d, want %d", user.ID, rec.Code, http.StatusForbidden)
+				}
+			}
+			if n := count(t, S, `SELECT COUNT(*) FROM follow_requests WHERE sender_id = ? AND receiver_id = ?`, alice.ID, bob.ID); n != 1 {
+				t.Fatalf("%d follow requests left, want 1", n)
+			}
+			if n := count(t, S, `SELECT COUNT(*) FROM follows`); n != 0 {
+				t.Errorf("%d follows, want 0", n)
+			}
+
+			rec := do(t, S, &bob, http.MethodPost, path, nil)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("receiver: got %d %s", rec.Code, rec.Body)
+			}
+			want := 0
+			if action == "accept" {
+				want = 1
+			}
+			if n := count(t, S, `SELECT COUNT(*) FROM follows WHERE follower_id = ? AND following_id = ?`, alice.ID, bob.ID); n != want {
+				t.Errorf("alice follows bob %d times, want %d", n, want)
+			}
+		})
+	}
+}
+
+func TestAcceptFollowRequestNeedsFollowRequest(t *testing.T) {
+	S := newTestServer(t)
+	alice := createTestUser(t, S, "alice", false)
+	bob := createTestUser(t, S, "bob", true)
+
+	// bob got some other notification from alice, it can't be turned into a follow
+	var notificationID int
+	if err := S.db.QueryRow(`
+		INSERT INTO notifications (user_id, actor_id, type, content) VALUES (?, ?, 'follow', 'Follow') RETURNING id`,
+		bob.ID, alice.ID).Scan(&notificationID); err != nil {
+		t.Fatal(err)
+	}
+	rec := do(t, S, &bob, http.MethodPost, "/api/accept-follow-request/"+strconv.Itoa(notificationID), nil)
+	if rec.Code == http.StatusOK {
+		t.Errorf("accepting a follow notification succeeded")
+	}
+
+	// a request alice cancelled can't be accepted through its old notification
+	requestID := sendFollowRequest(t, S, alice, bob)
+	if _, err := S.db.Exec(`DELETE FROM follow_requests WHERE sender_id = ?`, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	rec = do(t, S, &bob, http.MethodPost, "/api/accept-follow-request/"+requestID, nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("accepting a cancelled request: got %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if n := count(t, S, `SELECT COUNT(*) FROM follows`); n != 0 {
+		t.Errorf("%d follows, want 0", n)
+	}
+}
+
+func TestCancelOtherUsersFollowRequest(t *testing.T) {
+	S := newTestServer(t)
+	alice := createTestUser(t, S, "alice", false)
+	bob := createTestUser(t, S, "bob", true)
+	carol := createTestUser(t, S, "carol", false)
+	sendFollowRequest(t, S, alice, bob)
+
+	// carol names bob as the target and alice as the sender
+	rec := do(t, S, &carol, http.MethodPost, "/api/cancel-follow-request", map[string]string{
+		"follower":  strconv.Itoa(alice.ID),
+		"following": strconv.Itoa(bob.ID),
+	})
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("got %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if n := count(t, S, `SELECT COUNT(*) FROM follow_requests WHERE sender_id = ? AND receiver_id = ?`, alice.ID, bob.ID); n != 1 {
+		t.Errorf("%d follow requests left, want 1", n)
+	}
+	if n := count(t, S, `SELECT COUNT(*) FROM notifications WHERE user_id = ? AND type = 'follow_request'`, bob.ID); n != 1 {
+		t.Errorf("%d follow request notifications left, want 1", n)
+	}
+
+	rec = do(t, S, &alice, http.MethodPost, "/api/cancel-follow-request", map[string]string{"following": strconv.Itoa(bob.ID)})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("sender: got %d %s", rec.Code, rec.Body)
+	}
+	if n := count(t, S, `SELECT COUNT(*) FROM follow_requests`); n != 0 {
+		t.Errorf("%d follow requests left, want 0", n)
+	}
+}
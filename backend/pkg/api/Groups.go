@@ -18,11 +18,7 @@ func (S *Server) CreateGroupHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID, _, err := S.CheckSession(r)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
+	userID, _ := CurrentUser(r)
 
 	var group Group
 	if err := json.NewDecoder(r.Body).Decode(&group); err != nil {
@@ -36,14 +32,13 @@ func (S *Server) CreateGroupHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Insert group
-	res, err := S.db.Exec("INSERT INTO groups (creator_id, title, description) VALUES (?, ?, ?)", userID, html.EscapeString(group.Title), html.EscapeString(group.Description))
+	var groupID int
+	err := S.db.QueryRow("INSERT INTO groups (creator_id, title, description) VALUES (?, ?, ?) RETURNING id", userID, html.EscapeString(group.Title), html.EscapeString(group.Description)).Scan(&groupID)
 	if err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	groupID, _ := res.LastInsertId()
-
 	// Add creator as member
 	_, err = S.db.Exec("INSERT INTO group_members (group_id, user_id) VALUES (?, ?)", groupID, userID)
 	if err != nil {
@@ -51,7 +46,7 @@ func (S *Server) CreateGroupHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	group.ID = int(groupID)
+	group.ID = groupID
 	group.CreatorID = userID
 	group.CreatedAt = time.Now().Format(time.RFC3339)
 	group.IsMember = true
@@ -63,7 +58,7 @@ func (S *Server) CreateGroupHandler(w http.ResponseWriter, r *http.Request) {
 
 // GetGroupsHandler returns all groups
 func (S *Server) GetGroupsHandler(w http.ResponseWriter, r *http.Request) {
-	userID, _, _ := S.CheckSession(r) // Optional: check if user is logged in to show membership status
+	userID, _ := CurrentUser(r) // Optional: check if user is logged in to show membership status
 
 	rows, err := S.db.Query("SELECT id, creator_id, title, description, created_at FROM groups ORDER BY created_at DESC")
 	if err != nil {
@@ -96,7 +91,7 @@ func (S *Server) GetGroupHandler(w http.ResponseWriter, r *http.Request) {
 	groupIDStr := r.URL.Path[len("/api/groups/"):]
 	groupID := tools.StringToInt(groupIDStr)
 
-	userID, _, _ := S.CheckSession(r)
+	userID, _ := CurrentUser(r)
 
 	var g Group
 	err := S.db.QueryRow("SELECT id, creator_id, title, description, created_at FROM groups WHERE id = ?", groupID).Scan(&g.ID, &g.CreatorID, &g.Title, &g.Description, &g.CreatedAt)
@@ -127,11 +122,7 @@ func (S *Server) UpdateGroupHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID, _, err := S.CheckSession(r)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
+	userID, _ := CurrentUser(r)
 
 	var group Group
 	if err := json.NewDecoder(r.Body).Decode(&group); err != nil {
@@ -141,7 +132,7 @@ func (S *Server) UpdateGroupHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Check ownership
 	var creatorID int
-	err = S.db.QueryRow("SELECT creator_id FROM groups WHERE id = ?", group.ID).Scan(&creatorID)
+	err := S.db.QueryRow("SELECT creator_id FROM groups WHERE id = ?", group.ID).Scan(&creatorID)
 	if err != nil {
 		http.Error(w, "Group not found", http.StatusNotFound)
 		return
@@ -171,15 +162,11 @@ func (S *Server) DeleteGroupHandler(w http.ResponseWriter, r *http.Request) {
 	groupIDStr := r.URL.Path[len("/api/groups/delete/"):]
 	groupID := tools.StringToInt(groupIDStr)
 
-	userID, _, err := S.CheckSession(r)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
+	userID, _ := CurrentUser(r)
 
 	// Check ownership
 	var creatorID int
-	err = S.db.QueryRow("SELECT creator_id FROM groups WHERE id = ?", groupID).Scan(&creatorID)
+	err := S.db.QueryRow("SELECT creator_id FROM groups WHERE id = ?", groupID).Scan(&creatorID)
 	if err != nil {
 		http.Error(w, "Group not found", http.StatusNotFound)
 		return
@@ -206,11 +193,7 @@ func (S *Server) JoinGroupRequestHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	userID, _, err := S.CheckSession(r)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
+	userID, _ := CurrentUser(r)
 
 	var req struct {
 		GroupID int `json:"groupId"`
@@ -235,12 +218,19 @@ func (S *Server) JoinGroupRequestHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	_, err = S.db.Exec("INSERT INTO group_requests (group_id, user_id, requester_id, type, status) VALUES (?, ?, ?, 'request', 'pending')", req.GroupID, userID, userID)
+	_, err := S.db.Exec("INSERT INTO group_requests (group_id, user_id, requester_id, type, status) VALUES (?, ?, ?, 'request', 'pending')", req.GroupID, userID, userID)
 	if err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
+	var creatorID int
+	if err := S.db.QueryRow("SELECT creator_id FROM groups WHERE id = ?", req.GroupID).Scan(&creatorID); err == nil {
+		notification := Notification{ID: creatorID, ActorID: userID, Type: "group_join_request", Content: "Asked To Join Your Group", GroupID: req.GroupID}
+		S.IsertNotification(notification)
+		S.PushNotification("-new", creatorID, notification)
+	}
+
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -251,11 +241,7 @@ func (S *Server) InviteGroupMemberHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	userID, _, err := S.CheckSession(r)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
+	userID, _ := CurrentUser(r)
 
 	var req struct {
 		GroupID int `json:"groupId"`
@@ -288,12 +274,16 @@ func (S *Server) InviteGroupMemberHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	_, err = S.db.Exec("INSERT INTO group_requests (group_id, user_id, requester_id, type, status) VALUES (?, ?, ?, 'invite', 'pending')", req.GroupID, req.UserID, userID)
+	_, err := S.db.Exec("INSERT INTO group_requests (group_id, user_id, requester_id, type, status) VALUES (?, ?, ?, 'invite', 'pending')", req.GroupID, req.UserID, userID)
 	if err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
+	notification := Notification{ID: req.UserID, ActorID: userID, Type: "group_invite", Content: "Invited You To A Group", GroupID: req.GroupID}
+	S.IsertNotification(notification)
+	S.PushNotification("-new", req.UserID, notification)
+
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -304,17 +294,13 @@ func (S *Server) AcceptGroupRequestHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	userID, _, err := S.CheckSession(r)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
+	userID, _ := CurrentUser(r)
 
 	requestIDStr := r.URL.Path[len("/api/groups/requests/accept/"):]
 	requestID := tools.StringToInt(requestIDStr)
 
 	var req GroupRequest
-	err = S.db.QueryRow("SELECT id, group_id, user_id, requester_id, type, status FROM group_requests WHERE id = ?", requestID).Scan(&req.ID, &req.GroupID, &req.UserID, &req.RequesterID, &req.Type, &req.Status)
+	err := S.db.QueryRow("SELECT id, group_id, user_id, requester_id, type, status FROM group_requests WHERE id = ?", requestID).Scan(&req.ID, &req.GroupID, &req.UserID, &req.RequesterID, &req.Type, &req.Status)
 	if err != nil {
 		http.Error(w, "Request not found", http.StatusNotFound)
 		return
@@ -365,17 +351,13 @@ func (S *Server) DeclineGroupRequestHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	userID, _, err := S.CheckSession(r)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
+	userID, _ := CurrentUser(r)
 
 	requestIDStr := r.URL.Path[len("/api/groups/requests/decline/"):]
 	requestID := tools.StringToInt(requestIDStr)
 
 	var req GroupRequest
-	err = S.db.QueryRow("SELECT id, group_id, user_id, requester_id, type, status FROM group_requests WHERE id = ?", requestID).Scan(&req.ID, &req.GroupID, &req.UserID, &req.RequesterID, &req.Type, &req.Status)
+	err := S.db.QueryRow("SELECT id, group_id, user_id, requester_id, type, status FROM group_requests WHERE id = ?", requestID).Scan(&req.ID, &req.GroupID, &req.UserID, &req.RequesterID, &req.Type, &req.Status)
 	if err != nil {
 		http.Error(w, "Request not found", http.StatusNotFound)
 		return
@@ -414,14 +396,11 @@ func (S *Server) DeclineGroupRequestHandler(w http.ResponseWriter, r *http.Reque
 
 // GetGroupRequestsHandler returns pending requests for a group (for creator) or invites for a user
 func (S *Server) GetGroupRequestsHandler(w http.ResponseWriter, r *http.Request) {
-	userID, _, err := S.CheckSession(r)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
+	userID, _ := CurrentUser(r)
 
 	groupIDStr := r.URL.Query().Get("groupId")
 	var rows *sql.Rows
+	var err error
 
 	if groupIDStr != "" {
 		// Get requests for a specific group (Creator only)
@@ -495,11 +474,7 @@ func (S *Server) CreateGroupPostHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	userID, _, err := S.CheckSession(r)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
+	userID, _ := CurrentUser(r)
 
 	var post struct {
 		Post
@@ -518,17 +493,22 @@ func (S *Server) CreateGroupPostHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	image, ok := S.ReadNewPostImage(w, userID, post.Image)
+	if !ok {
+		return
+	}
+	post.Image = image
 	if strings.TrimSpace(post.Content) == "" && post.Image == nil {
 		http.Error(w, "Content cannot be empty", http.StatusBadRequest)
 		return
 	}
 
 	// Insert into database
-	res, err := S.db.Exec(`
+	err := S.db.QueryRow(`
         INSERT INTO posts (user_id, content, image, privacy, group_id)
-        VALUES (?, ?, ?, 'public', ?)`, // Group posts are public within the group context, or we can use 'group' privacy if we added it. But schema has 'public' default.
+        VALUES (?, ?, ?, 'public', ?) RETURNING id`, // Group posts are public within the group context, or we can use 'group' privacy if we added it. But schema has 'public' default.
 		userID, html.EscapeString(post.Content), post.Image, post.GroupID,
-	)
+	).Scan(&post.ID)
 
 	if err != nil {
 		fmt.Println("Error inserting group post:", err)
@@ -536,8 +516,6 @@ func (S *Server) CreateGroupPostHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	lastID, _ := res.LastInsertId()
-	post.ID = int(lastID)
 	post.UserID = userID
 	post.CreatedAt = time.Now().Format(time.RFC3339)
 
@@ -558,11 +536,7 @@ func (S *Server) GetGroupPostsHandler(w http.ResponseWriter, r *http.Request) {
 	groupIDStr := r.URL.Path[len("/api/groups/posts/"):]
 	groupID := tools.StringToInt(groupIDStr)
 
-	userID, _, err := S.CheckSession(r)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
+	userID, _ := CurrentUser(r)
 
 	// Check membership
 	var count int
@@ -577,8 +551,9 @@ func (S *Server) GetGroupPostsHandler(w http.ResponseWriter, r *http.Request) {
 		p.id, p.content, p.image, p.created_at, p.privacy,
 		u.id, u.first_name, u.last_name, u.nickname, u.avatar, u.is_private,
 		(SELECT COUNT(*) FROM likes l WHERE l.post_id = p.id) as like_count,
-		(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id AND c.parent_comment_id IS NULL) as comment_count,
-		EXISTS(SELECT 1 FROM likes l WHERE l.post_id = p.id AND l.user_id = ?) as is_liked
+		p.comments as comment_count,
+		EXISTS(SELECT 1 FROM likes l WHERE l.post_id = p.id AND l.user_id = ?) as is_liked,
+		EXISTS(SELECT 1 FROM post_revisions pr WHERE pr.post_id = p.id) as is_edited
 	FROM posts p
 	JOIN users u ON p.user_id = u.id
 	WHERE p.group_id = ?
@@ -600,12 +575,13 @@ func (S *Server) GetGroupPostsHandler(w http.ResponseWriter, r *http.Request) {
 		if err := rows.Scan(
 			&post.ID, &post.Content, &post.Image, &post.CreatedAt, &post.Privacy,
 			&authorID, &firstName, &lastName, &nickname, &avatar, &isPrivate,
-			&post.Likes, &post.Comments, &post.IsLiked,
+			&post.Likes, &post.Comments, &post.IsLiked, &post.IsEdited,
 		); err != nil {
 			continue
 		}
 
 		post.Author = Author{
+			ID:        authorID,
 			Name:      firstName.String + " " + lastName.String,
 			Username:  nickname.String,
 			Avatar:    avatar.String,
@@ -626,11 +602,7 @@ func (S *Server) CreateGroupEventHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	userID, _, err := S.CheckSession(r)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
+	userID, _ := CurrentUser(r)
 
 	var event GroupEvent
 	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
@@ -646,30 +618,53 @@ func (S *Server) CreateGroupEventHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	res, err := S.db.Exec("INSERT INTO events (group_id, title, description, event_datetime) VALUES (?, ?, ?, ?)", event.GroupID, html.EscapeString(event.Title), html.EscapeString(event.Description), event.EventDatetime)
+	err := S.db.QueryRow("INSERT INTO events (group_id, title, description, event_datetime) VALUES (?, ?, ?, ?) RETURNING id", event.GroupID, html.EscapeString(event.Title), html.EscapeString(event.Description), event.EventDatetime).Scan(&event.ID)
 	if err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	eventID, _ := res.LastInsertId()
-	event.ID = int(eventID)
 	event.CreatedAt = time.Now().Format(time.RFC3339)
 
+	S.NotifyGroupMembers(Notification{ActorID: userID, Type: "group_event", Content: "Created An Event In Your Group",
+		GroupID: event.GroupID, EventID: event.ID})
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(event)
 }
 
+// NotifyGroupMembers sends notif to every member of notif.GroupID but its actor
+func (S *Server) NotifyGroupMembers(notif Notification) {
+	rows, err := S.db.Query("SELECT user_id FROM group_members WHERE group_id = ? AND user_id != ?", notif.GroupID, notif.ActorID)
+	if err != nil {
+		fmt.Println("Error getting group members:", err)
+		return
+	}
+	var members []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err == nil {
+			members = append(members, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range members {
+		notif.ID = id
+		if err := S.IsertNotification(notif); err != nil {
+			fmt.Println("Error inserting notification:", err)
+			continue
+		}
+		S.PushNotification("-new", id, notif)
+	}
+}
+
 // GetGroupEventsHandler returns events for a group
 func (S *Server) GetGroupEventsHandler(w http.ResponseWriter, r *http.Request) {
 	groupIDStr := r.URL.Path[len("/api/groups/events/"):]
 	groupID := tools.StringToInt(groupIDStr)
 
-	userID, _, err := S.CheckSession(r)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
+	userID, _ := CurrentUser(r)
 
 	// Check membership
 	var count int
@@ -717,11 +712,7 @@ func (S *Server) RespondToGroupEventHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	userID, _, err := S.CheckSession(r)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
+	userID, _ := CurrentUser(r)
 
 	var req struct {
 		EventID int    `json:"eventId"`
@@ -739,7 +730,7 @@ func (S *Server) RespondToGroupEventHandler(w http.ResponseWriter, r *http.Reque
 
 	// Check if user is member of the group that owns the event
 	var groupID int
-	err = S.db.QueryRow("SELECT group_id FROM events WHERE id = ?", req.EventID).Scan(&groupID)
+	err := S.db.QueryRow("SELECT group_id FROM events WHERE id = ?", req.EventID).Scan(&groupID)
 	if err != nil {
 		http.Error(w, "Event not found", http.StatusNotFound)
 		return
@@ -771,11 +762,7 @@ func (S *Server) GetGroupChatHandler(w http.ResponseWriter, r *http.Request) {
 	groupIDStr := r.URL.Path[len("/api/groups/chat/"):]
 	groupID := tools.StringToInt(groupIDStr)
 
-	userID, _, err := S.CheckSession(r)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
+	userID, _ := CurrentUser(r)
 
 	// Check membership
 	var count int
@@ -835,11 +822,7 @@ func (S *Server) SendGroupMessageHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	userID, sessionID, err := S.CheckSession(r)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
+	userID, sessionID := CurrentUser(r)
 
 	var msg struct {
 		GroupID int    `json:"groupId"`
@@ -864,12 +847,12 @@ func (S *Server) SendGroupMessageHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Insert message
-	res, err := S.db.Exec("INSERT INTO group_messages (group_id, sender_id, content) VALUES (?, ?, ?)", msg.GroupID, userID, html.EscapeString(msg.Content))
+	var msgID int
+	err := S.db.QueryRow("INSERT INTO group_messages (group_id, sender_id, content) VALUES (?, ?, ?) RETURNING id", msg.GroupID, userID, html.EscapeString(msg.Content)).Scan(&msgID)
 	if err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
-	msgID, _ := res.LastInsertId()
 
 	// Get sender info
 	var sender User
@@ -914,11 +897,7 @@ func (S *Server) GetGroupMembersHandler(w http.ResponseWriter, r *http.Request)
 	groupID := tools.StringToInt(groupIDStr)
 
 	fmt.Println("Getting members for group ID:", groupID)
-	userID, _, err := S.CheckSession(r)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
+	userID, _ := CurrentUser(r)
 
 	// Check membership
 	var count int
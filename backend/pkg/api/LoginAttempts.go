@@ -0,0 +1,267 @@
+package backend
+
+import (
+	tools "SOCIAL-NETWORK/pkg"
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Failed logins are counted per account and per client IP. Identifiers that
+// match no account are counted too, under the account policy, so that they
+// lock out like existing accounts do and the answers don't tell them apart.
+const (
+	loginScopeAccount    = "account"
+	loginScopeIdentifier = "identifier"
+	loginScopeIP         = "ip"
+)
+
+// unknownUserPasswordHash is checked against when a login names no account so
+// that it takes as long as a wrong password. It is the bcrypt hash of a
+// random password nobody knows.
+const unknownUserPasswordHash = "$2a$10$ZFgKPD9MzO92BFzMpdl91eZxuSpi3VYTIbqcZjV3zdYXCYQ3GQnz2"
+
+// LoginPolicy is how many failures in a row one scope allows. The first
+// FreeFailures cost nothing, the ones after that are held back for a growing
+// delay and MaxFailures lock the subject out.
+type LoginPolicy struct {
+	FreeFailures int
+	MaxFailures  int
+}
+
+// LoginLimits holds the brute-force protection of LoginHandler. The IP policy
+// allows more failures than the account one because many users can share an
+// address.
+type LoginLimits struct {
+	Account LoginPolicy
+	IP      LoginPolicy
+	// BaseDelay doubles with every failure past the free ones, up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	Lockout   time.Duration
+	// Window is how long a failure is remembered
+	Window time.Duration
+	// now is the limiter's clock, time.Now outside of tests
+	now func() time.Time
+}
+
+// LoadLoginLimits reads the LOGIN_* settings from the environment
+func LoadLoginLimits() LoginLimits {
+	return LoginLimits{
+		Account:   LoginPolicy{FreeFailures: 3, MaxFailures: envInt("LOGIN_MAX_FAILURES", 10)},
+		IP:        LoginPolicy{FreeFailures: 20, MaxFailures: envInt("LOGIN_IP_MAX_FAILURES", 100)},
+		BaseDelay: time.Second,
+		MaxDelay:  time.Minute,
+		Lockout:   envDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		Window:    24 * time.Hour,
+		now:       time.Now,
+	}
+}
+
+// Now is the current time as the limiter sees it
+func (l LoginLimits) Now() time.Time {
+	if l.now == nil {
+		return time.Now()
+	}
+	return l.now()
+}
+
+// envInt reads a number from name, def when unset or invalid
+func envInt(name string, def int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("Invalid %s %q, using %d", name, v, def)
+		return def
+	}
+	return n
+}
+
+func (l LoginLimits) policy(scope string) LoginPolicy {
+	if scope == loginScopeIP {
+		return l.IP
+	}
+	return l.Account
+}
+
+// BlockFor is how long no login is tried after the given number of failures
+// in a row. A MaxFailures of 0 never locks out.
+func (l LoginLimits) BlockFor(p LoginPolicy, failures int) time.Duration {
+	if p.MaxFailures > 0 && failures >= p.MaxFailures {
+		return l.Lockout
+	}
+	if failures <= p.FreeFailures {
+		return 0
+	}
+	delay := l.BaseDelay
+	for i := p.FreeFailures + 1; i < failures && delay < l.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, l.MaxDelay)
+}
+
+// LoginSubject is one counter a login attempt is recorded under
+type LoginSubject struct {
+	Scope   string
+	Subject string
+}
+
+// LoginSubjects returns the counters of a login from r. An account is counted
+// by its id, so its email and nickname share one counter. userID is 0 when
+// identifier matched no account, the normalized identifier is counted then.
+func LoginSubjects(r *http.Request, userID int, identifier string) []LoginSubject {
+	account := LoginSubject{loginScopeAccount, strconv.Itoa(userID)}
+	if userID == 0 {
+		account = LoginSubject{loginScopeIdentifier, NormalizeLoginIdentifier(identifier)}
+	}
+	return []LoginSubject{{loginScopeIP, ClientIP(r)}, account}
+}
+
+// NormalizeLoginIdentifier is the email or nickname of a login as it is
+// looked up and counted
+func NormalizeLoginIdentifier(identifier string) string {
+	return tools.ToLower(strings.TrimSpace(identifier))
+}
+
+// LoginRetryAfter is how long until a login is tried again for any of the
+// subjects, 0 when none of them is blocked at now
+func (S *Server) LoginRetryAfter(subjects []LoginSubject, now time.Time) (time.Duration, error) {
+	var wait time.Duration
+	for _, s := range subjects {
+		var until time.Time
+		err := S.db.QueryRow(`
+			SELECT blocked_until FROM login_attempts
+			WHERE scope = ? AND subject = ? AND blocked_until > ?`,
+			s.Scope, s.Subject, S.db.Timestamp(now)).Scan(&until)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		wait = max(wait, until.Sub(now))
+	}
+	return wait, nil
+}
+
+// RecordLoginFailure counts a failed login at now for every subject and blocks
+// them as the limits say. It reports whether this failure locked the account.
+func (S *Server) RecordLoginFailure(subjects []LoginSubject, now time.Time) (bool, error) {
+	locked := false
+	for _, s := range subjects {
+		// a streak older than the window starts over
+		var failures int
+		err := S.db.QueryRow(`
+			INSERT INTO login_attempts (scope, subject, failures, last_failure_at) VALUES (?, ?, 1, ?)
+			ON CONFLICT (scope, subject) DO UPDATE SET
+				failures = CASE WHEN login_attempts.last_failure_at > ? THEN login_attempts.failures + 1 ELSE 1 END,
+				last_failure_at = excluded.last_failure_at
+			RETURNING failures`,
+			s.Scope, s.Subject, S.db.Timestamp(now), S.db.Timestamp(now.Add(-S.loginLimits.Window))).Scan(&failures)
+		if err != nil {
+			return false, err
+		}
+
+		policy := S.loginLimits.policy(s.Scope)
+		var blockedUntil any
+		if block := S.loginLimits.BlockFor(policy, failures); block > 0 {
+			blockedUntil = S.db.Timestamp(now.Add(block))
+		}
+		if _, err := S.db.Exec(`UPDATE login_attempts SET blocked_until = ? WHERE scope = ? AND subject = ?`,
+			blockedUntil, s.Scope, s.Subject); err != nil {
+			return false, err
+		}
+		if s.Scope == loginScopeAccount && failures == policy.MaxFailures {
+			locked = true
+		}
+	}
+	return locked, nil
+}
+
+// ClearLoginFailures forgets the failures of an account after it signed in.
+// The IP counter is kept so one working password doesn't reset it.
+func (S *Server) ClearLoginFailures(userID int) error {
+	_, err := S.db.Exec(`DELETE FROM login_attempts WHERE scope = ? AND subject = ?`,
+		loginScopeAccount, strconv.Itoa(userID))
+	return err
+}
+
+// PruneLoginAttempts deletes the counters that are neither blocking nor
+// remembered at now anymore
+func (S *Server) PruneLoginAttempts(now time.Time) error {
+	_, err := S.db.Exec(`
+		DELETE FROM login_attempts
+		WHERE last_failure_at <= ? AND (blocked_until IS NULL OR blocked_until <= ?)`,
+		S.db.Timestamp(now.Add(-S.loginLimits.Window)), S.db.Timestamp(now))
+	return err
+}
+
+// FailLogin records a failed login for subjects and answers it. When the
+// failure locks the account its owner is told by email.
+func (S *Server) FailLogin(w http.ResponseWriter, subjects []LoginSubject, userID int, message string) {
+	locked, err := S.RecordLoginFailure(subjects, S.loginLimits.Now())
+	if err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if locked {
+		if err := S.SendLockoutEmail(userID); err != nil {
+			log.Printf("Error sending lockout email: %v", err)
+		}
+	}
+	tools.SendJSONError(w, message, http.StatusUnauthorized)
+}
+
+// RejectBlockedLogin answers with 429 when a login for subjects is held back
+// and reports whether it did
+func (S *Server) RejectBlockedLogin(w http.ResponseWriter, subjects []LoginSubject) bool {
+	retryAfter, err := S.LoginRetryAfter(subjects, S.loginLimits.Now())
+	if err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return true
+	}
+	if retryAfter <= 0 {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	tools.SendJSONError(w, "Too many failed attempts, please try again later", http.StatusTooManyRequests)
+	return true
+}
+
+// SendLockoutEmail tells the user their account was locked after too many
+// failed logins
+func (S *Server) SendLockoutEmail(userID int) error {
+	var email, name string
+	if err := S.db.QueryRow(`SELECT email, first_name FROM users WHERE id = ?`, userID).Scan(&email, &name); err != nil {
+		return err
+	}
+	return S.QueueEmail(email, "account_locked", map[string]any{
+		"Name":      name,
+		"Failures":  S.loginLimits.Account.MaxFailures,
+		"LockedFor": humanDuration(S.loginLimits.Lockout),
+		"ResetLink": AppURL() + "/auth",
+	})
+}
+
+// humanDuration writes d as "15 minutes" or "2 hours" for emails
+func humanDuration(d time.Duration) string {
+	unit, n := "minute", int(d.Round(time.Minute)/time.Minute)
+	if d < time.Minute {
+		unit, n = "second", int(d.Round(time.Second)/time.Second)
+	} else if n >= 60 && n%60 == 0 {
+		unit, n = "hour", n/60
+	}
+	if n != 1 {
+		unit += "s"
+	}
+	return fmt.Sprintf("%d %s", n, unit)
+}
@@ -0,0 +1,166 @@
+package backend
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testClock is a clock that only moves when told to
+type testClock struct{ now time.Time }
+
+func (c *testClock) Now() time.Time          { return c.now }
+func (c *testClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+// newLimitedServer returns a test server whose login limiter runs on clock. An
+// account gets 3 free failures and is locked out at the 7th.
+func newLimitedServer(t *testing.T) (*Server, *testClock) {
+	t.Helper()
+	S := newTestServer(t)
+	clock := &testClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+	S.loginLimits = LoginLimits{
+		Account:   LoginPolicy{FreeFailures: 3, MaxFailures: 7},
+		IP:        LoginPolicy{FreeFailures: 20, MaxFailures: 100},
+		BaseDelay: time.Second,
+		MaxDelay:  time.Minute,
+		Lockout:   15 * time.Minute,
+		Window:    24 * time.Hour,
+		now:       clock.Now,
+	}
+	return S, clock
+}
+
+// login tries identifier and password and returns the status code and the
+// Retry-After header
+func login(t *testing.T, S *Server, identifier, password string) (int, string) {
+	t.Helper()
+	rec := do(t, S, nil, http.MethodPost, "/api/login", LoginUser{Identifier: identifier, Password: password})
+	return rec.Code, rec.Header().Get("Retry-After")
+}
+
+// failLogins makes n failed logins that must all be answered with 401
+func failLogins(t *testing.T, S *Server, identifier string, n int) {
+	t.Helper()
+	for i := 1; i <= n; i++ {
+		if code, _ := login(t, S, identifier, "wrong"); code != http.StatusUnauthorized {
+			t.Fatalf("failure %d: got %d, want %d", i, code, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestBlockFor(t *testing.T) {
+	l := LoginLimits{BaseDelay: time.Second, MaxDelay: 5 * time.Second, Lockout: time.Hour}
+	p := LoginPolicy{FreeFailures: 2, MaxFailures: 8}
+	want := []time.Duration{0, 0, 0, time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second, time.Hour, time.Hour}
+	for failures, d := range want {
+		if got := l.BlockFor(p, failures); got != d {
+			t.Errorf("BlockFor(%d) = %v, want %v", failures, got, d)
+		}
+	}
+	if got := l.BlockFor(LoginPolicy{FreeFailures: 2}, 100); got != 5*time.Second {
+		t.Errorf("BlockFor without MaxFailures = %v, want the max delay", got)
+	}
+}
+
+func TestLoginBackoffAndLockout(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		identifier string
+		known      bool
+	}{
+		{"existing account", "Alice@Example.com", true},
+		// an unknown name must be answered exactly like an existing account
+		{"unknown account", "nobody@example.com", false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			S, clock := newLimitedServer(t)
+			createTestUser(t, S, "alice", false)
+
+			failLogins(t, S, tt.identifier, 3)
+
+			// past the free failures the wait doubles, even the right
+			// password is turned away until it's over
+			for i, wait := range []int{1, 2, 4} {
+				failLogins(t, S, tt.identifier, 1)
+				code, retryAfter := login(t, S, tt.identifier, "pass1234")
+				if code != http.StatusTooManyRequests || retryAfter != strconv.Itoa(wait) {
+					t.Fatalf("after failure %d: got %d Retry-After %q, want %d Retry-After %d",
+						4+i, code, retryAfter, http.StatusTooManyRequests, wait)
+				}
+				clock.Advance(time.Duration(wait)*time.Second - time.Millisecond)
+				if code, _ := login(t, S, tt.identifier, "pass1234"); code != http.StatusTooManyRequests {
+					t.Fatalf("just before the wait after failure %d ends: got %d, want %d", 4+i, code, http.StatusTooManyRequests)
+				}
+				clock.Advance(time.Millisecond)
+			}
+
+			// MaxFailures locks out for the whole lockout
+			failLogins(t, S, tt.identifier, 1)
+			code, retryAfter := login(t, S, tt.identifier, "pass1234")
+			if code != http.StatusTooManyRequests || retryAfter != "900" {
+				t.Fatalf("after lockout: got %d Retry-After %q, want %d Retry-After 900", code, retryAfter, http.StatusTooManyRequests)
+			}
+			clock.Advance(14 * time.Minute)
+			if code, retryAfter := login(t, S, tt.identifier, "pass1234"); code != http.StatusTooManyRequests || retryAfter != "60" {
+				t.Fatalf("near the end of the lockout: got %d Retry-After %q, want %d Retry-After 60", code, retryAfter, http.StatusTooManyRequests)
+			}
+
+			wantEmails, wantCode := 0, http.StatusUnauthorized
+			if tt.known {
+				wantEmails, wantCode = 1, http.StatusOK
+			}
+			if n := count(t, S, `SELECT COUNT(*) FROM email_outbox WHERE subject LIKE '%locked%'`); n != wantEmails {
+				t.Errorf("%d lockout emails, want %d", n, wantEmails)
+			}
+			clock.Advance(time.Minute)
+			if code, _ := login(t, S, tt.identifier, "pass1234"); code != wantCode {
+				t.Errorf("after the lockout: got %d, want %d", code, wantCode)
+			}
+		})
+	}
+}
+
+func TestLoginFailuresOutsideWindowReset(t *testing.T) {
+	S, clock := newLimitedServer(t)
+	createTestUser(t, S, "alice", false)
+
+	failLogins(t, S, "alice@example.com", 3)
+	clock.Advance(S.loginLimits.Window + time.Second)
+
+	// the old streak is forgotten, so these are free again
+	failLogins(t, S, "alice@example.com", 3)
+	if n := count(t, S, `SELECT failures FROM login_attempts WHERE scope = ?`, loginScopeAccount); n != 3 {
+		t.Errorf("account failures = %d, want 3", n)
+	}
+
+	// the streak inside the window still counts
+	failLogins(t, S, "alice@example.com", 1)
+	if code, _ := login(t, S, "alice@example.com", "pass1234"); code != http.StatusTooManyRequests {
+		t.Errorf("after 4 failures in the window: got %d, want %d", code, http.StatusTooManyRequests)
+	}
+}
+
+func TestLoginSuccessClearsAccountButNotIP(t *testing.T) {
+	S, _ := newLimitedServer(t)
+	alice := createTestUser(t, S, "alice", false)
+
+	failLogins(t, S, "alice@example.com", 3)
+	if code, _ := login(t, S, "alice", "pass1234"); code != http.StatusOK {
+		t.Fatalf("login by nickname: got %d, want %d", code, http.StatusOK)
+	}
+
+	if n := count(t, S, `SELECT COUNT(*) FROM login_attempts WHERE scope = ? AND subject = ?`,
+		loginScopeAccount, strconv.Itoa(alice.ID)); n != 0 {
+		t.Errorf("%d account counters left, want 0", n)
+	}
+	if n := count(t, S, `SELECT failures FROM login_attempts WHERE scope = ?`, loginScopeIP); n != 3 {
+		t.Errorf("IP failures = %d, want 3", n)
+	}
+
+	// the account starts over with its free failures
+	failLogins(t, S, "alice@example.com", 3)
+	if code, _ := login(t, S, "alice@example.com", "pass1234"); code != http.StatusOK {
+		t.Errorf("after 3 new failures: got %d, want %d", code, http.StatusOK)
+	}
+}
@@ -0,0 +1,286 @@
+package backend
+
+import (
+	"SOCIAL-NETWORK/pkg/mailer"
+	"database/sql"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	outboxPollInterval = 30 * time.Second
+	outboxBatchSize    = 20
+	// a message is given up on after this many failed sends
+	maxOutboxAttempts = 8
+	// the first retry waits this long, every next one twice as long
+	outboxRetryBase = time.Minute
+	// sent and given up emails are kept this long for last_error and sent_at
+	outboxRetention = 7 * 24 * time.Hour
+
+	defaultDigestInterval = 24 * time.Hour
+	defaultAppURL         = "http://localhost:3000"
+)
+
+// AppURL is the frontend address used in links sent by email, from APP_URL
+func AppURL() string {
+	if v := os.Getenv("APP_URL"); v != "" {
+		return strings.TrimSuffix(v, "/")
+	}
+	return defaultAppURL
+}
+
+// QueueEmail renders the named template with data and stores it in the outbox
+// for DeliverOutboxLoop to send
+func (S *Server) QueueEmail(to, template string, data any) error {
+	msg, err := mailer.Render(template, data)
+	if err != nil {
+		return err
+	}
+	if _, err := S.db.Exec(`
+		INSERT INTO email_outbox (to_address, subject, text_body, html_body) VALUES (?, ?, ?, ?)`,
+		to, msg.Subject, msg.Text, msg.HTML); err != nil {
+		return err
+	}
+
+	// wake the delivery loop without waiting for it
+	select {
+	case S.outboxWake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// DeliverOutboxLoop sends queued emails as they come in and retries failed
+// ones every outboxPollInterval. It never returns.
+func (S *Server) DeliverOutboxLoop() {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+	for {
+		if err := S.DeliverOutbox(); err != nil {
+			log.Printf("Error delivering emails: %v", err)
+		}
+		if err := S.PruneOutbox(time.Now()); err != nil {
+			log.Printf("Error pruning emails: %v", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-S.outboxWake:
+		}
+	}
+}
+
+// DeliverOutbox sends the emails that are due. A failed send is retried later
+// with exponential backoff, up to maxOutboxAttempts times. The bodies hold
+// live reset and verification links, so they are blanked as soon as the
+// email is sent or given up on.
+func (S *Server) DeliverOutbox() error {
+	now := time.Now()
+	rows, err := S.db.Query(`
+		SELECT id, to_address, subject, text_body, html_body, attempts FROM email_outbox
+		WHERE sent_at IS NULL AND attempts < ? AND next_attempt_at <= ?
+		ORDER BY id LIMIT ?`, maxOutboxAttempts, S.db.Timestamp(now), outboxBatchSize)
+	if err != nil {
+		return err
+	}
+
+	type pending struct {
+		id       int
+		attempts int
+		msg      mailer.Message
+	}
+	var due []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.msg.To, &p.msg.Subject, &p.msg.Text, &p.msg.HTML, &p.attempts); err != nil {
+			rows.Close()
+			return err
+		}
+		due = append(due, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, p := range due {
+		if sendErr := S.mailer.Send(p.msg); sendErr != nil {
+			retryAt := now.Add(outboxRetryBase << p.attempts)
+			log.Printf("Error sending email %d to %s (attempt %d): %v", p.id, p.msg.To, p.attempts+1, sendErr)
+			if _, err := S.db.Exec(`
+				UPDATE email_outbox SET attempts = attempts + 1, last_error = ?, next_attempt_at = ?,
+					text_body = CASE WHEN attempts + 1 < ? THEN text_body ELSE '' END,
+					html_body = CASE WHEN attempts + 1 < ? THEN html_body ELSE '' END
+				WHERE id = ?`, sendErr.Error(), S.db.Timestamp(retryAt), maxOutboxAttempts, maxOutboxAttempts, p.id); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := S.db.Exec(`
+			UPDATE email_outbox SET attempts = attempts + 1, last_error = NULL, sent_at = ?, text_body = '', html_body = ''
+			WHERE id = ?`, S.db.Timestamp(time.Now()), p.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PruneOutbox deletes the emails sent or given up on more than
+// outboxRetention before now
+func (S *Server) PruneOutbox(now time.Time) error {
+	_, err := S.db.Exec(`
+		DELETE FROM email_outbox WHERE (sent_at IS NOT NULL OR attempts >= ?) AND created_at < ?`,
+		maxOutboxAttempts, S.db.Timestamp(now.Add(-outboxRetention)))
+	return err
+}
+
+// DigestInterval reads NOTIFICATION_DIGEST_INTERVAL (a duration like "24h").
+// Zero or a negative value turns the email digest off.
+func DigestInterval() time.Duration {
+	v := os.Getenv("NOTIFICATION_DIGEST_INTERVAL")
+	if v == "" {
+		return defaultDigestInterval
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("Invalid NOTIFICATION_DIGEST_INTERVAL %q, using %s", v, defaultDigestInterval)
+		return defaultDigestInterval
+	}
+	return d
+}
+
+// NotificationDigestLoop queues a digest email for every user who turned on
+// email digests, once per interval. It never returns.
+func (S *Server) NotificationDigestLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := S.SendNotificationDigests(interval); err != nil {
+			log.Printf("Error sending notification digests: %v", err)
+		}
+	}
+}
+
+// digestEntry is one line of the digest email
+type digestEntry struct {
+	Actor   string
+	Others  int
+	Content string
+}
+
+// SendNotificationDigests queues one email per user with the unread
+// notifications they allowed on the email digest channel since their last
+// digest (or the last interval for a first digest).
+func (S *Server) SendNotificationDigests(interval time.Duration) error {
+	now := time.Now()
+	rows, err := S.db.Query(`
+		SELECT u.id, u.email, u.first_name, nd.last_sent_at
+		FROM users u
+		LEFT JOIN notification_digests nd ON nd.user_id = u.id
+		WHERE EXISTS(SELECT 1 FROM notification_settings ns WHERE ns.user_id = u.id AND ns.email_digest = TRUE)`)
+	if err != nil {
+		return err
+	}
+
+	type recipient struct {
+		id       int
+		email    string
+		name     string
+		lastSent sql.NullTime
+	}
+	var recipients []recipient
+	for rows.Next() {
+		var r recipient
+		if err := rows.Scan(&r.id, &r.email, &r.name, &r.lastSent); err != nil {
+			rows.Close()
+			return err
+		}
+		recipients = append(recipients, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, r := range recipients {
+		since := now.Add(-interval)
+		if r.lastSent.Valid {
+			since = r.lastSent.Time
+		}
+		entries, err := S.DigestEntries(r.id, since)
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			if err := S.QueueEmail(r.email, "notification_digest", map[string]any{
+				"Name":          r.name,
+				"Notifications": entries,
+				"Link":          AppURL() + "/notifications",
+			}); err != nil {
+				return err
+			}
+		}
+		if _, err := S.db.Exec(`
+			INSERT INTO notification_digests (user_id, last_sent_at) VALUES (?, ?)
+			ON CONFLICT (user_id) DO UPDATE SET last_sent_at = excluded.last_sent_at`,
+			r.id, S.db.Timestamp(now)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DigestEntries lists userID's unread notifications since `since` that may go
+// out on the email digest channel
+func (S *Server) DigestEntries(userID int, since time.Time) ([]digestEntry, error) {
+	rows, err := S.db.Query(`
+		SELECT n.type, n.content, n.actor_id,
+		       COALESCE(n.post_id, 0), COALESCE(n.group_id, 0),
+		       u.first_name, u.last_name,
+		       (SELECT COUNT(*) FROM notification_actors na WHERE na.notification_id = n.id)
+		FROM notifications n
+		JOIN users u ON u.id = n.actor_id
+		WHERE n.user_id = ? AND n.is_read = FALSE AND n.created_at > ?
+		ORDER BY n.created_at DESC, n.id DESC`, userID, S.db.Timestamp(since))
+	if err != nil {
+		return nil, err
+	}
+
+	type row struct {
+		notif  Notification
+		actors int
+	}
+	var found []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.notif.Type, &r.notif.Content, &r.notif.ActorID, &r.notif.PostID, &r.notif.GroupID,
+			&r.notif.FirstName, &r.notif.LastName, &r.actors); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		r.notif.ID = userID
+		found = append(found, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var entries []digestEntry
+	for _, r := range found {
+		allowed, err := S.NotificationAllowed(r.notif, ChannelEmailDigest)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			continue
+		}
+		entries = append(entries, digestEntry{
+			Actor:   r.notif.FirstName + " " + r.notif.LastName,
+			Others:  max(r.actors-1, 0),
+			Content: strings.ToLower(r.notif.Content),
+		})
+	}
+	return entries, nil
+}
@@ -0,0 +1,204 @@
+package backend
+
+import (
+	"SOCIAL-NETWORK/pkg/mailer"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// outboxEmail is the state of one email_outbox row
+type outboxEmail struct {
+	attempts    int
+	lastError   sql.NullString
+	nextAttempt time.Time
+	sent        bool
+}
+
+func readOutbox(t *testing.T, S *Server, id int) outboxEmail {
+	t.Helper()
+	var e outboxEmail
+	if err := S.db.QueryRow(`SELECT attempts, last_error, next_attempt_at, sent_at IS NOT NULL FROM email_outbox WHERE id = ?`,
+		id).Scan(&e.attempts, &e.lastError, &e.nextAttempt, &e.sent); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// makeDue moves every unsent email's next attempt into the past, as if the
+// backoff had run out
+func makeDue(t *testing.T, S *Server) {
+	t.Helper()
+	if _, err := S.db.Exec(`UPDATE email_outbox SET next_attempt_at = ? WHERE sent_at IS NULL`,
+		S.db.Timestamp(time.Now().Add(-time.Second))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeliverOutboxRetries(t *testing.T) {
+	S := newTestServer(t)
+	dir := t.TempDir()
+	// the sink can't create its directory under a file, so every send fails
+	blocker := filepath.Join(dir, "blocker")
+	if err := os.WriteFile(blocker, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mailDir := filepath.Join(blocker, "mail")
+	S.mailer = &mailer.DirMailer{Dir: mailDir, From: "Social Network <no-reply@example.com>"}
+
+	if err := S.QueueEmail("alice@example.com", "password_reset", map[string]any{
+		"Name": "Alice", "Link": "http://localhost/reset", "ExpiresIn": "1 hour",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var id int
+	if err := S.db.QueryRow(`SELECT id FROM email_outbox`).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	// one that has used up its attempts
+	if _, err := S.db.Exec(`INSERT INTO email_outbox (to_address, subject, text_body, html_body, attempts) VALUES ('bob@example.com', 'old', 'old', 'old', ?)`,
+		maxOutboxAttempts); err != nil {
+		t.Fatal(err)
+	}
+
+	// each failure waits twice as long as the one before
+	for attempt := 1; attempt <= 3; attempt++ {
+		before := time.Now().Truncate(time.Second)
+		if err := S.DeliverOutbox(); err != nil {
+			t.Fatal(err)
+		}
+		e := readOutbox(t, S, id)
+		wait := outboxRetryBase << (attempt - 1)
+		if e.attempts != attempt || e.sent || !e.lastError.Valid {
+			t.Fatalf("after failure %d: %+v", attempt, e)
+		}
+		if e.nextAttempt.Before(before.Add(wait)) || e.nextAttempt.After(time.Now().Add(wait)) {
+			t.Errorf("after failure %d: next attempt at %v, want %v from now", attempt, e.nextAttempt, wait)
+		}
+
+		// nothing is tried again before then
+		if err := S.DeliverOutbox(); err != nil {
+			t.Fatal(err)
+		}
+		if e := readOutbox(t, S, id); e.attempts != attempt {
+			t.Fatalf("retried before the backoff ran out: %d attempts", e.attempts)
+		}
+		makeDue(t, S)
+	}
+
+	// the sink works again
+	S.mailer.(*mailer.DirMailer).Dir = filepath.Join(dir, "mail")
+	if err := S.DeliverOutbox(); err != nil {
+		t.Fatal(err)
+	}
+	if e := readOutbox(t, S, id); e.attempts != 4 || !e.sent || e.lastError.Valid {
+		t.Fatalf("after the send: %+v", e)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "mail", "*.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("%d emails written, want 1 (%v)", len(files), err)
+	}
+	raw, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"To: alice@example.com", "Subject: Reset your password", "http://localhost/reset"} {
+		if !strings.Contains(string(raw), want) {
+			t.Errorf("email has no %q:\n%s", want, raw)
+		}
+	}
+	if e := readOutbox(t, S, id+1); e.attempts != maxOutboxAttempts || e.sent {
+		t.Errorf("email past its attempts: %+v", e)
+	}
+}
+
+// outboxHolds reports whether the stored bodies of email id contain s
+func outboxHolds(t *testing.T, S *Server, id int, s string) bool {
+	t.Helper()
+	var text, html string
+	if err := S.db.QueryRow(`SELECT text_body, html_body FROM email_outbox WHERE id = ?`, id).Scan(&text, &html); err != nil {
+		t.Fatal(err)
+	}
+	return strings.Contains(text, s) || strings.Contains(html, s)
+}
+
+func TestOutboxForgetsLinks(t *testing.T) {
+	S := newTestServer(t)
+	dir := t.TempDir()
+	S.mailer = &mailer.DirMailer{Dir: filepath.Join(dir, "mail"), From: "Social Network <no-reply@example.com>"}
+
+	const link = "http://localhost/reset?token=secret"
+	queue := func() int {
+		t.Helper()
+		if err := S.QueueEmail("alice@example.com", "password_reset", map[string]any{
+			"Name": "Alice", "Link": link, "ExpiresIn": "1 hour",
+		}); err != nil {
+			t.Fatal(err)
+		}
+		var id int
+		if err := S.db.QueryRow(`SELECT MAX(id) FROM email_outbox`).Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	sent := queue()
+	if !outboxHolds(t, S, sent, link) {
+		t.Fatal("queued email has no link")
+	}
+	if err := S.DeliverOutbox(); err != nil {
+		t.Fatal(err)
+	}
+	if e := readOutbox(t, S, sent); !e.sent {
+		t.Fatalf("not sent: %+v", e)
+	}
+	if outboxHolds(t, S, sent, link) {
+		t.Error("sent email still holds the link")
+	}
+
+	// the last failed attempt gives up and forgets the link too
+	blocker := filepath.Join(dir, "blocker")
+	if err := os.WriteFile(blocker, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	S.mailer.(*mailer.DirMailer).Dir = filepath.Join(blocker, "mail")
+	failed := queue()
+	if _, err := S.db.Exec(`UPDATE email_outbox SET attempts = ? WHERE id = ?`, maxOutboxAttempts-2, failed); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.DeliverOutbox(); err != nil {
+		t.Fatal(err)
+	}
+	if !outboxHolds(t, S, failed, link) {
+		t.Error("email forgot its link before its last attempt")
+	}
+	makeDue(t, S)
+	if err := S.DeliverOutbox(); err != nil {
+		t.Fatal(err)
+	}
+	if e := readOutbox(t, S, failed); e.attempts != maxOutboxAttempts || outboxHolds(t, S, failed, link) {
+		t.Errorf("given up email: %+v, link kept %v", e, outboxHolds(t, S, failed, link))
+	}
+
+	// both go once they are old, a pending one stays
+	pending := queue()
+	if err := S.PruneOutbox(time.Now().Add(outboxRetention - time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(t, S, `SELECT COUNT(*) FROM email_outbox`); n != 3 {
+		t.Errorf("%d emails left before they are old, want 3", n)
+	}
+	if err := S.PruneOutbox(time.Now().Add(outboxRetention + time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(t, S, `SELECT COUNT(*) FROM email_outbox WHERE id <> ?`, pending); n != 0 {
+		t.Errorf("%d old emails left", n)
+	}
+	if n := count(t, S, `SELECT COUNT(*) FROM email_outbox WHERE id = ?`, pending); n != 1 {
+		t.Error("pruned an email still waiting to go out")
+	}
+}
@@ -19,11 +19,7 @@ func (S *Server) GetUsersHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	currentUserID, _, err := S.CheckSession(r)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
+	currentUserID, _ := CurrentUser(r)
 
 	chats, err := S.GetUsers(w, currentUserID)
 	if err != nil {
@@ -42,11 +38,7 @@ func (S *Server) GetUserProfileHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	currentUserID, _, err := S.CheckSession(r)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
+	currentUserID, _ := CurrentUser(r)
 
 	chatid := r.URL.Path[len("/api/get-users/profile/"):]
 
@@ -66,11 +58,7 @@ func (S *Server) MakeChatHandler(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/404", http.StatusSeeOther)
 		return
 	}
-	currentUserID, _, err := S.CheckSession(r)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
+	currentUserID, _ := CurrentUser(r)
 	otherUserID := r.URL.Path[len("/api/make-message/"):]
 
 	if !S.FoundChat(currentUserID, tools.StringToInt(otherUserID)) {
@@ -112,14 +100,10 @@ func (S *Server) SendMessageHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ChatID := r.URL.Path[len("/api/send-message/"):]
-	currentUserID, SessionID, err := S.CheckSession(r)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
+	currentUserID, SessionID := CurrentUser(r)
 
 	var message Message
-	err = json.NewDecoder(r.Body).Decode(&message)
+	err := json.NewDecoder(r.Body).Decode(&message)
 	if err != nil {
 		fmt.Println("send encode error : ", err)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
@@ -172,11 +156,7 @@ func (S *Server) GetMessagesHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	chatID := r.URL.Path[len("/api/get-messages/"):]
-	currentUserID, _, err := S.CheckSession(r)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
+	currentUserID, _ := CurrentUser(r)
 
 	messages, err := S.GetMessages(currentUserID, chatID)
 	if err != nil {
@@ -299,7 +279,7 @@ cte_ordered_users AS (
         	SELECT COUNT(*) 
         	FROM messages 
         	WHERE chat_id = lm.chat_id
-        	  AND is_read = 0
+        	  AND is_read = FALSE
         	  AND sender_id != ?
         ) AS unread_count
     FROM latest_messages lm
@@ -449,12 +429,8 @@ func (S *Server) SeenMessageHandler(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
-	currentUserID, _, err := S.CheckSession(r)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-	err = S.SeenMessage(chatID, currentUserID)
+	currentUserID, _ := CurrentUser(r)
+	err := S.SeenMessage(chatID, currentUserID)
 	if err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
@@ -472,7 +448,7 @@ func (S *Server) SeenMessageHandler(w http.ResponseWriter, r *http.Request) {
 
 func (S *Server) SeenMessage(chatID string, userID int) error {
 	// if last message is seen return
-	_, err := S.db.Exec(`UPDATE messages SET is_read = 1, read_at = CURRENT_TIMESTAMP WHERE chat_id = ? AND sender_id != ? AND is_read = 0`, chatID, userID)
+	_, err := S.db.Exec(`UPDATE messages SET is_read = TRUE, read_at = CURRENT_TIMESTAMP WHERE chat_id = ? AND sender_id != ? AND is_read = FALSE`, chatID, userID)
 	if err != nil {
 		fmt.Println("Seen Message", err)
 		return err
@@ -522,12 +498,7 @@ func (S *Server) UnsendMessageHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	messageID := r.URL.Path[len("/api/unsend-message/"):]
-	currentUserID, sessionID, err := S.CheckSession(r)
-
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
+	currentUserID, sessionID := CurrentUser(r)
 	chatID, err := S.GetChatIDFromMessageID(messageID)
 	if err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
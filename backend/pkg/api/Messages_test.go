@@ -0,0 +1,36 @@
+package backend
+
+import "testing"
+
+func TestDeleteChatDeletesMessages(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, S *Server) {
+		alice := createTestUser(t, S, "alice", false)
+		bob := createTestUser(t, S, "bob", false)
+
+		var chat int
+		if err := S.db.QueryRow(`INSERT INTO chats (user1_id, user2_id) VALUES (?, ?) RETURNING id`,
+			alice.ID, bob.ID).Scan(&chat); err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range []struct {
+			id, replyTo any
+		}{{"m1", nil}, {"m2", "m1"}} {
+			if _, err := S.db.Exec(`INSERT INTO messages (id, chat_id, sender_id, content, type, reply_to) VALUES (?, ?, ?, 'hi', 'text', ?)`,
+				m.id, chat, alice.ID, m.replyTo); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// foreign keys are enforced
+		if _, err := S.db.Exec(`INSERT INTO messages (id, chat_id, sender_id, content, type) VALUES ('m3', ?, ?, 'hi', 'text')`,
+			chat+1, alice.ID); err == nil {
+			t.Error("message saved in a chat that doesn't exist")
+		}
+
+		if _, err := S.db.Exec(`DELETE FROM chats WHERE id = ?`, chat); err != nil {
+			t.Fatalf("delete chat: %v", err)
+		}
+		if n := count(t, S, `SELECT COUNT(*) FROM messages`); n != 0 {
+			t.Errorf("%d messages left with their chat gone", n)
+		}
+	})
+}
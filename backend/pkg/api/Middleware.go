@@ -0,0 +1,102 @@
+package backend
+
+import (
+	tools "SOCIAL-NETWORK/pkg"
+	"context"
+	"errors"
+	"net/http"
+)
+
+// AuthLevel tells the auth middleware how a route treats the session cookie
+// or API token
+type AuthLevel int
+
+const (
+	// Public routes never look at the session
+	Public AuthLevel = iota
+	// OptionalAuth routes get the user in the context when a valid session exists
+	OptionalAuth
+	// RequireAuth routes answer 401 when there is no valid session
+	RequireAuth
+	// RequireVerified routes are RequireAuth routes that also answer 403 until
+	// the user has verified their email address
+	RequireVerified
+)
+
+type contextKey int
+
+const (
+	userIDKey contextKey = iota
+	sessionIDKey
+)
+
+// handle registers a route behind the auth middleware. scopes are the API
+// token scopes that may call it; without any only sessions can.
+func (S *Server) handle(pattern string, level AuthLevel, handler http.HandlerFunc, scopes ...TokenScope) {
+	S.mux.Handle(pattern, S.WithAuth(level, scopes, handler))
+}
+
+// WithAuth resolves the session or API token once and stores the user ID and
+// session ID in the request context so handlers never have to call
+// CheckSession themselves. Requests made with a token have no session ID.
+func (S *Server) WithAuth(level AuthLevel, scopes []TokenScope, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if level == Public {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var userID int
+		var sessionID string
+		var err error
+		if token, ok := BearerToken(r); ok {
+			// a token that doesn't work is refused even where auth is optional
+			userID, err = S.CheckAccessToken(token, scopes)
+			switch {
+			case errors.Is(err, errInvalidAccessToken):
+				tools.SendJSONError(w, err.Error(), http.StatusUnauthorized)
+				return
+			case errors.Is(err, errAccessTokenScope):
+				tools.SendJSONError(w, err.Error(), http.StatusForbidden)
+				return
+			case err != nil:
+				http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+		} else {
+			userID, sessionID, err = S.CheckSession(r)
+		}
+		if err != nil {
+			if level >= RequireAuth {
+				tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if level == RequireVerified {
+			verified, err := S.IsEmailVerified(userID)
+			if err != nil {
+				http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if !verified {
+				tools.SendJSONError(w, "Please verify your email address first", http.StatusForbidden)
+				return
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), userIDKey, userID)
+		ctx = context.WithValue(ctx, sessionIDKey, sessionID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// CurrentUser returns the user ID and session ID attached by WithAuth.
+// The user ID is 0 when the request is anonymous.
+func CurrentUser(r *http.Request) (int, string) {
+	userID, _ := r.Context().Value(userIDKey).(int)
+	sessionID, _ := r.Context().Value(sessionIDKey).(string)
+	return userID, sessionID
+}
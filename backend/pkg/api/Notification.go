@@ -2,36 +2,96 @@ package backend
 
 import (
 	tools "SOCIAL-NETWORK/pkg"
+	"database/sql"
 	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// maxNotificationBatch caps how many IDs one mark-as-read/delete call can take
+const maxNotificationBatch = 200
+
+const (
+	// defaultNotificationRetention is how long read notifications are kept
+	// unless NOTIFICATION_RETENTION says otherwise
+	defaultNotificationRetention = 30 * 24 * time.Hour
+	notificationPruneInterval    = time.Hour
+	// actors listed on a grouped notification, the rest are only counted
+	notificationActorsPreview = 3
+)
+
+// notificationTargetSQL matches the notification with the same target,
+// treating a missing target as 0
+const notificationTargetSQL = `COALESCE(post_id, 0) = ? AND COALESCE(comment_id, 0) = ?
+	AND COALESCE(group_id, 0) = ? AND COALESCE(event_id, 0) = ?`
+
+// notificationGroupSQL is the conflict target of idx_notifications_group, the
+// unique index that keeps one notification per receiver, type and target
+const notificationGroupSQL = `(user_id, type, COALESCE(post_id, 0), COALESCE(comment_id, 0), COALESCE(group_id, 0), COALESCE(event_id, 0))
+	WHERE post_id IS NOT NULL OR comment_id IS NOT NULL OR group_id IS NOT NULL OR event_id IS NOT NULL`
+
+// NotificationActor is one of the users behind a grouped notification
+type NotificationActor struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Avatar string `json:"avatar"`
+}
+
+// GetNotificationsHandler returns the caller's notifications newest first, one
+// page at a time. ?cursor= is the nextCursor of the previous page and ?limit=
+// the page size.
 func (S *Server) GetNotificationsHandler(w http.ResponseWriter, r *http.Request) {
-	userID, _, err := S.CheckSession(r)
+	userID, _ := CurrentUser(r)
+
+	cursor, limit, err := ReadFeedPage(r)
 	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		tools.SendJSONError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	rows, err := S.db.QueryContext(r.Context(), `
+	query := `
 		SELECT n.id, n.type, n.content, n.is_read, n.created_at,
-		       u.id, u.first_name, u.last_name, u.avatar
+		       u.id, u.first_name, u.last_name, u.avatar,
+		       COALESCE(n.post_id, 0), COALESCE(n.comment_id, 0),
+		       COALESCE(n.group_id, 0), COALESCE(n.event_id, 0),
+		       (SELECT COUNT(*) FROM notification_actors na WHERE na.notification_id = n.id)
 		FROM notifications n
 		JOIN users u ON u.id = n.actor_id
-		WHERE n.user_id = ?
-		ORDER BY n.created_at DESC
-	`, userID)
+		WHERE n.user_id = ?`
+	args := []any{userID}
+	if cursor != nil {
+		at := S.db.Timestamp(cursor.CreatedAt)
+		query += ` AND (n.created_at < ? OR (n.created_at = ? AND n.id < ?))`
+		args = append(args, at, at, cursor.ID)
+	}
+	query += ` ORDER BY n.created_at DESC, n.id DESC LIMIT ?`
+	args = append(args, limit+1)
+
+	rows, err := S.db.QueryContext(r.Context(), query, args...)
 	if err != nil {
 		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 	defer rows.Close()
 
-	var notifs []map[string]interface{}
+	notifs := []map[string]interface{}{}
+	var last Notification
+	next := ""
 	for rows.Next() {
+		if len(notifs) == limit {
+			next = FeedCursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+			break
+		}
 		var notif Notification
+		var actorCount int
 		if err := rows.Scan(&notif.ID, &notif.Type, &notif.Content, &notif.IsRead, &notif.CreatedAt,
-			&notif.ActorID, &notif.FirstName, &notif.LastName, &notif.Avatar); err != nil {
+			&notif.ActorID, &notif.FirstName, &notif.LastName, &notif.Avatar,
+			&notif.PostID, &notif.CommentID, &notif.GroupID, &notif.EventID, &actorCount); err != nil {
 			http.Error(w, "Error scanning row: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -47,65 +107,387 @@ func (S *Server) GetNotificationsHandler(w http.ResponseWriter, r *http.Request)
 				"name":   notif.FirstName + " " + notif.LastName,
 				"avatar": notif.Avatar,
 			},
+			"actorCount": max(actorCount, 1),
+			"postId":     notif.PostID,
+			"commentId":  notif.CommentID,
+			"groupId":    notif.GroupID,
+			"eventId":    notif.EventID,
 		})
+		last = notif
+	}
+
+	if err := rows.Err(); err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rows.Close()
+
+	ids := make([]int, len(notifs))
+	for i, n := range notifs {
+		ids[i] = n["id"].(int)
+	}
+	actors, err := S.GetNotificationActors(ids)
+	if err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, n := range notifs {
+		n["actors"] = actors[n["id"].(int)]
+	}
+
+	unread, err := S.CountUnreadNotifications(userID)
+	if err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"notifications": notifs,
+		"nextCursor":    next,
+		"unreadCount":   unread,
+	})
+}
+
+// UnreadNotificationsCountHandler returns only the unread badge count
+func (S *Server) UnreadNotificationsCountHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := CurrentUser(r)
+
+	count, err := S.CountUnreadNotifications(userID)
+	if err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(notifs)
+	json.NewEncoder(w).Encode(map[string]int{"count": count})
 }
 
+func (S *Server) CountUnreadNotifications(userID int) (int, error) {
+	var count int
+	err := S.db.QueryRow(`SELECT COUNT(*) FROM notifications WHERE user_id = ? AND is_read = FALSE`, userID).Scan(&count)
+	return count, err
+}
+
+// NotificationRetention reads NOTIFICATION_RETENTION (a duration like "720h").
+// Zero or a negative value turns pruning off.
+func NotificationRetention() time.Duration {
+	v := os.Getenv("NOTIFICATION_RETENTION")
+	if v == "" {
+		return defaultNotificationRetention
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("Invalid NOTIFICATION_RETENTION %q, using %s", v, defaultNotificationRetention)
+		return defaultNotificationRetention
+	}
+	return d
+}
+
+// PruneNotificationsLoop deletes read notifications older than retention
+// every notificationPruneInterval. It never returns.
+func (S *Server) PruneNotificationsLoop(retention time.Duration) {
+	ticker := time.NewTicker(notificationPruneInterval)
+	defer ticker.Stop()
+	for {
+		n, err := S.PruneNotifications(time.Now().Add(-retention))
+		if err != nil {
+			log.Printf("Error pruning notifications: %v", err)
+		} else if n > 0 {
+			log.Printf("Pruned %d read notifications", n)
+		}
+		<-ticker.C
+	}
+}
+
+// PruneNotifications deletes read notifications created before olderThan,
+// along with actor rows left behind by any deleted notification
+func (S *Server) PruneNotifications(olderThan time.Time) (int64, error) {
+	res, err := S.db.Exec(`DELETE FROM notifications WHERE is_read = TRUE AND created_at < ?`, S.db.Timestamp(olderThan))
+	if err != nil {
+		return 0, err
+	}
+	if _, err := S.db.Exec(`
+		DELETE FROM notification_actors
+		WHERE NOT EXISTS (SELECT 1 FROM notifications n WHERE n.id = notification_actors.notification_id)`); err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// GetNotificationActors returns the latest actors of each notification,
+// newest first and at most notificationActorsPreview per notification
+func (S *Server) GetNotificationActors(ids []int) (map[int][]NotificationActor, error) {
+	actors := make(map[int][]NotificationActor, len(ids))
+	if len(ids) == 0 {
+		return actors, nil
+	}
+
+	args := make([]any, 0, len(ids)+1)
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	args = append(args, notificationActorsPreview)
+	rows, err := S.db.Query(`
+		SELECT notification_id, id, first_name, last_name, avatar FROM (
+			SELECT na.notification_id, u.id, u.first_name, u.last_name, u.avatar,
+			       ROW_NUMBER() OVER (PARTITION BY na.notification_id
+			                          ORDER BY na.created_at DESC, na.actor_id DESC) AS rn
+			FROM notification_actors na
+			JOIN users u ON u.id = na.actor_id
+			WHERE na.notification_id IN (`+Placeholders(len(ids))+`)
+		) ranked
+		WHERE rn <= ?
+		ORDER BY notification_id, rn`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var notificationID int
+		var actor NotificationActor
+		var firstName, lastName string
+		if err := rows.Scan(&notificationID, &actor.ID, &firstName, &lastName, &actor.Avatar); err != nil {
+			return nil, err
+		}
+		actor.Name = firstName + " " + lastName
+		actors[notificationID] = append(actors[notificationID], actor)
+	}
+	return actors, rows.Err()
+}
+
+// IsertNotification adds notif.ActorID to the receiver's notification of the
+// same type and target and moves it back to the top, or starts a new one.
+// Notifications without a target are never grouped. Nothing is stored when
+// the receiver turned the type off or muted the actor or target.
 func (S *Server) IsertNotification(notif Notification) error {
-	_, err := S.db.Exec(`
-		INSERT INTO notifications (user_id, actor_id, type, content, is_read)
-		VALUES (?, ?, ?, ?, ?)
-	`, notif.ID, notif.ActorID, notif.Type, notif.Content, notif.IsRead)
-	return err
+	if allowed, err := S.NotificationAllowed(notif, ChannelInApp); err != nil || !allowed {
+		return err
+	}
+
+	tx, err := S.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// the unique index on the target turns a second notification about it
+	// into an update, even when two actions race
+	var notificationID int
+	if err := tx.QueryRow(`
+		INSERT INTO notifications (user_id, actor_id, type, content, is_read, post_id, comment_id, group_id, event_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT `+notificationGroupSQL+`
+		DO UPDATE SET actor_id = excluded.actor_id, content = excluded.content, is_read = excluded.is_read,
+			created_at = CURRENT_TIMESTAMP
+		RETURNING id`,
+		notif.ID, notif.ActorID, notif.Type, notif.Content, notif.IsRead,
+		nullID(notif.PostID), nullID(notif.CommentID), nullID(notif.GroupID), nullID(notif.EventID),
+	).Scan(&notificationID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO notification_actors (notification_id, actor_id) VALUES (?, ?)
+		ON CONFLICT (notification_id, actor_id) DO UPDATE SET created_at = CURRENT_TIMESTAMP`,
+		notificationID, notif.ActorID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RemoveNotificationActor takes notif.ActorID out of the receiver's
+// notification of the same type and target, e.g. on an un-like. The
+// notification is deleted once nobody is left in it.
+func (S *Server) RemoveNotificationActor(notif Notification) error {
+	tx, err := S.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var notificationID int
+	err = tx.QueryRow(`SELECT id FROM notifications WHERE user_id = ? AND type = ? AND `+notificationTargetSQL,
+		notif.ID, notif.Type, notif.PostID, notif.CommentID, notif.GroupID, notif.EventID,
+	).Scan(&notificationID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM notification_actors WHERE notification_id = ? AND actor_id = ?`,
+		notificationID, notif.ActorID); err != nil {
+		return err
+	}
+
+	var latestActor int
+	err = tx.QueryRow(`
+		SELECT actor_id FROM notification_actors WHERE notification_id = ?
+		ORDER BY created_at DESC, actor_id DESC LIMIT 1`, notificationID).Scan(&latestActor)
+	switch {
+	case err == sql.ErrNoRows:
+		_, err = tx.Exec(`DELETE FROM notifications WHERE id = ?`, notificationID)
+	case err == nil:
+		_, err = tx.Exec(`UPDATE notifications SET actor_id = ? WHERE id = ?`, latestActor, notificationID)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// nullID stores a missing (0) id as NULL
+func nullID(id int) any {
+	if id == 0 {
+		return nil
+	}
+	return id
 }
 
+// MarkNotificationAsReadHandler marks the caller's notifications as read.
+// It takes one ID in the URL (/api/mark-notification-as-read/12) or a batch
+// in the body ({"ids": [12, 13]}) when the URL has no ID.
 func (S *Server) MarkNotificationAsReadHandler(w http.ResponseWriter, r *http.Request) {
-	notificationID := r.URL.Path[len("/api/mark-notification-as-read/"):]
-	_, err := S.db.Exec(`
-		UPDATE notifications
-		SET is_read = 1
-		WHERE id = ?
-	`, notificationID)
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUserID, _ := CurrentUser(r)
+	ids, err := ReadNotificationIDs(r, "/api/mark-notification-as-read/")
 	if err != nil {
-		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		tools.SendJSONError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	_, receiverID, err := S.GetSenderAndReceiverIDs(notificationID)
+	found, err := S.UpdateOwnNotifications(currentUserID, ids, `UPDATE notifications SET is_read = TRUE`)
 	if err != nil {
 		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if !found {
+		tools.SendJSONError(w, "Notification not found", http.StatusNotFound)
+		return
+	}
 
-	S.PushNotification("-read", tools.StringToInt(receiverID), Notification{})
+	S.PushNotification("-read", currentUserID, Notification{})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"ids": ids})
 }
 
+// DeleteNotificationHandler deletes the caller's notifications, by URL ID or
+// by a batch of IDs in the body like MarkNotificationAsReadHandler.
 func (S *Server) DeleteNotificationHandler(w http.ResponseWriter, r *http.Request) {
-	notificationID := r.URL.Path[len("/api/delete-notification/"):]
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
 
-	_, receiverID, err := S.GetSenderAndReceiverIDs(notificationID)
+	currentUserID, _ := CurrentUser(r)
+	ids, err := ReadNotificationIDs(r, "/api/delete-notification/")
 	if err != nil {
-		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		tools.SendJSONError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	_, err = S.db.Exec(`
-		DELETE FROM notifications
-		WHERE id = ?
-	`, notificationID)
+	found, err := S.UpdateOwnNotifications(currentUserID, ids, `DELETE FROM notifications`)
 	if err != nil {
 		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if !found {
+		tools.SendJSONError(w, "Notification not found", http.StatusNotFound)
+		return
+	}
 
-	S.PushNotification("-delete", tools.StringToInt(receiverID), Notification{})
+	S.PushNotification("-delete", currentUserID, Notification{})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"ids": ids})
+}
+
+// ReadNotificationIDs returns the notification ID from the URL after prefix,
+// or the "ids" list from the JSON body when the URL has none.
+func ReadNotificationIDs(r *http.Request, prefix string) ([]int, error) {
+	if id := strings.TrimPrefix(r.URL.Path, prefix); id != "" {
+		n, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid notification id")
+		}
+		return []int{n}, nil
+	}
+
+	var body struct {
+		IDs []int `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("invalid request body")
+	}
+	if len(body.IDs) == 0 {
+		return nil, fmt.Errorf("no notification ids")
+	}
+	if len(body.IDs) > maxNotificationBatch {
+		return nil, fmt.Errorf("too many notification ids")
+	}
+
+	// drop duplicates so the ownership count below stays exact
+	seen := make(map[int]bool, len(body.IDs))
+	ids := body.IDs[:0]
+	for _, id := range body.IDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// UpdateOwnNotifications runs stmt (an UPDATE or DELETE on notifications)
+// limited to ids that belong to userID. Nothing is changed and found is false
+// when any of the ids is missing or owned by someone else.
+func (S *Server) UpdateOwnNotifications(userID int, ids []int, stmt string) (bool, error) {
+	args := make([]interface{}, 0, len(ids)+1)
+	args = append(args, userID)
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	where := ` WHERE user_id = ? AND id IN (` + Placeholders(len(ids)) + `)`
+
+	tx, err := S.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var owned int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM notifications`+where, args...).Scan(&owned); err != nil {
+		return false, err
+	}
+	if owned != len(ids) {
+		return false, nil
+	}
+
+	if _, err := tx.Exec(stmt+where, args...); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
 }
 
 func (S *Server) DeleteNotification(senderID, resiverID, notificationType string) error {
 	_, err := S.db.Exec(`
+		DELETE FROM notification_actors
+		WHERE notification_id IN (
+			SELECT id FROM notifications WHERE actor_id = ? AND user_id = ? AND type = ?)
+	`, senderID, resiverID, notificationType)
+	if err != nil {
+		return err
+	}
+
+	_, err = S.db.Exec(`
 		DELETE FROM notifications
 		WHERE actor_id = ? AND user_id = ? AND type = ?
 	`, senderID, resiverID, notificationType)
@@ -113,12 +495,14 @@ func (S *Server) DeleteNotification(senderID, resiverID, notificationType string
 	return err
 }
 
+// GetSenderAndReceiverIDs returns who sent and who received the follow
+// request behind a follow_request notification
 func (S *Server) GetSenderAndReceiverIDs(notificationID string) (string, string, error) {
 	var senderID, receiverID int
 	err := S.db.QueryRow(`
 		SELECT actor_id, user_id
 		FROM notifications
-		WHERE id = ?
+		WHERE id = ? AND type = 'follow_request'
 	`, tools.StringToInt(notificationID)).Scan(&senderID, &receiverID)
 	if err != nil {
 		return "", "", err
@@ -128,14 +512,10 @@ func (S *Server) GetSenderAndReceiverIDs(notificationID string) (string, string,
 
 func (S *Server) MarkAllNotificationAsReadHandler(w http.ResponseWriter, r *http.Request) {
 
-	currentUserID, _, err := S.CheckSession(r)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-	_, err = S.db.Exec(`
+	currentUserID, _ := CurrentUser(r)
+	_, err := S.db.Exec(`
 		UPDATE notifications
-		SET is_read = 1
+		SET is_read = TRUE
 		WHERE user_id = ?
 	`, currentUserID)
 	if err != nil {
@@ -0,0 +1,291 @@
+package backend
+
+import (
+	tools "SOCIAL-NETWORK/pkg"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+// Channels a notification can be delivered on
+const (
+	ChannelInApp       = "in_app"
+	ChannelLive        = "live"
+	ChannelEmailDigest = "email_digest"
+)
+
+// notificationTypes are the types a user can configure
+var notificationTypes = []string{"like", "comment", "reply", "mention", "share", "follow", "follow_request",
+	"group_invite", "group_join_request", "group_event"}
+
+// muteTargets maps a mute target type to the table its id must exist in
+var muteTargets = map[string]string{
+	"user":  "users",
+	"post":  "posts",
+	"group": "groups",
+}
+
+// NotificationSetting is the per-channel choice for one notification type
+type NotificationSetting struct {
+	Type        string `json:"type"`
+	InApp       bool   `json:"inApp"`
+	Live        bool   `json:"live"`
+	EmailDigest bool   `json:"emailDigest"`
+}
+
+// NotificationSettingUpdate is a partial update, nil fields are left as they are
+type NotificationSettingUpdate struct {
+	Type        string `json:"type"`
+	InApp       *bool  `json:"inApp"`
+	Live        *bool  `json:"live"`
+	EmailDigest *bool  `json:"emailDigest"`
+}
+
+// NotificationMute silences notifications from a user or about a post or group
+type NotificationMute struct {
+	Type string `json:"type"`
+	ID   int    `json:"id"`
+}
+
+func defaultNotificationSetting(notifType string) NotificationSetting {
+	return NotificationSetting{Type: notifType, InApp: true, Live: true}
+}
+
+// NotificationSettingsHandler returns the caller's settings for every type and
+// their mutes on GET, and applies a list of NotificationSettingUpdate on PATCH.
+func (S *Server) NotificationSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := CurrentUser(r)
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPatch, http.MethodPost:
+		var updates []NotificationSettingUpdate
+		if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
+			tools.SendJSONError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		for _, u := range updates {
+			if !slices.Contains(notificationTypes, u.Type) {
+				tools.SendJSONError(w, "Unknown notification type "+u.Type, http.StatusBadRequest)
+				return
+			}
+		}
+		if err := S.UpdateNotificationSettings(userID, updates); err != nil {
+			http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	settings, err := S.GetNotificationSettings(userID)
+	if err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	mutes, err := S.GetNotificationMutes(userID)
+	if err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"settings": settings,
+		"mutes":    mutes,
+	})
+}
+
+// NotificationMuteHandler mutes a target on POST and unmutes it on DELETE.
+// The body is a NotificationMute, e.g. {"type": "user", "id": 12}.
+func (S *Server) NotificationMuteHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, _ := CurrentUser(r)
+
+	var mute NotificationMute
+	if err := json.NewDecoder(r.Body).Decode(&mute); err != nil {
+		tools.SendJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	table, ok := muteTargets[mute.Type]
+	if !ok {
+		tools.SendJSONError(w, "Unknown mute type "+mute.Type, http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		if _, err := S.db.Exec(`DELETE FROM notification_mutes WHERE user_id = ? AND target_type = ? AND target_id = ?`,
+			userID, mute.Type, mute.ID); err != nil {
+			http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"muted": false})
+		return
+	}
+
+	if mute.Type == "user" && mute.ID == userID {
+		tools.SendJSONError(w, "You can't mute yourself", http.StatusBadRequest)
+		return
+	}
+	var exists bool
+	if err := S.db.QueryRow(fmt.Sprintf(`SELECT EXISTS(SELECT 1 FROM %s WHERE id = ?)`, table), mute.ID).Scan(&exists); err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		tools.SendJSONError(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	if _, err := S.db.Exec(`
+		INSERT INTO notification_mutes (user_id, target_type, target_id) VALUES (?, ?, ?)
+		ON CONFLICT DO NOTHING`, userID, mute.Type, mute.ID); err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"muted": true})
+}
+
+// GetNotificationSettings returns the settings of every configurable type,
+// filling in the defaults for types the user never changed
+func (S *Server) GetNotificationSettings(userID int) ([]NotificationSetting, error) {
+	rows, err := S.db.Query(`
+		SELECT type, in_app, live, email_digest FROM notification_settings WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stored := make(map[string]NotificationSetting)
+	for rows.Next() {
+		var s NotificationSetting
+		if err := rows.Scan(&s.Type, &s.InApp, &s.Live, &s.EmailDigest); err != nil {
+			return nil, err
+		}
+		stored[s.Type] = s
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	settings := make([]NotificationSetting, 0, len(notificationTypes))
+	for _, notifType := range notificationTypes {
+		s, ok := stored[notifType]
+		if !ok {
+			s = defaultNotificationSetting(notifType)
+		}
+		settings = append(settings, s)
+	}
+	return settings, nil
+}
+
+func (S *Server) GetNotificationSetting(userID int, notifType string) (NotificationSetting, error) {
+	s := NotificationSetting{Type: notifType}
+	err := S.db.QueryRow(`
+		SELECT in_app, live, email_digest FROM notification_settings WHERE user_id = ? AND type = ?`,
+		userID, notifType).Scan(&s.InApp, &s.Live, &s.EmailDigest)
+	if err == sql.ErrNoRows {
+		return defaultNotificationSetting(notifType), nil
+	}
+	return s, err
+}
+
+func (S *Server) UpdateNotificationSettings(userID int, updates []NotificationSettingUpdate) error {
+	tx, err := S.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, u := range updates {
+		s := defaultNotificationSetting(u.Type)
+		err := tx.QueryRow(`
+			SELECT in_app, live, email_digest FROM notification_settings WHERE user_id = ? AND type = ?`,
+			userID, u.Type).Scan(&s.InApp, &s.Live, &s.EmailDigest)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if u.InApp != nil {
+			s.InApp = *u.InApp
+		}
+		if u.Live != nil {
+			s.Live = *u.Live
+		}
+		if u.EmailDigest != nil {
+			s.EmailDigest = *u.EmailDigest
+		}
+
+		if _, err := tx.Exec(`
+			INSERT INTO notification_settings (user_id, type, in_app, live, email_digest) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (user_id, type) DO UPDATE
+			SET in_app = excluded.in_app, live = excluded.live, email_digest = excluded.email_digest`,
+			userID, u.Type, s.InApp, s.Live, s.EmailDigest); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (S *Server) GetNotificationMutes(userID int) ([]NotificationMute, error) {
+	rows, err := S.db.Query(`
+		SELECT target_type, target_id FROM notification_mutes WHERE user_id = ?
+		ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mutes := []NotificationMute{}
+	for rows.Next() {
+		var m NotificationMute
+		if err := rows.Scan(&m.Type, &m.ID); err != nil {
+			return nil, err
+		}
+		mutes = append(mutes, m)
+	}
+	return mutes, rows.Err()
+}
+
+// NotificationAllowed is the one place that decides whether notif reaches its
+// receiver (notif.ID) on channel: the type must be on for that channel and
+// neither the actor nor the post or group it is about may be muted. A post
+// in a group is muted with its group.
+func (S *Server) NotificationAllowed(notif Notification, channel string) (bool, error) {
+	setting, err := S.GetNotificationSetting(notif.ID, notif.Type)
+	if err != nil {
+		return false, err
+	}
+	switch channel {
+	case ChannelInApp:
+		if !setting.InApp {
+			return false, nil
+		}
+	case ChannelLive:
+		if !setting.Live {
+			return false, nil
+		}
+	case ChannelEmailDigest:
+		if !setting.EmailDigest {
+			return false, nil
+		}
+	}
+
+	var muted bool
+	err = S.db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM notification_mutes
+		WHERE user_id = ? AND (
+			(target_type = 'user' AND target_id = ?)
+			OR (target_type = 'post' AND target_id = ?)
+			OR (target_type = 'group' AND (target_id = ?
+				OR target_id = (SELECT group_id FROM posts WHERE id = ?)))))`,
+		notif.ID, notif.ActorID, notif.PostID, notif.GroupID, notif.PostID).Scan(&muted)
+	return !muted, err
+}
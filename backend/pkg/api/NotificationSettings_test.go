@@ -0,0 +1,88 @@
+package backend
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+// createGroup has user create a group and returns its id
+func createGroup(t *testing.T, S *Server, user testUser, title string) int {
+	t.Helper()
+	rec := do(t, S, &user, http.MethodPost, "/api/groups/create", map[string]string{"title": title})
+	var group Group
+	if err := json.NewDecoder(rec.Body).Decode(&group); err != nil || group.ID == 0 {
+		t.Fatalf("create group: got %d %s", rec.Code, rec.Body)
+	}
+	return group.ID
+}
+
+func TestGroupMuteSilencesGroupNotifications(t *testing.T) {
+	S := newTestServer(t)
+	alice := createTestUser(t, S, "alice", false)
+	bob := createTestUser(t, S, "bob", false)
+	carol := createTestUser(t, S, "carol", false)
+	dave := createTestUser(t, S, "dave", false)
+
+	group := createGroup(t, S, alice, "hikers")
+	if _, err := S.db.Exec(`INSERT INTO group_members (group_id, user_id) VALUES (?, ?)`, group, bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	post := createPost(t, S, alice, "/api/groups/posts/create", map[string]any{"content": "trail", "groupId": group})
+	outside := createPost(t, S, alice, "/api/create-post", map[string]any{"content": "not in a group", "privacy": "public"})
+
+	expect := func(steps []func() int, want map[string]int) {
+		t.Helper()
+		for i, step := range steps {
+			if code := step(); code != http.StatusOK {
+				t.Fatalf("step %d: got %d", i, code)
+			}
+		}
+		for notifType, n := range want {
+			if got := count(t, S, `SELECT COUNT(*) FROM notifications WHERE user_id = ? AND type = ?`, alice.ID, notifType); got != n {
+				t.Errorf("alice has %d %s notifications, want %d", got, notifType, n)
+			}
+		}
+	}
+	like := func(id int) func() int {
+		return func() int { return do(t, S, &bob, http.MethodPost, "/api/like/"+strconv.Itoa(id), nil).Code }
+	}
+	comment := func() int {
+		return do(t, S, &bob, http.MethodPost, "/api/create-comment", map[string]any{"postId": post, "content": "nice"}).Code
+	}
+	join := func(user testUser) func() int {
+		return func() int {
+			return do(t, S, &user, http.MethodPost, "/api/groups/join", map[string]int{"groupId": group}).Code
+		}
+	}
+	event := func() int {
+		return do(t, S, &bob, http.MethodPost, "/api/groups/events/create", map[string]any{
+			"groupId": group, "title": "walk", "eventDatetime": "2026-11-01T10:00:00Z",
+		}).Code
+	}
+
+	expect([]func() int{like(post), join(carol), event}, map[string]int{"like": 1, "group_join_request": 1, "group_event": 1})
+
+	if rec := do(t, S, &alice, http.MethodPost, "/api/notification-mutes", NotificationMute{Type: "group", ID: group}); rec.Code != http.StatusOK {
+		t.Fatalf("mute: got %d %s", rec.Code, rec.Body)
+	}
+	// start over so bob's next like is a new one
+	for _, table := range []string{"notifications", "likes"} {
+		if _, err := S.db.Exec(`DELETE FROM ` + table); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// activity on the group's posts is muted with the group, the rest isn't
+	expect([]func() int{like(post), comment, join(dave), event, like(outside)},
+		map[string]int{"like": 1, "comment": 0, "group_join_request": 0, "group_event": 0})
+
+	// the mute is only alice's, carol still gets invited
+	if rec := do(t, S, &bob, http.MethodPost, "/api/groups/invite", map[string]int{"groupId": group, "userId": carol.ID}); rec.Code != http.StatusOK {
+		t.Fatalf("invite: got %d %s", rec.Code, rec.Body)
+	}
+	if n := count(t, S, `SELECT COUNT(*) FROM notifications WHERE user_id = ? AND type = 'group_invite' AND group_id = ?`, carol.ID, group); n != 1 {
+		t.Errorf("carol has %d group invites, want 1", n)
+	}
+}
@@ -0,0 +1,52 @@
+package backend
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentNotificationsGroup(t *testing.T) {
+	S := newTestServer(t)
+	alice := createTestUser(t, S, "alice", false)
+	post := createPost(t, S, alice, "/api/create-post", map[string]any{"content": "hello", "privacy": "public"})
+	var actors []testUser
+	for i := range 8 {
+		actors = append(actors, createTestUser(t, S, "user"+strconv.Itoa(i), false))
+	}
+
+	// everyone likes the post at once, twice over
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*len(actors))
+	for range 2 {
+		for _, actor := range actors {
+			wg.Go(func() {
+				errs <- S.IsertNotification(Notification{ID: alice.ID, ActorID: actor.ID, Type: "like", Content: "Like Your Post", PostID: post})
+			})
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := count(t, S, `SELECT COUNT(*) FROM notifications WHERE user_id = ? AND type = 'like'`, alice.ID); n != 1 {
+		t.Fatalf("%d like notifications, want 1", n)
+	}
+	if n := count(t, S, `SELECT COUNT(*) FROM notification_actors`); n != len(actors) {
+		t.Errorf("%d actors, want %d", n, len(actors))
+	}
+
+	// notifications without a target are never grouped
+	for range 2 {
+		if err := S.IsertNotification(Notification{ID: alice.ID, ActorID: actors[0].ID, Type: "follow", Content: "Followed You"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := count(t, S, `SELECT COUNT(*) FROM notifications WHERE user_id = ? AND type = 'follow'`, alice.ID); n != 2 {
+		t.Errorf("%d follow notifications, want 2", n)
+	}
+}
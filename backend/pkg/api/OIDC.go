@@ -0,0 +1,411 @@
+package backend
+
+import (
+	tools "SOCIAL-NETWORK/pkg"
+	"SOCIAL-NETWORK/pkg/oidc"
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// an OIDC sign-in has this long to come back from the provider
+const oidcLoginTTL = 10 * time.Minute
+
+// oidcStateCookie holds the hash of the state of the sign-in the browser
+// started, so a callback only completes in the browser that asked for it
+const oidcStateCookie = "oidc_state"
+
+var (
+	errOIDCNoEmail    = errors.New("Your account at the provider has no email address")
+	errOIDCEmailTaken = errors.New("An account with this email already exists. Sign in with your password and link the provider from your account settings")
+	errOIDCLinked     = errors.New("This account at the provider is already linked to another user")
+)
+
+type OIDCIdentity struct {
+	ID          int        `json:"id"`
+	Issuer      string     `json:"issuer"`
+	Email       string     `json:"email"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	LastLoginAt *time.Time `json:"lastLoginAt"`
+}
+
+// LoadOIDCProvider reads the OIDC_* settings from the environment, nil when
+// OIDC_ISSUER is unset and single sign-on is off
+func LoadOIDCProvider() *oidc.Provider {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil
+	}
+	redirectURL := os.Getenv("OIDC_REDIRECT_URL")
+	if redirectURL == "" {
+		redirectURL = "http://localhost:8080/api/oidc/callback"
+	}
+	return oidc.New(oidc.Config{
+		Issuer:       issuer,
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  redirectURL,
+		Scopes:       strings.Fields(os.Getenv("OIDC_SCOPES")),
+	})
+}
+
+// OIDCProviderName is what the sign-in button calls the provider, from OIDC_PROVIDER_NAME
+func OIDCProviderName() string {
+	if v := os.Getenv("OIDC_PROVIDER_NAME"); v != "" {
+		return v
+	}
+	return "SSO"
+}
+
+// OIDCStatusHandler tells the login page whether to offer single sign-on
+func (S *Server) OIDCStatusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled": S.oidc != nil,
+		"name":    OIDCProviderName(),
+	})
+}
+
+// OIDCLoginHandler sends the browser to the provider, GET /api/oidc/login.
+// ?remember=1 asks for a remember-me session; ?link=1 links the provider to
+// the signed-in user instead of signing in.
+func (S *Server) OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if S.oidc == nil {
+		tools.SendJSONError(w, "Single sign-on is not configured", http.StatusNotFound)
+		return
+	}
+	var linkUserID any
+	if r.URL.Query().Get("link") == "1" {
+		userID, _ := CurrentUser(r)
+		if userID == 0 {
+			tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		linkUserID = userID
+	}
+
+	state, err := oidc.NewNonce()
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	nonce, err := oidc.NewNonce()
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	authURL, err := S.oidc.AuthCodeURL(r.Context(), state, nonce, challenge)
+	if err != nil {
+		log.Printf("Error starting OIDC login: %v", err)
+		S.oidcRedirect(w, r, "error", "The sign-in provider is unavailable, please try again later")
+		return
+	}
+
+	now := time.Now()
+	if _, err := S.db.Exec(`
+		INSERT INTO oidc_logins (state_hash, code_verifier, nonce, link_user_id, remember, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		HashToken(state), verifier, nonce, linkUserID, r.URL.Query().Get("remember") == "1",
+		S.db.Timestamp(now.Add(oidcLoginTTL)), S.db.Timestamp(now)); err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	S.setOIDCStateCookie(w, HashToken(state), int(oidcLoginTTL.Seconds()))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// setOIDCStateCookie binds a sign-in to this browser, a negative maxAge
+// removes the binding
+func (S *Server) setOIDCStateCookie(w http.ResponseWriter, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/api/oidc/callback",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   S.sessionConfig.CookieSecure,
+	})
+}
+
+// OIDCCallbackHandler is where the provider sends the browser back with a
+// code, GET /api/oidc/callback. It signs the user in, creating the account on
+// the first login, or links the provider, then redirects to the frontend.
+func (S *Server) OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if S.oidc == nil {
+		tools.SendJSONError(w, "Single sign-on is not configured", http.StatusNotFound)
+		return
+	}
+	q := r.URL.Query()
+
+	// a callback carrying someone else's state would sign this browser in as
+	// them, or link their provider account to the wrong user
+	stateHash := HashToken(q.Get("state"))
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(stateHash)) != 1 {
+		S.oidcRedirect(w, r, "error", "Your sign-in has expired, please try again")
+		return
+	}
+	S.setOIDCStateCookie(w, "", -1)
+
+	// the login is used up whatever the provider answered
+	var verifier, nonce string
+	var linkUserID sql.NullInt64
+	var remember bool
+	err = S.db.QueryRow(`
+		DELETE FROM oidc_logins WHERE state_hash = ? AND expires_at > ?
+		RETURNING code_verifier, nonce, link_user_id, remember`,
+		stateHash, S.db.Timestamp(time.Now())).Scan(&verifier, &nonce, &linkUserID, &remember)
+	if err == sql.ErrNoRows {
+		S.oidcRedirect(w, r, "error", "Your sign-in has expired, please try again")
+		return
+	}
+	if err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if q.Get("error") != "" || q.Get("code") == "" {
+		S.oidcRedirect(w, r, "error", "Sign-in was cancelled at the provider")
+		return
+	}
+
+	claims, err := S.oidc.Exchange(r.Context(), q.Get("code"), verifier, nonce)
+	if err != nil {
+		log.Printf("Error completing OIDC login: %v", err)
+		S.oidcRedirect(w, r, "error", "The provider's answer could not be verified, please try again")
+		return
+	}
+
+	if linkUserID.Valid {
+		err := S.LinkOIDCIdentity(int(linkUserID.Int64), claims)
+		if errors.Is(err, errOIDCLinked) {
+			S.oidcRedirect(w, r, "error", err.Error())
+			return
+		}
+		if err != nil {
+			http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		S.oidcRedirect(w, r, "status", "linked")
+		return
+	}
+
+	userID, err := S.OIDCUser(r.Context(), claims)
+	if errors.Is(err, errOIDCNoEmail) || errors.Is(err, errOIDCEmailTaken) {
+		S.oidcRedirect(w, r, "error", err.Error())
+		return
+	}
+	if err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// the provider vouches for the password, not for the second factor
+	twoFactor, err := S.TwoFactorEnabled(userID)
+	if err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if twoFactor {
+		pendingToken, err := S.CreatePendingLogin(userID, remember)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		// in a cookie rather than the URL, where it would end up in the
+		// history and Referer headers
+		S.setPendingLoginCookie(w, pendingToken, int(pendingLoginTTL.Seconds()))
+		http.Redirect(w, r, AppURL()+"/auth?twoFactor=1", http.StatusFound)
+		return
+	}
+
+	S.MakeToken(w, r, userID, remember)
+	http.Redirect(w, r, AppURL()+"/", http.StatusFound)
+}
+
+// oidcRedirect sends the browser to the frontend page reporting how an OIDC
+// login or link went
+func (S *Server) oidcRedirect(w http.ResponseWriter, r *http.Request, key, value string) {
+	http.Redirect(w, r, AppURL()+"/auth/oidc?"+url.Values{key: {value}}.Encode(), http.StatusFound)
+}
+
+// OIDCUser returns the user signed in by claims. An unknown subject gets a new
+// account, unless its email already belongs to one: that account has to link
+// the provider itself, so nobody takes it over with a provider account.
+func (S *Server) OIDCUser(ctx context.Context, claims *oidc.Claims) (int, error) {
+	var userID int
+	err := S.db.QueryRow(`
+		UPDATE oidc_identities SET last_login_at = ?, email = ?
+		WHERE issuer = ? AND subject = ? RETURNING user_id`,
+		S.db.Timestamp(time.Now()), claims.Email, claims.Issuer, claims.Subject).Scan(&userID)
+	if err != sql.ErrNoRows {
+		return userID, err
+	}
+
+	email := tools.ToLower(claims.Email)
+	if email == "" || !strings.Contains(email, "@") {
+		return 0, errOIDCNoEmail
+	}
+	err, found := S.UserFound(User{Email: email}, ctx)
+	if err != nil {
+		return 0, err
+	}
+	if found {
+		return 0, errOIDCEmailTaken
+	}
+
+	// nobody knows this password, a password reset sets a real one
+	password, _, err := NewSecretToken()
+	if err != nil {
+		return 0, err
+	}
+	user := User{
+		Email:     email,
+		Password:  password,
+		FirstName: claims.GivenName,
+		LastName:  claims.FamilyName,
+		AvatarUrl: defaultAvatar,
+	}
+	if user.FirstName == "" {
+		user.FirstName = claims.Name
+	}
+	user.Url, err = S.AvailableProfileURL(ProfileURL(user))
+	if err != nil {
+		return 0, err
+	}
+	if user.FirstName == "" {
+		user.FirstName = user.Url
+	}
+
+	userID, err = S.AddUser(user, ctx)
+	if err != nil {
+		return 0, err
+	}
+	if err := S.LinkOIDCIdentity(userID, claims); err != nil {
+		return 0, err
+	}
+
+	if claims.EmailVerified {
+		_, err = S.db.Exec(`UPDATE users SET email_verified_at = ? WHERE id = ?`, S.db.Timestamp(time.Now()), userID)
+		return userID, err
+	}
+	if err := S.SendEmailVerification(userID); err != nil {
+		log.Printf("Error sending verification email: %v", err)
+	}
+	return userID, nil
+}
+
+// AvailableProfileURL returns base, or base with the first number appended
+// that no other account uses as its url or nickname
+func (S *Server) AvailableProfileURL(base string) (string, error) {
+	candidate := base
+	for i := 2; ; i++ {
+		var taken bool
+		if err := S.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE url = ? OR nickname = ?)`,
+			candidate, candidate).Scan(&taken); err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+		candidate = base + strconv.Itoa(i)
+	}
+}
+
+// LinkOIDCIdentity lets the provider account of claims sign in as userID
+func (S *Server) LinkOIDCIdentity(userID int, claims *oidc.Claims) error {
+	var owner int
+	err := S.db.QueryRow(`SELECT user_id FROM oidc_identities WHERE issuer = ? AND subject = ?`,
+		claims.Issuer, claims.Subject).Scan(&owner)
+	if err == nil {
+		if owner != userID {
+			return errOIDCLinked
+		}
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	now := S.db.Timestamp(time.Now())
+	_, err = S.db.Exec(`
+		INSERT INTO oidc_identities (user_id, issuer, subject, email, created_at, last_login_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		userID, claims.Issuer, claims.Subject, claims.Email, now, now)
+	return err
+}
+
+// OIDCIdentitiesHandler lists the provider accounts linked to the caller
+func (S *Server) OIDCIdentitiesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := CurrentUser(r)
+
+	rows, err := S.db.Query(`
+		SELECT id, issuer, COALESCE(email, ''), created_at, last_login_at
+		FROM oidc_identities WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	identities := []OIDCIdentity{}
+	for rows.Next() {
+		var i OIDCIdentity
+		var createdAt, lastLoginAt sql.NullTime
+		if err := rows.Scan(&i.ID, &i.Issuer, &i.Email, &createdAt, &lastLoginAt); err != nil {
+			http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		i.CreatedAt = createdAt.Time
+		if lastLoginAt.Valid {
+			i.LastLoginAt = &lastLoginAt.Time
+		}
+		identities = append(identities, i)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(identities)
+}
+
+// UnlinkOIDCIdentityHandler removes one of the caller's linked provider
+// accounts, DELETE /api/oidc/identities/{id}
+func (S *Server) UnlinkOIDCIdentityHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, _ := CurrentUser(r)
+	id := tools.StringToInt(strings.TrimPrefix(r.URL.Path, "/api/oidc/identities/"))
+
+	res, err := S.db.Exec(`DELETE FROM oidc_identities WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tools.SendJSONError(w, "Linked account not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"unlinked": 1})
+}
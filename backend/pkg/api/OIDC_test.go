@@ -0,0 +1,329 @@
+package backend
+
+import (
+	"SOCIAL-NETWORK/pkg/oidc"
+	"SOCIAL-NETWORK/pkg/oidc/oidctest"
+	"SOCIAL-NETWORK/pkg/totp"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newOIDCServer returns a test server signing in through a mock provider
+func newOIDCServer(t *testing.T) *Server {
+	t.Helper()
+	S := newTestServer(t)
+	provider := httptest.NewServer(nil)
+	t.Cleanup(provider.Close)
+	mock, err := oidctest.New(provider.URL, "social-network", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider.Config.Handler = mock
+	S.oidc = oidc.New(oidc.Config{
+		Issuer:       provider.URL,
+		ClientID:     "social-network",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost:8080/api/oidc/callback",
+	})
+	return S
+}
+
+// oidcAuthorize starts an OIDC login as user (nil to sign in) and returns the
+// callback URL the provider sends the browser back to and the cookie binding
+// the login to the browser. tamper may change the authorization request on
+// its way to the provider.
+func oidcAuthorize(t *testing.T, S *Server, user *testUser, query string, tamper func(url.Values)) (string, *http.Cookie) {
+	t.Helper()
+	rec := do(t, S, user, http.MethodGet, "/api/oidc/login?"+query, nil)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("login: got %d %s", rec.Code, rec.Body)
+	}
+	state := responseCookies(rec)[oidcStateCookie]
+	if state == nil || !state.HttpOnly || state.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("login cookie = %+v", state)
+	}
+	authURL, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tamper != nil {
+		q := authURL.Query()
+		tamper(q)
+		authURL.RawQuery = q.Encode()
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	res, err := client.Get(authURL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("provider: got %d", res.StatusCode)
+	}
+	return res.Header.Get("Location"), state
+}
+
+// oidcCallback follows the provider's redirect back in a browser holding
+// state (nil for none) and returns the frontend URL the browser ends up on
+// and the cookies the callback set
+func oidcCallback(t *testing.T, S *Server, callbackURL string, state *http.Cookie) (*url.URL, map[string]*http.Cookie) {
+	t.Helper()
+	u, err := url.Parse(callbackURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, u.RequestURI(), nil)
+	if state != nil {
+		req.AddCookie(state)
+	}
+	rec := httptest.NewRecorder()
+	S.mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("callback: got %d %s", rec.Code, rec.Body)
+	}
+	to, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return to, responseCookies(rec)
+}
+
+// oidcSignIn goes through a whole OIDC login and returns where it ends and the
+// session it started
+func oidcSignIn(t *testing.T, S *Server, user *testUser, query string, tamper func(url.Values)) (*url.URL, *http.Cookie) {
+	t.Helper()
+	callback, state := oidcAuthorize(t, S, user, query, tamper)
+	to, cookies := oidcCallback(t, S, callback, state)
+	return to, cookies["session_token"]
+}
+
+// responseCookies are the cookies rec sets by name
+func responseCookies(rec *httptest.ResponseRecorder) map[string]*http.Cookie {
+	cookies := make(map[string]*http.Cookie)
+	for _, c := range rec.Result().Cookies() {
+		cookies[c.Name] = c
+	}
+	return cookies
+}
+
+// sessionUser is the user a session cookie signs in, 0 for none
+func sessionUser(t *testing.T, S *Server, session *http.Cookie) int {
+	t.Helper()
+	if session == nil {
+		return 0
+	}
+	var userID int
+	if err := S.db.QueryRow(`SELECT user_id FROM sessions WHERE session_id = ?`, session.Value).Scan(&userID); err != nil {
+		t.Fatal(err)
+	}
+	return userID
+}
+
+func expectOIDCError(t *testing.T, to *url.URL, session *http.Cookie, want string) {
+	t.Helper()
+	if to.Path != "/auth/oidc" || to.Query().Get("error") != want {
+		t.Errorf("redirected to %s, want the error %q", to, want)
+	}
+	if session != nil {
+		t.Errorf("signed in after an error")
+	}
+}
+
+func TestOIDCSignInProvisionsAccount(t *testing.T) {
+	S := newOIDCServer(t)
+
+	to, session := oidcSignIn(t, S, nil, "", nil)
+	if to.String() != AppURL()+"/" {
+		t.Fatalf("redirected to %s", to)
+	}
+	var userID int
+	var email, firstName string
+	var verified bool
+	if err := S.db.QueryRow(`SELECT id, email, first_name, email_verified_at IS NOT NULL FROM users`).Scan(
+		&userID, &email, &firstName, &verified); err != nil {
+		t.Fatal(err)
+	}
+	if email != "mock.user@example.com" || firstName != "Mock" || !verified {
+		t.Errorf("new account = %s %s verified %v", email, firstName, verified)
+	}
+	if got := sessionUser(t, S, session); got != userID {
+		t.Errorf("signed in as %d, want %d", got, userID)
+	}
+
+	// the next sign-in finds the account by its subject
+	_, session = oidcSignIn(t, S, nil, "", nil)
+	if got := sessionUser(t, S, session); got != userID {
+		t.Errorf("second sign-in as %d, want %d", got, userID)
+	}
+	if n := count(t, S, `SELECT COUNT(*) FROM users`); n != 1 {
+		t.Errorf("%d accounts, want 1", n)
+	}
+}
+
+func TestOIDCCallbackChecks(t *testing.T) {
+	otherVerifier := func(q url.Values) {
+		_, challenge, _ := oidc.NewPKCE()
+		q.Set("code_challenge", challenge)
+	}
+	for _, tt := range []struct {
+		name   string
+		tamper func(url.Values)
+		want   string
+	}{
+		{"state", func(q url.Values) { q.Set("state", "forged") }, "Your sign-in has expired, please try again"},
+		{"nonce", func(q url.Values) { q.Set("nonce", "replayed") }, "The provider's answer could not be verified, please try again"},
+		{"PKCE", otherVerifier, "The provider's answer could not be verified, please try again"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			S := newOIDCServer(t)
+			to, session := oidcSignIn(t, S, nil, "", tt.tamper)
+			expectOIDCError(t, to, session, tt.want)
+			if n := count(t, S, `SELECT COUNT(*) FROM users`); n != 0 {
+				t.Errorf("%d accounts, want 0", n)
+			}
+		})
+	}
+
+	t.Run("replay", func(t *testing.T) {
+		S := newOIDCServer(t)
+		callback, state := oidcAuthorize(t, S, nil, "", nil)
+		if _, cookies := oidcCallback(t, S, callback, state); cookies["session_token"] == nil {
+			t.Fatal("not signed in")
+		}
+		to, cookies := oidcCallback(t, S, callback, state)
+		expectOIDCError(t, to, cookies["session_token"], "Your sign-in has expired, please try again")
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		S := newOIDCServer(t)
+		callback, state := oidcAuthorize(t, S, nil, "", nil)
+		u, _ := url.Parse(callback)
+		q := u.Query()
+		q.Del("code")
+		q.Set("error", "access_denied")
+		u.RawQuery = q.Encode()
+		to, cookies := oidcCallback(t, S, u.String(), state)
+		expectOIDCError(t, to, cookies["session_token"], "Sign-in was cancelled at the provider")
+	})
+
+	// a callback only completes in the browser that started the login
+	t.Run("other browser", func(t *testing.T) {
+		S := newOIDCServer(t)
+		callback, state := oidcAuthorize(t, S, nil, "", nil)
+		_, other := oidcAuthorize(t, S, nil, "", nil)
+		for _, cookie := range []*http.Cookie{nil, other} {
+			to, cookies := oidcCallback(t, S, callback, cookie)
+			expectOIDCError(t, to, cookies["session_token"], "Your sign-in has expired, please try again")
+		}
+		if n := count(t, S, `SELECT COUNT(*) FROM users`); n != 0 {
+			t.Errorf("%d accounts, want 0", n)
+		}
+		// and the rejected tries didn't use it up
+		if _, cookies := oidcCallback(t, S, callback, state); cookies["session_token"] == nil {
+			t.Error("the browser that started the login isn't signed in")
+		}
+	})
+}
+
+func TestOIDCEmailTaken(t *testing.T) {
+	S := newOIDCServer(t)
+	createTestUser(t, S, "alice", false)
+
+	// a provider account with alice's email doesn't get into her account
+	to, session := oidcSignIn(t, S, nil, "", func(q url.Values) { q.Set("login_hint", "Alice@Example.com") })
+	expectOIDCError(t, to, session, errOIDCEmailTaken.Error())
+	if n := count(t, S, `SELECT COUNT(*) FROM oidc_identities`); n != 0 {
+		t.Errorf("%d identities, want 0", n)
+	}
+	if n := count(t, S, `SELECT COUNT(*) FROM users`); n != 1 {
+		t.Errorf("%d accounts, want 1", n)
+	}
+}
+
+func TestOIDCLinkAccount(t *testing.T) {
+	S := newOIDCServer(t)
+	alice := createTestUser(t, S, "alice", false)
+	bob := createTestUser(t, S, "bob", false)
+	hint := func(q url.Values) { q.Set("login_hint", "alice@example.com") }
+
+	if rec := do(t, S, nil, http.MethodGet, "/api/oidc/login?link=1", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("linking signed out: got %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	to, session := oidcSignIn(t, S, &alice, "link=1", hint)
+	if to.Path != "/auth/oidc" || to.Query().Get("status") != "linked" {
+		t.Fatalf("redirected to %s", to)
+	}
+	if session != nil {
+		t.Errorf("linking started a new session")
+	}
+	if n := count(t, S, `SELECT COUNT(*) FROM oidc_identities WHERE user_id = ?`, alice.ID); n != 1 {
+		t.Fatalf("alice has %d identities, want 1", n)
+	}
+
+	// the linked provider account now signs alice in
+	_, session = oidcSignIn(t, S, nil, "", hint)
+	if got := sessionUser(t, S, session); got != alice.ID {
+		t.Errorf("signed in as %d, want alice %d", got, alice.ID)
+	}
+
+	// and can't be linked to bob as well
+	to, _ = oidcSignIn(t, S, &bob, "link=1", hint)
+	expectOIDCError(t, to, nil, errOIDCLinked.Error())
+	if n := count(t, S, `SELECT COUNT(*) FROM oidc_identities WHERE user_id = ?`, bob.ID); n != 0 {
+		t.Errorf("bob has %d identities, want 0", n)
+	}
+}
+
+func TestOIDCLinkNeedsStartingBrowser(t *testing.T) {
+	S := newOIDCServer(t)
+	mallory := createTestUser(t, S, "mallory", false)
+
+	// mallory starts linking and gets alice to finish it at the provider
+	callback, _ := oidcAuthorize(t, S, &mallory, "link=1", func(q url.Values) { q.Set("login_hint", "alice@example.com") })
+	to, _ := oidcCallback(t, S, callback, nil)
+	expectOIDCError(t, to, nil, "Your sign-in has expired, please try again")
+	if n := count(t, S, `SELECT COUNT(*) FROM oidc_identities`); n != 0 {
+		t.Errorf("%d identities linked, want 0", n)
+	}
+}
+
+func TestOIDCSignInWithTwoFactor(t *testing.T) {
+	S := newOIDCServer(t)
+	alice := createTestUser(t, S, "alice", false)
+	hint := func(q url.Values) { q.Set("login_hint", "alice@example.com") }
+	if to, _ := oidcSignIn(t, S, &alice, "link=1", hint); to.Query().Get("status") != "linked" {
+		t.Fatalf("link: redirected to %s", to)
+	}
+	secret := enableTestTwoFactor(t, S, alice)
+
+	callback, state := oidcAuthorize(t, S, nil, "", hint)
+	to, cookies := oidcCallback(t, S, callback, state)
+	if to.String() != AppURL()+"/auth?twoFactor=1" {
+		t.Fatalf("redirected to %s", to)
+	}
+	pending := cookies[pendingLoginCookie]
+	if cookies["session_token"] != nil || pending == nil || !pending.HttpOnly || pending.Path != "/api/login/2fa" {
+		t.Fatalf("cookies = %v", cookies)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/login/2fa", strings.NewReader(`{"code": "`+totp.Code(secret, time.Now())+`"}`))
+	req.AddCookie(pending)
+	rec := httptest.NewRecorder()
+	S.mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("2fa: got %d %s", rec.Code, rec.Body)
+	}
+	cookies = responseCookies(rec)
+	if got := sessionUser(t, S, cookies["session_token"]); got != alice.ID {
+		t.Errorf("signed in as %d, want alice %d", got, alice.ID)
+	}
+	if c := cookies[pendingLoginCookie]; c == nil || c.MaxAge >= 0 {
+		t.Errorf("pending login cookie not removed: %+v", c)
+	}
+}
@@ -1,6 +1,7 @@
 package backend
 
 import (
+	"database/sql"
 	"time"
 )
 
@@ -37,11 +38,28 @@ type UserData struct {
 	Url                 string  `json:"url"`
 	Isfollowing         bool    `json:"isfollowing"`
 	FollowRequestStatus string  `json:"followRequestStatus"`
+	EmailVerified       bool    `json:"emailVerified"`
+}
+
+// ProfileUpdate is the body of a partial profile update, nil fields are left as they are.
+// CurrentPassword is only needed when Email or Password changes.
+type ProfileUpdate struct {
+	FirstName       *string `json:"firstName"`
+	LastName        *string `json:"lastName"`
+	Nickname        *string `json:"nickname"`
+	Email           *string `json:"email"`
+	DateOfBirth     *string `json:"dateOfBirth"`
+	Avatar          *string `json:"avatar"`
+	AboutMe         *string `json:"aboutMe"`
+	IsPrivate       *bool   `json:"isPrivate"`
+	Password        *string `json:"password"`
+	CurrentPassword string  `json:"currentPassword"`
 }
 
 type LoginUser struct {
 	Identifier string `json:"identifier"`
 	Password   string `json:"password"`
+	RememberMe bool   `json:"rememberMe"`
 }
 
 type Post struct {
@@ -56,6 +74,8 @@ type Post struct {
 	Comments          int      `json:"comments"`
 	Shares            int      `json:"shares"`
 	IsLiked           bool     `json:"isLiked"`
+	IsEdited          bool     `json:"isEdited"`
+	SharedPost        *Post    `json:"sharedPost,omitempty"`
 	Author            Author   `json:"author"`
 	SelectedFollowers []string `json:"selectedFollowers,omitempty"`
 }
@@ -70,9 +90,31 @@ type Notification struct {
 	FirstName string    `json:"firstName"`
 	LastName  string    `json:"lastName"`
 	Avatar    string    `json:"avatar"`
+
+	// what the notification is about; notifications of one type about the
+	// same target are grouped into a single entry
+	PostID    int `json:"postId,omitempty"`
+	CommentID int `json:"commentId,omitempty"`
+	GroupID   int `json:"groupId,omitempty"`
+	EventID   int `json:"eventId,omitempty"`
+}
+
+// PostEdit is the body of an edit; nil fields are left unchanged and an
+// empty Image removes the image
+type PostEdit struct {
+	Content *string `json:"content"`
+	Image   *string `json:"image"`
+}
+
+type PostRevision struct {
+	ID        int     `json:"id"`
+	Content   string  `json:"content"`
+	Image     *string `json:"image,omitempty"`
+	CreatedAt string  `json:"createdAt"`
 }
 
 type Author = struct {
+	ID        int    `json:"id"`
 	Name      string `json:"name"`
 	Username  string `json:"username"`
 	Avatar    string `json:"avatar"`
@@ -122,19 +164,48 @@ type Follower struct {
 	Avatar    string `json:"avatar"`
 }
 
+// FollowTarget is the user a follow endpoint acts on. The acting user always
+// comes from the session, the client only names the target.
+type FollowTarget struct {
+	ID        int
+	IsPrivate bool
+}
+
 type Comment struct {
 	ID              string `json:"id"`
 	ParentCommentID int    `json:"parentCommentId,omitempty"`
 	Author          struct {
+		ID       int    `json:"id,omitempty"`
 		Name     string `json:"name,omitempty"`
 		Username string `json:"username,omitempty"`
 		Avatar   string `json:"avatar,omitempty"`
 	} `json:"author,omitempty"`
-	Content   string    `json:"content"`
-	CreatedAt string    `json:"createdAt"`
-	Likes     int       `json:"likes"`
-	IsLiked   bool      `json:"isLiked"`
-	Replies   []Comment `json:"replies"`
+	Content      string    `json:"content"`
+	CreatedAt    string    `json:"createdAt"`
+	Likes        int       `json:"likes"`
+	IsLiked      bool      `json:"isLiked"`
+	RepliesCount int       `json:"repliesCount"`
+	IsEdited     bool      `json:"isEdited"`
+	IsHidden     bool      `json:"isHidden,omitempty"`
+	Replies      []Comment `json:"replies"`
+	// NextRepliesCursor loads the replies after the ones in Replies
+	NextRepliesCursor string `json:"nextRepliesCursor,omitempty"`
+}
+
+type CommentRevision struct {
+	ID        int    `json:"id"`
+	Content   string `json:"content"`
+	CreatedAt string `json:"createdAt"`
+}
+
+// CommentTarget is what the edit/delete/hide handlers check before touching a comment
+type CommentTarget struct {
+	AuthorID     int
+	PostID       int
+	PostAuthorID int
+	ParentID     sql.NullInt64
+	Content      string
+	IsHidden     bool
 }
 
 type Group struct {
@@ -147,6 +218,17 @@ type Group struct {
 	IsCreator   bool   `json:"isCreator,omitempty"`
 }
 
+// SearchUser is a user in the search results
+type SearchUser struct {
+	ID        int    `json:"id"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	Nickname  string `json:"nickname"`
+	Url       string `json:"url"`
+	Avatar    string `json:"avatar"`
+	IsPrivate bool   `json:"isPrivate"`
+}
+
 type GroupMember struct {
 	GroupID  int    `json:"groupId"`
 	UserID   int    `json:"userId"`
@@ -0,0 +1,197 @@
+package backend
+
+import (
+	tools "SOCIAL-NETWORK/pkg"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	passwordResetTTL = time.Hour
+	// a new reset email is not sent while the last one is younger than this
+	passwordResetCooldown = time.Minute
+)
+
+type PasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+type PasswordResetConfirm struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// NewSecretToken returns a random token to hand to the user and the hash to
+// store in its place
+func NewSecretToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := hex.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+// HashToken is what a secret token is stored and looked up as
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RequestPasswordResetHandler emails a reset link to the account with the
+// given email. The answer is the same whether or not the account exists.
+func (S *Server) RequestPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		tools.SendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req PasswordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		tools.SendJSONError(w, "Email is required", http.StatusBadRequest)
+		return
+	}
+
+	// done in the background so the response time doesn't tell either
+	go func(email string) {
+		if err := S.SendPasswordReset(email); err != nil {
+			log.Printf("Error sending password reset: %v", err)
+		}
+	}(tools.ToLower(req.Email))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "If an account exists for this email, a reset link has been sent",
+	})
+}
+
+// SendPasswordReset stores a new reset token for the user with this email and
+// queues the email carrying it. Unknown emails are ignored.
+func (S *Server) SendPasswordReset(email string) error {
+	var userID int
+	var name string
+	err := S.db.QueryRow(`SELECT id, first_name FROM users WHERE email = ?`, email).Scan(&userID, &name)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var recent bool
+	if err := S.db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM password_resets WHERE user_id = ? AND used_at IS NULL AND created_at > ?)`,
+		userID, S.db.Timestamp(now.Add(-passwordResetCooldown))).Scan(&recent); err != nil {
+		return err
+	}
+	if recent {
+		return nil
+	}
+
+	token, hash, err := NewSecretToken()
+	if err != nil {
+		return err
+	}
+	if _, err := S.db.Exec(`
+		INSERT INTO password_resets (user_id, token_hash, expires_at, created_at) VALUES (?, ?, ?, ?)`,
+		userID, hash, S.db.Timestamp(now.Add(passwordResetTTL)), S.db.Timestamp(now)); err != nil {
+		return err
+	}
+
+	return S.QueueEmail(email, "password_reset", map[string]any{
+		"Name":      name,
+		"Link":      AppURL() + "/auth/reset-password?token=" + token,
+		"ExpiresIn": "1 hour",
+	})
+}
+
+// ConfirmPasswordResetHandler sets a new password with a token from a reset
+// email. The token works once; every session of the user is ended.
+func (S *Server) ConfirmPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		tools.SendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req PasswordResetConfirm
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		tools.SendJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Password) < 8 {
+		tools.SendJSONError(w, "Password must be at least 8 characters", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := S.ResetPassword(req.Token, req.Password)
+	if err == sql.ErrNoRows {
+		tools.SendJSONError(w, "This reset link is invalid or has expired", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	S.CloseClients(userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password updated, please sign in again"})
+}
+
+// ResetPassword uses up the reset token and replaces the password of its user.
+// Everything the old password could have given someone goes with it: their
+// sessions, logins waiting for a second factor, access tokens and other reset
+// tokens. The account's lockout is lifted, since the owner just proved
+// themselves by email. An unknown, used or expired token gives sql.ErrNoRows.
+func (S *Server) ResetPassword(token, password string) (int, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := S.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := S.db.Timestamp(time.Now())
+	var userID int
+	// the used_at check in the UPDATE makes a token race-free to spend
+	if err := tx.QueryRow(`
+		UPDATE password_resets SET used_at = ?
+		WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?
+		RETURNING user_id`, now, HashToken(token), now).Scan(&userID); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(`UPDATE users SET password = ? WHERE id = ?`, string(hashedPassword), userID); err != nil {
+		return 0, err
+	}
+	for _, query := range []string{
+		`DELETE FROM sessions WHERE user_id = ?`,
+		`DELETE FROM pending_logins WHERE user_id = ?`,
+		`DELETE FROM api_tokens WHERE user_id = ?`,
+		`DELETE FROM password_resets WHERE user_id = ? AND used_at IS NULL`,
+	} {
+		if _, err := tx.Exec(query, userID); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := tx.Exec(`DELETE FROM login_attempts WHERE scope = ? AND subject = ?`,
+		loginScopeAccount, strconv.Itoa(userID)); err != nil {
+		return 0, err
+	}
+	return userID, tx.Commit()
+}
@@ -0,0 +1,64 @@
+package backend
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+)
+
+var resetTokenPattern = regexp.MustCompile(`token=([0-9a-f]+)`)
+
+func TestResetPasswordDropsOldAccess(t *testing.T) {
+	S, clock := newLimitedServer(t)
+	alice := createTestUser(t, S, "alice", false)
+	enableTestTwoFactor(t, S, alice)
+
+	rec := do(t, S, &alice, http.MethodPost, "/api/tokens", NewAccessToken{Name: "script", Scopes: []TokenScope{ScopeRead}})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create token: got %d %s", rec.Code, rec.Body)
+	}
+	// someone with the old password waits at the second factor, then locks
+	// the account guessing
+	if code, _ := login(t, S, "alice", "pass1234"); code != http.StatusOK {
+		t.Fatalf("login: got %d", code)
+	}
+	if n := count(t, S, `SELECT COUNT(*) FROM pending_logins WHERE user_id = ?`, alice.ID); n != 1 {
+		t.Fatalf("%d pending logins, want 1", n)
+	}
+	for range 7 {
+		failLogins(t, S, "alice", 1)
+		clock.Advance(S.loginLimits.MaxDelay)
+	}
+	if code, _ := login(t, S, "alice", "pass1234"); code != http.StatusTooManyRequests {
+		t.Fatalf("locked account: got %d", code)
+	}
+
+	if err := S.SendPasswordReset(alice.Email); err != nil {
+		t.Fatal(err)
+	}
+	var body string
+	if err := S.db.QueryRow(`SELECT text_body FROM email_outbox WHERE subject LIKE '%Reset%'`).Scan(&body); err != nil {
+		t.Fatal(err)
+	}
+	m := resetTokenPattern.FindStringSubmatch(body)
+	if m == nil {
+		t.Fatalf("no token in %q", body)
+	}
+	rec = do(t, S, nil, http.MethodPost, "/api/password-reset/confirm", PasswordResetConfirm{Token: m[1], Password: "newpass99"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("reset: got %d %s", rec.Code, rec.Body)
+	}
+
+	for _, table := range []string{"sessions", "pending_logins", "api_tokens"} {
+		if n := count(t, S, `SELECT COUNT(*) FROM `+table+` WHERE user_id = ?`, alice.ID); n != 0 {
+			t.Errorf("%d %s left after the reset", n, table)
+		}
+	}
+	// the owner isn't kept out by the lockout, the old password is
+	if code, _ := login(t, S, "alice", "newpass99"); code != http.StatusOK {
+		t.Errorf("login with the new password: got %d", code)
+	}
+	if code, _ := login(t, S, "alice", "pass1234"); code != http.StatusUnauthorized {
+		t.Errorf("login with the old password: got %d", code)
+	}
+}
@@ -3,11 +3,13 @@ package backend
 import (
 	tools "SOCIAL-NETWORK/pkg"
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"html"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -21,6 +23,7 @@ func (S *Server) UploadPostHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	userID, _ := CurrentUser(r)
 
 	file, header, err := r.FormFile("post")
 	if err != nil {
@@ -44,40 +47,87 @@ func (S *Server) UploadPostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// posts may only use files their author uploaded
+	if _, err := S.db.Exec(`INSERT INTO post_uploads (user_id, path) VALUES (?, ?)`, userID, "/"+postPath); err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.Write([]byte(fmt.Sprintf(`{"postUrl": "/%s"}`, postPath)))
 }
 
+// OwnsPostUpload reports whether image is a file userID uploaded with
+// UploadPostHandler
+func (S *Server) OwnsPostUpload(userID int, image string) (bool, error) {
+	var owned bool
+	err := S.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM post_uploads WHERE path = ? AND user_id = ?)`,
+		image, userID).Scan(&owned)
+	return owned, err
+}
+
+// ValidNewPostImage reports whether userID may put image on a new post: a
+// file they uploaded, or a link to an image elsewhere such as a gif from the
+// picker. Paths on this server are only accepted when they are the user's
+// uploads, since deleting the post deletes the file.
+func (S *Server) ValidNewPostImage(userID int, image string) (bool, error) {
+	if strings.HasPrefix(image, "/") {
+		return S.OwnsPostUpload(userID, image)
+	}
+	u, err := url.Parse(image)
+	return err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != "", nil
+}
+
+// ReadNewPostImage checks the image of a post userID is creating and returns
+// the value to store, nil for none. It writes the error response itself and
+// returns false when the image can't be used.
+func (S *Server) ReadNewPostImage(w http.ResponseWriter, userID int, image *string) (*string, bool) {
+	if image == nil || *image == "" {
+		return nil, true
+	}
+	valid, err := S.ValidNewPostImage(userID, *image)
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return nil, false
+	}
+	if !valid {
+		tools.SendJSONError(w, "Invalid image", http.StatusBadRequest)
+		return nil, false
+	}
+	return image, true
+}
+
 func (S *Server) CreatePostHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	userID, _, err := S.CheckSession(r)
-	if err != nil {
-		http.Error(w, "Unauthorized - No session", http.StatusUnauthorized)
-		return
-	}
+	userID, _ := CurrentUser(r)
 
 	var post Post
-	err = json.NewDecoder(r.Body).Decode(&post)
+	err := json.NewDecoder(r.Body).Decode(&post)
 	if err != nil {
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
 
+	image, ok := S.ReadNewPostImage(w, userID, post.Image)
+	if !ok {
+		return
+	}
+	post.Image = image
 	if strings.TrimSpace(post.Content) == "" && post.Image == nil {
 		http.Error(w, "Content cannot be empty", http.StatusBadRequest)
 		return
 	}
 
 	// Insert into database
-	res, err := S.db.Exec(`
+	err = S.db.QueryRow(`
         INSERT INTO posts (user_id, content, image, privacy)
-        VALUES (?, ?, ?, ?)`,
+        VALUES (?, ?, ?, ?) RETURNING id`,
 		userID, html.EscapeString(post.Content), post.Image, post.Privacy,
-	)
+	).Scan(&post.ID)
 
 	if err != nil {
 		fmt.Println("Error inserting post:", err)
@@ -85,8 +135,6 @@ func (S *Server) CreatePostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	lastID, _ := res.LastInsertId()
-	post.ID = int(lastID)
 	post.UserID = userID
 	post.CreatedAt = time.Now().Format(time.RFC3339)
 
@@ -105,6 +153,10 @@ func (S *Server) CreatePostHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if err := S.LinkPostTags(post.ID, userID, post.Content); err != nil {
+		fmt.Println("Error linking post tags:", err)
+	}
+
 	Post, err := S.GetPostFromID(post.ID, r)
 	if err != nil {
 		http.Error(w, "DB Error", http.StatusInternalServerError)
@@ -126,17 +178,13 @@ func (S *Server) LikeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID, _, err := S.CheckSession(r)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
+	userID, _ := CurrentUser(r)
 
 	PostID := tools.StringToInt(r.URL.Path[len("/api/like/"):])
 
 	// check if already liked
 	var exists bool
-	err = S.db.QueryRow(
+	err := S.db.QueryRow(
 		"SELECT EXISTS(SELECT 1 FROM likes WHERE user_id=? AND post_id=?)",
 		userID, PostID,
 	).Scan(&exists)
@@ -158,7 +206,7 @@ func (S *Server) LikeHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		_, _ = S.db.Exec("UPDATE posts SET likes = likes - 1 WHERE id=?", PostID)
-		S.DeleteNotification(tools.IntToString(userID), tools.IntToString(userIDs), "like")
+		S.RemoveNotificationActor(Notification{ID: userIDs, ActorID: userID, Type: "like", PostID: PostID})
 
 		S.PushNotification("-delete", userIDs, Notification{})
 		json.NewEncoder(w).Encode(map[string]interface{}{"liked": false})
@@ -172,7 +220,7 @@ func (S *Server) LikeHandler(w http.ResponseWriter, r *http.Request) {
 		_, _ = S.db.Exec("UPDATE posts SET likes = likes + 1 WHERE id=?", PostID)
 
 		if userIDs != userID {
-			notification := Notification{ID: userIDs, ActorID: userID, Type: "like", Content: "Like Your Post", IsRead: false}
+			notification := Notification{ID: userIDs, ActorID: userID, Type: "like", Content: "Like Your Post", IsRead: false, PostID: PostID}
 
 			S.IsertNotification(notification)
 			S.PushNotification("-new", userIDs, notification)
@@ -183,23 +231,14 @@ func (S *Server) LikeHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (S *Server) GetUserPosts(userID int, r *http.Request) ([]Post, error) {
-	currentUserID, _, err := S.CheckSession(r)
-	if err != nil {
-		return nil, err
-	}
+	currentUserID, _ := CurrentUser(r)
 
-	rows, err := S.db.Query(`
-	SELECT 
-		p.id, p.content, p.image, p.created_at, p.privacy,
-		u.id, u.first_name, u.last_name, u.nickname, u.avatar, u.is_private,
-		(SELECT COUNT(*) FROM likes l WHERE l.post_id = p.id) as like_count,
-		(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id AND c.parent_comment_id IS NULL) as comment_count,
-		EXISTS(SELECT 1 FROM likes l WHERE l.post_id = p.id AND l.user_id = ?) as is_liked
-	FROM posts p
-	JOIN users u ON p.user_id = u.id
-	WHERE p.user_id = ? AND p.group_id IS NULL
+	rows, err := S.db.Query(postSelectSQL+`
+	WHERE p.user_id = ? AND p.group_id IS NULL AND `+visiblePostSQL("p")+`
+		AND (p.shared_post_id IS NULL OR o.id IS NOT NULL)
 	ORDER BY p.created_at DESC
-`, currentUserID, userID)
+`, currentUserID, currentUserID, currentUserID, currentUserID, currentUserID,
+		userID, currentUserID, currentUserID, currentUserID)
 
 	if err != nil {
 		return nil, err
@@ -208,47 +247,14 @@ func (S *Server) GetUserPosts(userID int, r *http.Request) ([]Post, error) {
 
 	var posts []Post
 	for rows.Next() {
-		var post Post
-		var authorID int
-		var firstName, lastName, nickname, avatar sql.NullString
-		var isPrivate, isFollowing bool
-		if err := rows.Scan(
-			&post.ID, &post.Content, &post.Image, &post.CreatedAt, &post.Privacy,
-			&authorID, &firstName, &lastName, &nickname, &avatar, &isPrivate,
-			&post.Likes, &post.Comments, &post.IsLiked,
-		); err != nil {
+		post, _, err := scanPost(rows)
+		if err != nil {
 			return nil, err
 		}
-		if post.Privacy == "almost-private" && authorID != currentUserID {
-			isFollowing, err = S.IsFollowing(r, "", strconv.Itoa(authorID))
-			if err != nil {
-				return nil, err
-			}
-			if !isFollowing {
-				continue
-			}
-		} else if post.Privacy == "private" {
-			UserAllowed, err := S.UserAllowedToSeePost(currentUserID, post.ID)
-			if err != nil {
-				return nil, err
-			}
-			if authorID != currentUserID && !UserAllowed {
-				continue
-			}
-		}
-
-		post.Author = Author{
-			Name:      firstName.String + " " + lastName.String,
-			Username:  nickname.String,
-			Avatar:    avatar.String,
-			IsPrivate: isPrivate,
-		}
-		post.UserID = userID
-		post.Shares = 0
 		posts = append(posts, post)
 	}
 
-	return posts, nil
+	return posts, rows.Err()
 }
 
 func (S *Server) GetUserIdFromPostID(postID int) (int, error) {
@@ -260,120 +266,727 @@ func (S *Server) GetUserIdFromPostID(postID int) (int, error) {
 	return userID, nil
 }
 
+// GetPostsHandler serves the home feed one page at a time, newest first.
+// ?cursor= is the nextCursor of the previous page and ?limit= the page size.
 func (S *Server) GetPostsHandler(w http.ResponseWriter, r *http.Request) {
-	userID, _, err := S.CheckSession(r)
+	userID, _ := CurrentUser(r)
+
+	cursor, limit, err := ReadFeedPage(r)
 	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		tools.SendJSONError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	var allPosts []Post
-	ids, err := S.GetAllUsers()
+
+	posts, next, err := S.GetFeedPage(r, cursor, limit, "")
 	if err != nil {
-		fmt.Println("GetPostsHandler GetAllUsers error : ", err)
+		fmt.Println("GetPostsHandler GetFeedPage error : ", err)
 		http.Error(w, "DB Error", http.StatusInternalServerError)
 		return
 	}
-	for _, userID := range ids {
-		posts, err := S.GetUserPosts(userID, r)
+	if posts == nil {
+		posts = []Post{}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"posts":      posts,
+		"nextCursor": next,
+		"user": map[string]interface{}{
+			"userID": userID,
+		},
+	})
+}
+
+const (
+	defaultFeedPageSize = 20
+	maxFeedPageSize     = 50
+)
+
+// visiblePostSQL keeps the posts (under alias) the viewer may read: their own,
+// public ones, almost-private ones of people they follow and private ones they
+// were picked for. It takes the viewer id three times.
+func visiblePostSQL(alias string) string {
+	return visiblePostSQLFor(alias, "?")
+}
+
+// visiblePostSQLFor is visiblePostSQL for the viewer id in the SQL expression
+// viewer, such as a column, so one query can check many viewers
+func visiblePostSQLFor(alias, viewer string) string {
+	return fmt.Sprintf(`(
+		%[1]s.user_id = %[2]s
+		OR %[1]s.privacy = 'public'
+		OR (%[1]s.privacy = 'almost-private' AND EXISTS(
+			SELECT 1 FROM follows f WHERE f.follower_id = %[2]s AND f.following_id = %[1]s.user_id))
+		OR (%[1]s.privacy = 'private' AND EXISTS(
+			SELECT 1 FROM posts_private pp WHERE pp.post_id = %[1]s.id AND pp.user_id = %[2]s))
+	)`, alias, viewer)
+}
+
+// ReadFeedPage reads the ?cursor= and ?limit= query parameters of a feed request
+func ReadFeedPage(r *http.Request) (*FeedCursor, int, error) {
+	limit := defaultFeedPageSize
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, 0, fmt.Errorf("invalid limit")
+		}
+		limit = min(n, maxFeedPageSize)
+	}
+
+	if v := r.URL.Query().Get("cursor"); v != "" {
+		c, err := DecodeFeedCursor(v)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid cursor")
+		}
+		return &c, limit, nil
+	}
+	return nil, limit, nil
+}
+
+// CanSeePost reports whether userID may read postID, following the same rules
+// as the feed plus group membership for group posts.
+func (S *Server) CanSeePost(userID, postID int) (bool, error) {
+	var visible bool
+	err := S.db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM posts p WHERE p.id = ? AND `+canSeePostSQL("p", "?")+`)`,
+		postID, userID, userID, userID, userID, userID, userID, userID,
+	).Scan(&visible)
+	return visible, err
+}
+
+// canSeePostSQL is the condition of CanSeePost on the post under alias for the
+// viewer id in the SQL expression viewer
+func canSeePostSQL(alias, viewer string) string {
+	return fmt.Sprintf(`%[2]s
+		AND (%[1]s.group_id IS NULL OR EXISTS(
+			SELECT 1 FROM group_members gm WHERE gm.group_id = %[1]s.group_id AND gm.user_id = %[3]s))
+		AND (%[1]s.shared_post_id IS NULL OR EXISTS(
+			SELECT 1 FROM posts o WHERE o.id = %[1]s.shared_post_id AND %[4]s))`,
+		alias, visiblePostSQLFor(alias, viewer), viewer, visiblePostSQLFor("o", viewer))
+}
+
+// FeedCursor points at the last post of a feed page
+type FeedCursor struct {
+	CreatedAt time.Time
+	ID        int
+}
+
+func (c FeedCursor) Encode() string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + strconv.Itoa(c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeFeedCursor(s string) (FeedCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return FeedCursor{}, err
+	}
+	at, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return FeedCursor{}, fmt.Errorf("malformed cursor")
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, at)
+	if err != nil {
+		return FeedCursor{}, err
+	}
+	postID, err := strconv.Atoi(id)
+	if err != nil {
+		return FeedCursor{}, err
+	}
+	return FeedCursor{CreatedAt: createdAt, ID: postID}, nil
+}
+
+// GetFeedPage returns up to limit posts visible to the current user that come after cursor
+// (nil for the first page) and the cursor of the next page, empty on the last one.
+// filter is an optional extra condition on p with its own bind values.
+func (S *Server) GetFeedPage(r *http.Request, cursor *FeedCursor, limit int, filter string, filterArgs ...any) ([]Post, string, error) {
+	userID, _ := CurrentUser(r)
+	query := postSelectSQL + `
+	WHERE p.group_id IS NULL AND ` + visiblePostSQL("p") + `
+		AND (p.shared_post_id IS NULL OR o.id IS NOT NULL)`
+	args := []any{userID, userID, userID, userID, userID, userID, userID, userID}
+
+	if filter != "" {
+		query += ` AND ` + filter
+		args = append(args, filterArgs...)
+	}
+	if cursor != nil {
+		at := S.db.Timestamp(cursor.CreatedAt)
+		query += ` AND (p.created_at < ? OR (p.created_at = ? AND p.id < ?))`
+		args = append(args, at, at, cursor.ID)
+	}
+	query += ` ORDER BY p.created_at DESC, p.id DESC LIMIT ?`
+	// one extra row tells us whether there is a next page
+	args = append(args, limit+1)
+
+	rows, err := S.db.Query(query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var posts []Post
+	var last FeedCursor
+	for rows.Next() {
+		post, createdAt, err := scanPost(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(posts) == limit {
+			return posts, last.Encode(), rows.Err()
+		}
+		posts = append(posts, post)
+		last = FeedCursor{CreatedAt: createdAt, ID: post.ID}
+	}
+
+	return posts, "", rows.Err()
+}
+
+func (S *Server) GetPostFromID(postID int, r *http.Request) (Post, error) {
+	currentUserID, _ := CurrentUser(r)
+
+	row := S.db.QueryRow(postSelectSQL+`
+	WHERE p.id = ? AND `+visiblePostSQL("p")+`
+		AND (p.shared_post_id IS NULL OR o.id IS NOT NULL)
+`, currentUserID, currentUserID, currentUserID, currentUserID, currentUserID,
+		postID, currentUserID, currentUserID, currentUserID)
+
+	post, _, err := scanPost(row)
+	if err == sql.ErrNoRows {
+		return Post{}, nil // post not found or not visible
+	}
+	return post, err
+}
+
+// EditPostHandler lets the author change the content or image of a post.
+// The replaced version is kept in post_revisions.
+func (S *Server) EditPostHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch && r.Method != http.MethodPut {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, _ := CurrentUser(r)
+	postID := tools.StringToInt(strings.TrimPrefix(r.URL.Path, "/api/edit-post/"))
+
+	var authorID int
+	var content string
+	var image sql.NullString
+	err := S.db.QueryRow(`SELECT user_id, content, image FROM posts WHERE id = ?`, postID).
+		Scan(&authorID, &content, &image)
+	if err == sql.ErrNoRows {
+		tools.SendJSONError(w, "Post not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	if authorID != userID {
+		tools.SendJSONError(w, "You can only edit your own posts", http.StatusForbidden)
+		return
+	}
+
+	var edit PostEdit
+	if err := json.NewDecoder(r.Body).Decode(&edit); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	newContent := content
+	if edit.Content != nil {
+		newContent = html.EscapeString(*edit.Content)
+	}
+	newImage := image
+	if edit.Image != nil {
+		newImage = sql.NullString{String: *edit.Image, Valid: *edit.Image != ""}
+	}
+	// the image can be kept, removed or replaced by one of the author's
+	// uploads, never by a file of someone else that deleting the post would remove
+	if newImage.Valid && newImage != image {
+		owned, err := S.OwnsPostUpload(userID, newImage.String)
 		if err != nil {
-			fmt.Println(err)
 			http.Error(w, "DB Error", http.StatusInternalServerError)
 			return
 		}
-		allPosts = append(allPosts, posts...)
+		if !owned {
+			tools.SendJSONError(w, "Invalid image", http.StatusBadRequest)
+			return
+		}
+	}
+	if strings.TrimSpace(newContent) == "" && !newImage.Valid {
+		http.Error(w, "Content cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	if newContent != content || newImage != image {
+		tx, err := S.db.Begin()
+		if err != nil {
+			http.Error(w, "DB Error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.Exec(`INSERT INTO post_revisions (post_id, content, image) VALUES (?, ?, ?)`,
+			postID, content, image); err != nil {
+			fmt.Println("EditPostHandler revision error:", err)
+			http.Error(w, "DB Error", http.StatusInternalServerError)
+			return
+		}
+		if _, err := tx.Exec(`UPDATE posts SET content = ?, image = ? WHERE id = ?`,
+			newContent, newImage, postID); err != nil {
+			fmt.Println("EditPostHandler update error:", err)
+			http.Error(w, "DB Error", http.StatusInternalServerError)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "DB Error", http.StatusInternalServerError)
+			return
+		}
+		if edit.Content != nil {
+			if err := S.LinkPostTags(postID, userID, *edit.Content); err != nil {
+				fmt.Println("Error linking post tags:", err)
+			}
+		}
+	}
+
+	post, err := S.GetPostFromID(postID, r)
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(post)
+}
+
+// GetPostRevisionsHandler returns the previous versions of a post, newest first,
+// to anyone who can see the post.
+func (S *Server) GetPostRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	postID := tools.StringToInt(strings.TrimPrefix(r.URL.Path, "/api/post-revisions/"))
+
+	post, err := S.GetPostFromID(postID, r)
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	if post.ID == 0 {
+		tools.SendJSONError(w, "Post not found", http.StatusNotFound)
+		return
+	}
+
+	rows, err := S.db.Query(`
+		SELECT id, content, image, created_at
+		FROM post_revisions
+		WHERE post_id = ?
+		ORDER BY created_at DESC, id DESC`, postID)
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
 
+	revisions := []PostRevision{}
+	for rows.Next() {
+		var rev PostRevision
+		if err := rows.Scan(&rev.ID, &rev.Content, &rev.Image, &rev.CreatedAt); err != nil {
+			http.Error(w, "DB Error", http.StatusInternalServerError)
+			return
+		}
+		revisions = append(revisions, rev)
 	}
 
+	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"posts": allPosts,
-		"user": map[string]interface{}{
-			"userID": userID,
-		},
+		"post":      post,
+		"revisions": revisions,
 	})
 }
 
-func (S *Server) UserAllowedToSeePost(userID int, postID int) (bool, error) {
-	query := "SELECT id FROM posts_private WHERE post_id = ? AND user_id = ?"
+// DeletePostHandler removes a post of the current user together with its
+// likes, comments, private audience, revisions and uploaded images.
+func (S *Server) DeletePostHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, _ := CurrentUser(r)
+	postID := tools.StringToInt(strings.TrimPrefix(r.URL.Path, "/api/delete-post/"))
+
+	var authorID int
+	var sharedPostID sql.NullInt64
+	err := S.db.QueryRow(`SELECT user_id, shared_post_id FROM posts WHERE id = ?`, postID).
+		Scan(&authorID, &sharedPostID)
+	if err == sql.ErrNoRows {
+		tools.SendJSONError(w, "Post not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	if authorID != userID {
+		tools.SendJSONError(w, "You can only delete your own posts", http.StatusForbidden)
+		return
+	}
+
+	images, err := S.GetPostImages(postID)
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := S.db.Begin()
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
 
-	var id int
-	err := S.db.QueryRow(query, postID, userID).Scan(&id)
+	// plain reposts go away with the post, quote posts keep their own text
+	reposts, err := S.GetRepostIDs(tx, postID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return false, nil
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	for _, id := range append(reposts, postID) {
+		if err := S.DeletePost(tx, id); err != nil {
+			fmt.Println("DeletePostHandler error:", err)
+			http.Error(w, "DB Error", http.StatusInternalServerError)
+			return
 		}
+	}
+	for _, image := range images {
+		if _, err := tx.Exec(`DELETE FROM post_uploads WHERE path = ?`, image); err != nil {
+			http.Error(w, "DB Error", http.StatusInternalServerError)
+			return
+		}
+	}
+	_, err = tx.Exec(`UPDATE posts SET shared_post_id = NULL WHERE shared_post_id = ?`, postID)
+	if err == nil && sharedPostID.Valid {
+		_, err = tx.Exec(`UPDATE posts SET shares = shares - 1 WHERE id = ? AND shares > 0`, sharedPostID.Int64)
+	}
+	if err != nil {
+		fmt.Println("DeletePostHandler error:", err)
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+
+	for _, image := range images {
+		if err := os.Remove("." + image); err != nil && !os.IsNotExist(err) {
+			fmt.Println("DeletePostHandler remove image error:", err)
+		}
+	}
 
-		return false, err
+	for _, id := range append(reposts, postID) {
+		S.PushPostDeleted(map[string]interface{}{
+			"postId": id,
+		})
 	}
-	return true, nil
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "postId": postID})
 }
 
-func (S *Server) GetPostFromID(postID int, r *http.Request) (Post, error) {
-	currentUserID, _, _ := S.CheckSession(r)
+// DeletePost removes a post and every row that hangs off it
+func (S *Server) DeletePost(tx *Tx, postID int) error {
+	for _, stmt := range []string{
+		`DELETE FROM notification_actors WHERE notification_id IN (SELECT id FROM notifications WHERE post_id = ?)`,
+		`DELETE FROM notifications WHERE post_id = ?`,
+		`DELETE FROM likes WHERE comment_id IN (SELECT id FROM comments WHERE post_id = ?)`,
+		`DELETE FROM likes WHERE post_id = ?`,
+		`DELETE FROM comment_hashtags WHERE comment_id IN (SELECT id FROM comments WHERE post_id = ?)`,
+		`DELETE FROM comment_mentions WHERE comment_id IN (SELECT id FROM comments WHERE post_id = ?)`,
+		`DELETE FROM comment_revisions WHERE comment_id IN (SELECT id FROM comments WHERE post_id = ?)`,
+		`DELETE FROM comments WHERE post_id = ?`,
+		`DELETE FROM post_hashtags WHERE post_id = ?`,
+		`DELETE FROM post_mentions WHERE post_id = ?`,
+		`DELETE FROM posts_private WHERE post_id = ?`,
+		`DELETE FROM post_revisions WHERE post_id = ?`,
+		`DELETE FROM posts WHERE id = ?`,
+	} {
+		if _, err := tx.Exec(stmt, postID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	row := S.db.QueryRow(`
+// GetPostImages lists the files under uploads/Posts used by a post or any of
+// its revisions that the post's author uploaded. External images (gifs) are
+// skipped.
+func (S *Server) GetPostImages(postID int) ([]string, error) {
+	rows, err := S.db.Query(`
+		SELECT pu.path FROM post_uploads pu
+		WHERE pu.user_id = (SELECT user_id FROM posts WHERE id = ?)
+			AND pu.path IN (
+				SELECT image FROM posts WHERE id = ? AND image IS NOT NULL
+				UNION
+				SELECT image FROM post_revisions WHERE post_id = ? AND image IS NOT NULL)`,
+		postID, postID, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var images []string
+	for rows.Next() {
+		var image string
+		if err := rows.Scan(&image); err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(image, "/uploads/Posts/") && !strings.Contains(image, "..") {
+			images = append(images, image)
+		}
+	}
+	return images, rows.Err()
+}
+
+// SharePostHandler reposts a post, or quote-posts it when the body has content.
+// The share can't reach a wider audience than the original post.
+func (S *Server) SharePostHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, _ := CurrentUser(r)
+	targetID := tools.StringToInt(strings.TrimPrefix(r.URL.Path, "/api/share-post/"))
+
+	var post Post
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&post); err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+	}
+
+	original, err := S.GetPostFromID(targetID, r)
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	if original.ID == 0 {
+		tools.SendJSONError(w, "Post not found", http.StatusNotFound)
+		return
+	}
+	// sharing a plain repost shares the post it points to
+	if original.SharedPost != nil && original.Content == "" && original.Image == nil {
+		original = *original.SharedPost
+	}
+	if original.GroupID != 0 {
+		tools.SendJSONError(w, "Group posts can't be shared", http.StatusBadRequest)
+		return
+	}
+
+	if post.Privacy == "" {
+		post.Privacy = original.Privacy
+	}
+	rank, ok := privacyRank[post.Privacy]
+	if !ok {
+		tools.SendJSONError(w, "Invalid privacy", http.StatusBadRequest)
+		return
+	}
+	if rank < privacyRank[original.Privacy] {
+		tools.SendJSONError(w, "This post can't be shared to a wider audience", http.StatusForbidden)
+		return
+	}
+
+	content := html.EscapeString(strings.TrimSpace(post.Content))
+	if content == "" {
+		var reposted bool
+		err := S.db.QueryRow(`
+			SELECT EXISTS(SELECT 1 FROM posts
+			WHERE user_id = ? AND shared_post_id = ? AND content = '' AND image IS NULL)`,
+			userID, original.ID).Scan(&reposted)
+		if err != nil {
+			http.Error(w, "DB Error", http.StatusInternalServerError)
+			return
+		}
+		if reposted {
+			tools.SendJSONError(w, "You already reposted this post", http.StatusConflict)
+			return
+		}
+	}
+
+	tx, err := S.db.Begin()
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var shareID int
+	err = tx.QueryRow(`
+		INSERT INTO posts (user_id, content, privacy, shared_post_id)
+		VALUES (?, ?, ?, ?)
+		RETURNING id`,
+		userID, content, post.Privacy, original.ID,
+	).Scan(&shareID)
+	if err != nil {
+		fmt.Println("Error inserting share:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if post.Privacy == "private" {
+		for _, followerID := range post.SelectedFollowers {
+			if _, err := tx.Exec(`INSERT INTO posts_private (post_id, user_id) VALUES (?, ?)`,
+				shareID, followerID); err != nil {
+				fmt.Println("Error inserting follower:", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+	if _, err := tx.Exec(`UPDATE posts SET shares = shares + 1 WHERE id = ?`, original.ID); err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+
+	if original.UserID != userID {
+		notification := Notification{ID: original.UserID, ActorID: userID, Type: "share", Content: "Shared Your Post", IsRead: false, PostID: original.ID}
+		if content != "" {
+			notification.Content = "Quoted Your Post"
+		}
+		S.IsertNotification(notification)
+		S.PushNotification("-new", original.UserID, notification)
+	}
+
+	if err := S.LinkPostTags(shareID, userID, post.Content); err != nil {
+		fmt.Println("Error linking post tags:", err)
+	}
+
+	share, err := S.GetPostFromID(shareID, r)
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+
+	S.PushNewPost(userID, map[string]interface{}{
+		"post": share,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(share)
+}
+
+// privacyRank orders the post audiences from the widest to the narrowest
+var privacyRank = map[string]int{
+	"public":         0,
+	"almost-private": 1,
+	"private":        2,
+}
+
+// postSelectSQL reads a post p with its author u and the post o it shares
+// with that post's author ou. Only one level is read: a plain repost already
+// points at the original, and a quote of a quote shows the quote it shares
+// without going further. o is only joined when the viewer may read it, so
+// o.id is NULL for a share of a post the viewer can't see. The query takes
+// the viewer id five times; the WHERE clause is appended by the caller.
+var postSelectSQL = `
 	SELECT 
-		p.id, p.content, p.image, p.created_at, p.privacy, p.group_id,
+		p.id, p.content, p.image, p.created_at, p.privacy, p.group_id, p.shares,
 		u.id, u.first_name, u.last_name, u.nickname, u.avatar, u.is_private,
 		(SELECT COUNT(*) FROM likes l WHERE l.post_id = p.id) as like_count,
-		(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id AND c.parent_comment_id IS NULL) as comment_count,
-		EXISTS(SELECT 1 FROM likes l WHERE l.post_id = p.id AND l.user_id = ?) as is_liked
+		p.comments as comment_count,
+		EXISTS(SELECT 1 FROM likes l WHERE l.post_id = p.id AND l.user_id = ?) as is_liked,
+		EXISTS(SELECT 1 FROM post_revisions pr WHERE pr.post_id = p.id) as is_edited,
+		o.id, o.content, o.image, o.created_at, o.privacy, o.group_id, o.shares,
+		ou.id, ou.first_name, ou.last_name, ou.nickname, ou.avatar, ou.is_private,
+		(SELECT COUNT(*) FROM likes l WHERE l.post_id = o.id) as shared_like_count,
+		o.comments as shared_comment_count,
+		EXISTS(SELECT 1 FROM likes l WHERE l.post_id = o.id AND l.user_id = ?) as shared_is_liked,
+		EXISTS(SELECT 1 FROM post_revisions pr WHERE pr.post_id = o.id) as shared_is_edited
 	FROM posts p
 	JOIN users u ON p.user_id = u.id
-	WHERE p.id = ?
-`, currentUserID, postID)
+	LEFT JOIN posts o ON o.id = p.shared_post_id AND ` + visiblePostSQL("o") + `
+	LEFT JOIN users ou ON ou.id = o.user_id`
 
+// scanPost reads a row of postSelectSQL and returns the post and its creation time
+func scanPost(row interface{ Scan(...any) error }) (Post, time.Time, error) {
 	var post Post
-	var authorID int
+	var createdAt time.Time
 	var firstName, lastName, nickname, avatar sql.NullString
-	var isPrivate bool
 	var groupID sql.NullInt64
 
+	var sharedID, sharedGroupID, sharedShares, sharedAuthorID, sharedLikes, sharedComments sql.NullInt64
+	var sharedContent, sharedImage, sharedPrivacy sql.NullString
+	var sharedFirstName, sharedLastName, sharedNickname, sharedAvatar sql.NullString
+	var sharedCreatedAt sql.NullTime
+	var sharedAuthorPrivate, sharedIsLiked, sharedIsEdited sql.NullBool
+
 	err := row.Scan(
-		&post.ID, &post.Content, &post.Image, &post.CreatedAt, &post.Privacy, &groupID,
-		&authorID, &firstName, &lastName, &nickname, &avatar, &isPrivate,
-		&post.Likes, &post.Comments, &post.IsLiked,
+		&post.ID, &post.Content, &post.Image, &createdAt, &post.Privacy, &groupID, &post.Shares,
+		&post.UserID, &firstName, &lastName, &nickname, &avatar, &post.Author.IsPrivate,
+		&post.Likes, &post.Comments, &post.IsLiked, &post.IsEdited,
+		&sharedID, &sharedContent, &sharedImage, &sharedCreatedAt, &sharedPrivacy, &sharedGroupID, &sharedShares,
+		&sharedAuthorID, &sharedFirstName, &sharedLastName, &sharedNickname, &sharedAvatar, &sharedAuthorPrivate,
+		&sharedLikes, &sharedComments, &sharedIsLiked, &sharedIsEdited,
 	)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return Post{}, nil // post not found
-		}
-		return Post{}, err
+		return Post{}, time.Time{}, err
 	}
 
-	if groupID.Valid {
-		post.GroupID = int(groupID.Int64)
-	}
+	post.GroupID = int(groupID.Int64)
+	post.CreatedAt = createdAt.Format(time.RFC3339)
+	post.Author.ID = post.UserID
+	post.Author.Name = firstName.String + " " + lastName.String
+	post.Author.Username = nickname.String
+	post.Author.Avatar = avatar.String
 
-	// privacy check
-	if post.Privacy == "almost-private" && authorID != currentUserID {
-		isFollowing, err := S.IsFollowing(r, "", strconv.Itoa(authorID))
-		if err != nil {
-			return Post{}, err
-		}
-		if !isFollowing {
-			return Post{}, nil
-		}
-	} else if post.Privacy == "private" {
-		UserAllowed, err := S.UserAllowedToSeePost(currentUserID, post.ID)
-		if err != nil {
-			return Post{}, err
-		}
-		if authorID != currentUserID && !UserAllowed {
-			return Post{}, nil
-		}
+	if !sharedID.Valid {
+		return post, createdAt, nil
 	}
-
-	// convert NullString
-	post.Author = Author{
-		Name:      firstName.String + " " + lastName.String,
-		Username:  nickname.String,
-		Avatar:    avatar.String,
-		IsPrivate: isPrivate,
+	post.SharedPost = &Post{
+		ID:        int(sharedID.Int64),
+		UserID:    int(sharedAuthorID.Int64),
+		GroupID:   int(sharedGroupID.Int64),
+		Content:   sharedContent.String,
+		Privacy:   sharedPrivacy.String,
+		CreatedAt: sharedCreatedAt.Time.Format(time.RFC3339),
+		Likes:     int(sharedLikes.Int64),
+		Comments:  int(sharedComments.Int64),
+		Shares:    int(sharedShares.Int64),
+		IsLiked:   sharedIsLiked.Bool,
+		IsEdited:  sharedIsEdited.Bool,
+		Author: Author{
+			ID:        int(sharedAuthorID.Int64),
+			Name:      sharedFirstName.String + " " + sharedLastName.String,
+			Username:  sharedNickname.String,
+			Avatar:    sharedAvatar.String,
+			IsPrivate: sharedAuthorPrivate.Bool,
+		},
 	}
-	post.UserID = authorID
-	post.Comments = 0
-	post.Shares = 0
+	if sharedImage.Valid {
+		post.SharedPost.Image = &sharedImage.String
+	}
+	return post, createdAt, nil
+}
 
-	return post, nil
+// GetRepostIDs returns the plain reposts (no text of their own) of a post
+func (S *Server) GetRepostIDs(tx *Tx, postID int) ([]int, error) {
+	rows, err := tx.Query(`
+		SELECT id FROM posts
+		WHERE shared_post_id = ? AND content = '' AND image IS NULL`, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
 }
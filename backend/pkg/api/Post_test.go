@@ -0,0 +1,250 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+)
+
+// createPost posts body to path as user and returns the new post's id
+func createPost(t *testing.T, S *Server, user testUser, path string, body map[string]any) int {
+	t.Helper()
+	rec := do(t, S, &user, http.MethodPost, path, body)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("%s: got %d %s", path, rec.Code, rec.Body)
+	}
+	var post Post
+	if err := json.NewDecoder(rec.Body).Decode(&post); err != nil || post.ID == 0 {
+		t.Fatalf("%s: no post in %s", path, rec.Body)
+	}
+	return post.ID
+}
+
+// viewerRequest is a request made by userID as WithAuth leaves it
+func viewerRequest(userID int) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	return r.WithContext(context.WithValue(r.Context(), userIDKey, userID))
+}
+
+// postIDs returns the ids of posts and of the posts they share, 0 when none
+func postIDs(posts []Post) map[int]int {
+	ids := make(map[int]int)
+	for _, p := range posts {
+		ids[p.ID] = 0
+		if p.SharedPost != nil {
+			ids[p.ID] = p.SharedPost.ID
+		}
+	}
+	return ids
+}
+
+func TestSharedPostsOneLevel(t *testing.T) {
+	S := newTestServer(t)
+	alice := createTestUser(t, S, "alice", false)
+	bob := createTestUser(t, S, "bob", false)
+	carol := createTestUser(t, S, "carol", false)
+
+	original := createPost(t, S, alice, "/api/create-post", map[string]any{"content": "hello", "privacy": "public"})
+	repost := createPost(t, S, bob, "/api/share-post/"+strconv.Itoa(original), nil)
+	quote := createPost(t, S, bob, "/api/share-post/"+strconv.Itoa(original), map[string]any{"content": "look"})
+	quoteOfQuote := createPost(t, S, carol, "/api/share-post/"+strconv.Itoa(quote), map[string]any{"content": "wow"})
+	// sharing a plain repost shares its original
+	repostOfRepost := createPost(t, S, carol, "/api/share-post/"+strconv.Itoa(repost), nil)
+
+	posts, _, err := S.GetFeedPage(viewerRequest(carol.ID), nil, 10, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]int{original: 0, repost: original, quote: original, quoteOfQuote: quote, repostOfRepost: original}
+	got := postIDs(posts)
+	if len(got) != len(want) {
+		t.Fatalf("feed = %v, want %v", got, want)
+	}
+	for id, shared := range want {
+		if got[id] != shared {
+			t.Errorf("post %d shares %d, want %d", id, got[id], shared)
+		}
+	}
+
+	post, err := S.GetPostFromID(quoteOfQuote, viewerRequest(alice.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.SharedPost == nil || post.SharedPost.ID != quote {
+		t.Fatalf("quote of a quote shares %+v, want post %d", post.SharedPost, quote)
+	}
+	if post.SharedPost.SharedPost != nil {
+		t.Errorf("shared post is resolved past one level")
+	}
+	shared := post.SharedPost
+	if shared.Content != "look" || shared.Author.ID != bob.ID || shared.Author.Username != "bob" || shared.Shares != 1 {
+		t.Errorf("shared post = %+v", *shared)
+	}
+
+	if post, _ := S.GetPostFromID(original, viewerRequest(carol.ID)); post.Shares != 3 || post.SharedPost != nil {
+		t.Errorf("original = %+v, want 3 shares and nothing shared", post)
+	}
+}
+
+func TestSharedPostHiddenWithOriginal(t *testing.T) {
+	S := newTestServer(t)
+	alice := createTestUser(t, S, "alice", false)
+	bob := createTestUser(t, S, "bob", false)
+	carol := createTestUser(t, S, "carol", false)
+
+	// only bob may see alice's post, and bob shares it with carol
+	secret := createPost(t, S, alice, "/api/create-post", map[string]any{
+		"content": "secret", "privacy": "private", "selectedFollowers": []string{strconv.Itoa(bob.ID)},
+	})
+	share := createPost(t, S, bob, "/api/share-post/"+strconv.Itoa(secret), map[string]any{
+		"content": "see this", "privacy": "private", "selectedFollowers": []string{strconv.Itoa(carol.ID)},
+	})
+	public := createPost(t, S, bob, "/api/create-post", map[string]any{"content": "hi", "privacy": "public"})
+
+	for _, tt := range []struct {
+		viewer testUser
+		want   map[int]int
+	}{
+		{bob, map[int]int{share: secret, public: 0}},
+		{carol, map[int]int{public: 0}},
+	} {
+		r := viewerRequest(tt.viewer.ID)
+		feed, _, err := S.GetFeedPage(r, nil, 10, "p.user_id = ?", bob.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		profile, err := S.GetUserPosts(bob.ID, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, posts := range map[string][]Post{"feed": feed, "profile": profile} {
+			got := postIDs(posts)
+			if len(got) != len(tt.want) {
+				t.Errorf("%s of user %d = %v, want %v", name, tt.viewer.ID, got, tt.want)
+				continue
+			}
+			for id, shared := range tt.want {
+				if s, ok := got[id]; !ok || s != shared {
+					t.Errorf("%s of user %d = %v, want %v", name, tt.viewer.ID, got, tt.want)
+					break
+				}
+			}
+		}
+
+		post, err := S.GetPostFromID(share, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if visible := post.ID != 0; visible != (tt.viewer.ID == bob.ID) {
+			t.Errorf("user %d sees the share: %v", tt.viewer.ID, visible)
+		}
+	}
+}
+
+// uploadPostFile uploads an image as user and returns its url
+func uploadPostFile(t *testing.T, S *Server, user testUser) string {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("post", "picture.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte("not really a png"))
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/upload-post-file", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.AddCookie(user.Session)
+	rec := httptest.NewRecorder()
+	S.mux.ServeHTTP(rec, req)
+	var res struct {
+		PostURL string `json:"postUrl"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("upload: got %d %v", rec.Code, err)
+	}
+	return res.PostURL
+}
+
+func TestPostImageMustBeOwnUpload(t *testing.T) {
+	S := newTestServer(t)
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll("uploads/Posts", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	alice := createTestUser(t, S, "alice", false)
+	bob := createTestUser(t, S, "bob", false)
+
+	aliceImage := uploadPostFile(t, S, alice)
+	createPost(t, S, alice, "/api/create-post", map[string]any{"content": "mine", "privacy": "public", "image": aliceImage})
+	bobImage := uploadPostFile(t, S, bob)
+
+	for _, image := range []string{aliceImage, "/uploads/Avatars/x.png", "/../main.go", "javascript:alert(1)"} {
+		rec := do(t, S, &bob, http.MethodPost, "/api/create-post", map[string]any{"content": "x", "privacy": "public", "image": image})
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("create with image %q: got %d, want %d", image, rec.Code, http.StatusBadRequest)
+		}
+	}
+	// gifs from the picker are links
+	createPost(t, S, bob, "/api/create-post", map[string]any{"content": "gif", "privacy": "public", "image": "https://media.tenor.com/a.gif"})
+	post := createPost(t, S, bob, "/api/create-post", map[string]any{"content": "x", "privacy": "public", "image": bobImage})
+	edit := "/api/edit-post/" + strconv.Itoa(post)
+
+	for _, image := range []string{aliceImage, "https://media.tenor.com/a.gif"} {
+		rec := do(t, S, &bob, http.MethodPatch, edit, map[string]any{"image": image})
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("edit to image %q: got %d, want %d", image, rec.Code, http.StatusBadRequest)
+		}
+	}
+	for _, image := range []string{bobImage, "", bobImage} {
+		if rec := do(t, S, &bob, http.MethodPatch, edit, map[string]any{"image": image}); rec.Code != http.StatusOK {
+			t.Errorf("edit to image %q: got %d %s", image, rec.Code, rec.Body)
+		}
+	}
+
+	// a post that got hold of someone else's file before uploads were
+	// tracked doesn't take it along when deleted
+	var hijacked int
+	if err := S.db.QueryRow(`INSERT INTO posts (user_id, content, image, privacy) VALUES (?, 'x', ?, 'public') RETURNING id`,
+		bob.ID, aliceImage).Scan(&hijacked); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []int{hijacked, post} {
+		if rec := do(t, S, &bob, http.MethodDelete, "/api/delete-post/"+strconv.Itoa(id), nil); rec.Code != http.StatusOK {
+			t.Fatalf("delete: got %d %s", rec.Code, rec.Body)
+		}
+	}
+	if _, err := os.Stat("." + aliceImage); err != nil {
+		t.Errorf("alice's image is gone: %v", err)
+	}
+	if _, err := os.Stat("." + bobImage); !os.IsNotExist(err) {
+		t.Errorf("bob's image is still there: %v", err)
+	}
+}
+
+func TestCreatePostOnEveryDriver(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, S *Server) {
+		alice := createTestUser(t, S, "alice", false)
+		first := createPost(t, S, alice, "/api/create-post", map[string]any{"content": "first", "privacy": "public"})
+		second := createPost(t, S, alice, "/api/create-post", map[string]any{"content": "second", "privacy": "public"})
+		group := createGroup(t, S, alice, "hikers")
+		inGroup := createPost(t, S, alice, "/api/groups/posts/create", map[string]any{"content": "trail", "groupId": group})
+
+		// the ids handed back are the ones the rows got
+		for content, id := range map[string]int{"first": first, "second": second, "trail": inGroup} {
+			if n := count(t, S, `SELECT COUNT(*) FROM posts WHERE id = ? AND content = ?`, id, content); n != 1 {
+				t.Errorf("post %q is not at id %d", content, id)
+			}
+		}
+		if n := count(t, S, `SELECT COUNT(*) FROM groups WHERE id = ? AND title = 'hikers'`, group); n != 1 {
+			t.Errorf("group is not at id %d", group)
+		}
+	})
+}
@@ -5,13 +5,20 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"html"
 	"io"
+	"log"
 	"net/http"
+	"net/mail"
 	"os"
+	"path"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/twinj/uuid"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func (S *Server) ProfileHandler(w http.ResponseWriter, r *http.Request) {
@@ -92,6 +99,25 @@ func (S *Server) ProfileHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
+
+const (
+	defaultAvatar = "/uploads/default.jpg"
+	avatarsDir    = "/uploads/Avatars"
+)
+
+// ValidAvatarPath reports whether avatar is the default picture or a file
+// directly in the avatars folder, as returned by UploadAvatarHandler
+func ValidAvatarPath(avatar string) bool {
+	if avatar == defaultAvatar {
+		return true
+	}
+	if strings.Contains(avatar, "..") || filepath.Clean(avatar) != avatar {
+		return false
+	}
+	dir, name := path.Split(avatar)
+	return dir == avatarsDir+"/" && name != ""
+}
+
 func (S *Server) UploadAvatarHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Printf("called AvatarHandeler")
 	if r.Method != http.MethodPost {
@@ -121,39 +147,255 @@ func (S *Server) UploadAvatarHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// uploads made while registering have no owner until the account claims them
+	var owner any
+	if userID, _ := CurrentUser(r); userID != 0 {
+		owner = userID
+	}
+	if _, err := S.db.Exec(`INSERT INTO avatar_uploads (user_id, path) VALUES (?, ?)`, owner, "/"+avatarPath); err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.Write([]byte(fmt.Sprintf(`{"avatarUrl": "/%s"}`, avatarPath)))
 }
+
+// ClaimAvatarUpload makes avatar userID's if it is the default picture, one
+// of their uploads, or an upload nobody has claimed yet. It reports false for
+// anything else, such as another user's avatar.
+func (S *Server) ClaimAvatarUpload(userID int, avatar string) (bool, error) {
+	if avatar == defaultAvatar {
+		return true, nil
+	}
+	if !ValidAvatarPath(avatar) {
+		return false, nil
+	}
+	res, err := S.db.Exec(`UPDATE avatar_uploads SET user_id = ? WHERE path = ? AND (user_id IS NULL OR user_id = ?)`,
+		userID, avatar, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// UpdateProfileHandler applies a partial update to the session user's profile.
+// Only the fields present in the body are changed.
 func (S *Server) UpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPut {
+	if r.Method != http.MethodPatch && r.Method != http.MethodPut {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var user UserData
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		http.Error(w, "Bad Request", http.StatusBadRequest)
+	currentUserID, _ := CurrentUser(r)
+
+	var update ProfileUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		tools.SendJSONError(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
 
-	id, _ := strconv.Atoi(user.ID)
-	err := S.RemoveOldAvatar(id, *user.Avatar)
+	current, err := S.GetUserData("", currentUserID)
 	if err != nil {
-		http.Error(w, "Failed to remove old avatar", http.StatusInternalServerError)
+		tools.SendJSONError(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	var sets []string
+	var args []interface{}
+	set := func(column string, value interface{}) {
+		sets = append(sets, column+" = ?")
+		args = append(args, value)
+	}
+
+	if update.FirstName != nil {
+		firstName := strings.TrimSpace(*update.FirstName)
+		if firstName == "" {
+			tools.SendJSONError(w, "First name cannot be empty", http.StatusBadRequest)
+			return
+		}
+		set("first_name", html.EscapeString(firstName))
+	}
+	if update.LastName != nil {
+		lastName := strings.TrimSpace(*update.LastName)
+		if lastName == "" {
+			tools.SendJSONError(w, "Last name cannot be empty", http.StatusBadRequest)
+			return
+		}
+		set("last_name", html.EscapeString(lastName))
+	}
+	if update.AboutMe != nil {
+		if aboutMe := strings.TrimSpace(*update.AboutMe); aboutMe == "" {
+			set("about_me", nil)
+		} else {
+			set("about_me", html.EscapeString(aboutMe))
+		}
+	}
+	if update.IsPrivate != nil {
+		set("is_private", *update.IsPrivate)
+	}
+	if update.DateOfBirth != nil && *update.DateOfBirth != current.DateOfBirth {
+		if _, err := time.Parse("2006-01-02T15:04:05.000Z", *update.DateOfBirth); err != nil {
+			tools.SendJSONError(w, "Invalid date of birth", http.StatusBadRequest)
+			return
+		}
+		set("birthdate", html.EscapeString(*update.DateOfBirth))
+		set("age", tools.GetAge(*update.DateOfBirth))
+	}
+
+	email := current.Email
+	emailChanged := false
+	if update.Email != nil {
+		email = tools.ToLower(strings.TrimSpace(*update.Email))
+		emailChanged = email != current.Email
+	}
+	if emailChanged {
+		if _, err := mail.ParseAddress(email); err != nil || !strings.Contains(email, "@") {
+			tools.SendJSONError(w, "Invalid email", http.StatusBadRequest)
+			return
+		}
+		taken, err := S.ProfileValueTaken(r.Context(), currentUserID, "email", email)
+		if err != nil {
+			tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if taken {
+			tools.SendJSONError(w, "Email already in use", http.StatusConflict)
+			return
+		}
+		set("email", html.EscapeString(email))
+		// the new address has to be verified again
+		set("email_verified_at", nil)
+	}
+
+	// the profile url follows the nickname, or the email name when there is none
+	if update.Nickname != nil || emailChanged {
+		nickname := ""
+		if current.Nickname != nil {
+			nickname = *current.Nickname
+		}
+		if update.Nickname != nil {
+			nickname = strings.TrimSpace(*update.Nickname)
+		}
+
+		url := nickname
+		if url == "" {
+			url = tools.ToUsername(email)
+		}
+
+		if update.Nickname != nil && nickname != "" {
+			taken, err := S.ProfileValueTaken(r.Context(), currentUserID, "nickname", nickname)
+			if err != nil {
+				tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if taken {
+				tools.SendJSONError(w, "Nickname already taken", http.StatusConflict)
+				return
+			}
+		}
+		if url != current.Url {
+			taken, err := S.ProfileValueTaken(r.Context(), currentUserID, "url", url)
+			if err != nil {
+				tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if taken {
+				tools.SendJSONError(w, "Nickname already taken", http.StatusConflict)
+				return
+			}
+		}
+
+		if update.Nickname != nil {
+			if nickname == "" {
+				set("nickname", nil)
+			} else {
+				set("nickname", html.EscapeString(nickname))
+			}
+		}
+		set("url", html.EscapeString(url))
+	}
+
+	passwordChanged := update.Password != nil && *update.Password != ""
+	if passwordChanged && len(*update.Password) < 8 {
+		tools.SendJSONError(w, "Password must be at least 8 characters long", http.StatusBadRequest)
 		return
 	}
 
-	if user.Nickname != nil {
-		user.Url = *user.Nickname
+	// email and password changes need the current password
+	if emailChanged || passwordChanged {
+		if update.CurrentPassword == "" {
+			tools.SendJSONError(w, "Current password is required", http.StatusForbidden)
+			return
+		}
+		var hashedPassword string
+		err := S.db.QueryRowContext(r.Context(), `SELECT password FROM users WHERE id = ?`, currentUserID).Scan(&hashedPassword)
+		if err != nil {
+			tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if err := tools.CheckPassword(hashedPassword, update.CurrentPassword); err != nil {
+			tools.SendJSONError(w, "Current password is incorrect", http.StatusForbidden)
+			return
+		}
+	}
+	if passwordChanged {
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(*update.Password), bcrypt.DefaultCost)
+		if err != nil {
+			tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		set("password", string(hashedPassword))
+	}
+
+	if update.Avatar != nil && (current.Avatar == nil || *update.Avatar != *current.Avatar) {
+		avatar := *update.Avatar
+		if avatar == "" {
+			avatar = defaultAvatar
+		}
+		claimed, err := S.ClaimAvatarUpload(currentUserID, avatar)
+		if err != nil {
+			http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !claimed {
+			tools.SendJSONError(w, "Invalid avatar", http.StatusBadRequest)
+			return
+		}
+		set("avatar", html.EscapeString(avatar))
+	}
+
+	if len(sets) > 0 {
+		args = append(args, currentUserID)
+		_, err = S.db.ExecContext(r.Context(),
+			`UPDATE users SET `+strings.Join(sets, ", ")+` WHERE id = ?`, args...)
+		if err != nil {
+			fmt.Println("update profile error : ", err)
+			tools.SendJSONError(w, "Failed to update user", http.StatusInternalServerError)
+			return
+		}
+	}
+	// the old picture goes only once nothing points at it anymore
+	if update.Avatar != nil && current.Avatar != nil && *current.Avatar != *update.Avatar {
+		if err := S.RemoveOldAvatar(currentUserID, *current.Avatar); err != nil {
+			log.Printf("Error removing old avatar: %v", err)
+		}
 	}
-	_, err = S.db.ExecContext(r.Context(), `
-        UPDATE users
-        SET first_name = ?, last_name = ?, nickname = ?, email = ?, birthdate = ?, avatar = ?, about_me = ?, is_private = ?, url = ?
-		WHERE id = ?
-	`, user.FirstName, user.LastName, user.Nickname, user.Email, user.DateOfBirth, user.Avatar, user.AboutMe, user.IsPrivate, user.Url, user.ID,
-	)
+	if emailChanged {
+		if err := S.SendEmailVerification(currentUserID); err != nil {
+			log.Printf("Error sending verification email: %v", err)
+		}
+	}
+	if emailChanged || passwordChanged {
+		if err := S.RotateSession(w, r); err != nil {
+			log.Printf("Error rotating session: %v", err)
+		}
+	}
+
+	user, err := S.GetUserData("", currentUserID)
 	if err != nil {
-		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
@@ -163,6 +405,17 @@ func (S *Server) UpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
 		"user":    user,
 	})
 }
+
+// ProfileValueTaken reports whether another user already uses value in column
+// (email, nickname or url).
+func (S *Server) ProfileValueTaken(ctx context.Context, userID int, column, value string) (bool, error) {
+	var exists int
+	query := `SELECT COUNT(*) FROM users WHERE ` + column + ` = ? AND id <> ?`
+	if err := S.db.QueryRowContext(ctx, query, html.EscapeString(value), userID).Scan(&exists); err != nil {
+		return false, err
+	}
+	return exists > 0, nil
+}
 func (S *Server) UserFound(user User, cnx context.Context) (error, bool) {
 	var exists int
 	var query string
@@ -187,24 +440,23 @@ func (S *Server) UserFound(user User, cnx context.Context) (error, bool) {
 	}
 	return nil, false
 }
-func (S *Server) RemoveOldAvatar(userID int, newAvatar string) error {
-	// Get the avatar filename from the database
-	var oldAvatar string
-	err := S.db.QueryRow(`SELECT avatar FROM users WHERE id = ?`, userID).Scan(&oldAvatar)
+
+// RemoveOldAvatar deletes oldAvatar once userID no longer uses it. Only files
+// the user uploaded are deleted, and never while any account still has them.
+func (S *Server) RemoveOldAvatar(userID int, oldAvatar string) error {
+	if oldAvatar == defaultAvatar || !ValidAvatarPath(oldAvatar) {
+		return nil
+	}
+	res, err := S.db.Exec(`DELETE FROM avatar_uploads WHERE path = ? AND user_id = ?
+		AND NOT EXISTS (SELECT 1 FROM users WHERE avatar = ?)`, oldAvatar, userID, oldAvatar)
 	if err != nil {
 		return err
 	}
-
-	if oldAvatar == "/uploads/default.jpg" || oldAvatar == newAvatar {
-		return nil
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return err
 	}
-	// Remove the avatar file from uploads folder if it exists and is not empty
-	if oldAvatar != "" {
-		avatarPath := fmt.Sprintf(".%s", oldAvatar)
-		if err := os.Remove(avatarPath); err != nil && !os.IsNotExist(err) {
-			return err
-		}
+	if err := os.Remove("." + oldAvatar); err != nil && !os.IsNotExist(err) {
+		return err
 	}
-
 	return nil
 }
@@ -0,0 +1,136 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestValidAvatarPath(t *testing.T) {
+	tests := []struct {
+		avatar string
+		want   bool
+	}{
+		{"/uploads/default.jpg", true},
+		{"/uploads/Avatars/0b6f5c1e.png", true},
+		{"/uploads/Avatars/", false},
+		{"/uploads/Avatars/../../main.go", false},
+		{"/uploads/Avatars/..", false},
+		{"/uploads/Avatars//a.png", false},
+		{"/uploads/Avatars/sub/a.png", false},
+		{"/uploads/Posts/a.png", false},
+		{"uploads/Avatars/a.png", false},
+		{"/etc/passwd", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := ValidAvatarPath(tt.avatar); got != tt.want {
+			t.Errorf("ValidAvatarPath(%q) = %v, want %v", tt.avatar, got, tt.want)
+		}
+	}
+}
+
+// uploadAvatar uploads a picture as user, or while signed out when user is
+// nil, and returns its path
+func uploadAvatar(t *testing.T, S *Server, user *testUser) string {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("avatar", "me.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte("not really a png"))
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/upload-avatar", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if user != nil {
+		req.AddCookie(user.Session)
+	}
+	rec := httptest.NewRecorder()
+	S.mux.ServeHTTP(rec, req)
+	var res struct {
+		AvatarURL string `json:"avatarUrl"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("upload: got %d %v", rec.Code, err)
+	}
+	return res.AvatarURL
+}
+
+func TestAvatarMustBeOwnUpload(t *testing.T) {
+	S := newTestServer(t)
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll("uploads/Avatars", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	alice := createTestUser(t, S, "alice", false)
+	bob := createTestUser(t, S, "bob", false)
+
+	setAvatar := func(user testUser, avatar string) int {
+		t.Helper()
+		return do(t, S, &user, http.MethodPatch, "/api/user/update", map[string]string{"avatar": avatar}).Code
+	}
+	exists := func(avatar string) bool {
+		t.Helper()
+		_, err := os.Stat("." + avatar)
+		return err == nil
+	}
+
+	first := uploadAvatar(t, S, &alice)
+	if code := setAvatar(bob, first); code != http.StatusBadRequest {
+		t.Errorf("bob took alice's upload: got %d", code)
+	}
+	if code := setAvatar(alice, first); code != http.StatusOK {
+		t.Fatalf("alice set her upload: got %d", code)
+	}
+	// once it's hers nobody else can use it, even after she moves on
+	second := uploadAvatar(t, S, &alice)
+	if code := setAvatar(alice, second); code != http.StatusOK {
+		t.Fatalf("alice set her second upload: got %d", code)
+	}
+	if exists(first) || !exists(second) {
+		t.Errorf("after the change: first there %v, second there %v", exists(first), exists(second))
+	}
+	if code := setAvatar(bob, second); code != http.StatusBadRequest {
+		t.Errorf("bob took alice's second upload: got %d", code)
+	}
+
+	// a file another account still shows is kept
+	if _, err := S.db.Exec(`UPDATE users SET avatar = ? WHERE id = ?`, second, bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	if code := setAvatar(alice, ""); code != http.StatusOK {
+		t.Fatalf("alice went back to the default: got %d", code)
+	}
+	if !exists(second) {
+		t.Error("removed an avatar bob still has")
+	}
+
+	// an upload made while registering goes to the account that registers with it
+	register := func(name, avatar string) int {
+		t.Helper()
+		return do(t, S, nil, http.MethodPost, "/api/register", User{
+			Email: name + "@example.com", Password: "pass1234", FirstName: name, LastName: "Test",
+			DateOfBirth: "2000-01-01T00:00:00.000Z", Gender: "other", Nickname: name, AvatarUrl: avatar,
+		}).Code
+	}
+	signup := uploadAvatar(t, S, nil)
+	if code := register("carol", signup); code != http.StatusCreated {
+		t.Fatalf("carol registered: got %d", code)
+	}
+	if n := count(t, S, `SELECT COUNT(*) FROM users WHERE email = 'carol@example.com' AND avatar = ?`, signup); n != 1 {
+		t.Error("carol doesn't have her avatar")
+	}
+	if code := register("dave", signup); code != http.StatusBadRequest {
+		t.Errorf("dave registered with carol's avatar: got %d", code)
+	}
+	if code := setAvatar(bob, signup); code != http.StatusBadRequest {
+		t.Errorf("bob took carol's avatar: got %d", code)
+	}
+}
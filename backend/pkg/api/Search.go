@@ -0,0 +1,253 @@
+package backend
+
+import (
+	tools "SOCIAL-NETWORK/pkg"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultSearchPageSize = 10
+	maxSearchPageSize     = 50
+	maxSearchTerms        = 8
+)
+
+var searchTermPattern = regexp.MustCompile(`[\p{L}\p{N}_]+`)
+
+// SearchHandler runs a ranked full-text search.
+// ?q= is the text, ?type= a comma separated list of users, posts and groups
+// (all of them when empty), ?page= starts at 1 and ?limit= is the page size.
+func (S *Server) SearchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	terms := searchTermPattern.FindAllString(strings.ToLower(query.Get("q")), -1)
+	if len(terms) == 0 {
+		tools.SendJSONError(w, "Search text required", http.StatusBadRequest)
+		return
+	}
+	if len(terms) > maxSearchTerms {
+		terms = terms[:maxSearchTerms]
+	}
+
+	types := map[string]bool{"users": true, "posts": true, "groups": true}
+	if v := query.Get("type"); v != "" {
+		types = map[string]bool{}
+		for _, t := range strings.Split(v, ",") {
+			t = strings.TrimSpace(t)
+			if t != "users" && t != "posts" && t != "groups" {
+				tools.SendJSONError(w, "Invalid search type "+t, http.StatusBadRequest)
+				return
+			}
+			types[t] = true
+		}
+	}
+
+	page, limit := 1, defaultSearchPageSize
+	if v := query.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			tools.SendJSONError(w, "Invalid page", http.StatusBadRequest)
+			return
+		}
+		page = n
+	}
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			tools.SendJSONError(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxSearchPageSize)
+	}
+	offset := (page - 1) * limit
+
+	result := map[string]interface{}{"page": page}
+	hasMore := map[string]bool{}
+
+	if types["users"] {
+		users, more, err := S.SearchUsers(terms, limit, offset)
+		if err != nil {
+			fmt.Println("SearchUsers error:", err)
+			http.Error(w, "DB Error", http.StatusInternalServerError)
+			return
+		}
+		result["users"], hasMore["users"] = users, more
+	}
+	if types["posts"] {
+		posts, more, err := S.SearchPosts(r, terms, limit, offset)
+		if err != nil {
+			fmt.Println("SearchPosts error:", err)
+			http.Error(w, "DB Error", http.StatusInternalServerError)
+			return
+		}
+		result["posts"], hasMore["posts"] = posts, more
+	}
+	if types["groups"] {
+		groups, more, err := S.SearchGroups(r, terms, limit, offset)
+		if err != nil {
+			fmt.Println("SearchGroups error:", err)
+			http.Error(w, "DB Error", http.StatusInternalServerError)
+			return
+		}
+		result["groups"], hasMore["groups"] = groups, more
+	}
+	result["hasMore"] = hasMore
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// searchSQL returns the FROM clause, the match condition and the ORDER BY rank
+// for a full-text search of table under alias. The search text is bound once,
+// in FROM on postgres and in the match condition on sqlite, so the match
+// condition must open the WHERE clause to keep the bind order the same.
+func (S *Server) searchSQL(table, alias string) (from, match, rank string) {
+	if S.db.Driver() == "postgres" {
+		return fmt.Sprintf(`%s %s, to_tsquery('simple', ?) q`, table, alias),
+			alias + `.search @@ q`,
+			`ts_rank(` + alias + `.search, q) DESC`
+	}
+	return fmt.Sprintf(`%[1]s_fts JOIN %[1]s %[2]s ON %[2]s.id = %[1]s_fts.rowid`, table, alias),
+		table + `_fts MATCH ?`,
+		`bm25(` + table + `_fts)`
+}
+
+// searchText turns the terms into a prefix query of the driver, every term must match
+func (S *Server) searchText(terms []string) string {
+	parts := make([]string, len(terms))
+	for i, term := range terms {
+		if S.db.Driver() == "postgres" {
+			parts[i] = term + ":*"
+		} else {
+			parts[i] = `"` + term + `"*`
+		}
+	}
+	if S.db.Driver() == "postgres" {
+		return strings.Join(parts, " & ")
+	}
+	return strings.Join(parts, " ")
+}
+
+func (S *Server) SearchUsers(terms []string, limit, offset int) ([]SearchUser, bool, error) {
+	from, match, rank := S.searchSQL("users", "u")
+	rows, err := S.db.Query(`
+		SELECT u.id, u.first_name, u.last_name, u.nickname, u.url, u.avatar, u.is_private
+		FROM `+from+`
+		WHERE `+match+`
+		ORDER BY `+rank+`, u.id
+		LIMIT ? OFFSET ?`,
+		S.searchText(terms), limit+1, offset)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	users := []SearchUser{}
+	for rows.Next() {
+		var u SearchUser
+		var firstName, lastName, nickname, url, avatar sql.NullString
+		if err := rows.Scan(&u.ID, &firstName, &lastName, &nickname, &url, &avatar, &u.IsPrivate); err != nil {
+			return nil, false, err
+		}
+		u.FirstName, u.LastName, u.Nickname = firstName.String, lastName.String, nickname.String
+		u.Url, u.Avatar = url.String, avatar.String
+		users = append(users, u)
+	}
+	if len(users) > limit {
+		return users[:limit], true, rows.Err()
+	}
+	return users, false, rows.Err()
+}
+
+// SearchPosts only matches posts the current user can see (see CanSeePost)
+func (S *Server) SearchPosts(r *http.Request, terms []string, limit, offset int) ([]Post, bool, error) {
+	userID, _ := CurrentUser(r)
+	from, match, rank := S.searchSQL("posts", "p")
+	rows, err := S.db.Query(`
+		SELECT p.id
+		FROM `+from+`
+		WHERE `+match+` AND `+visiblePostSQL("p")+`
+			AND (p.group_id IS NULL OR EXISTS(
+				SELECT 1 FROM group_members gm WHERE gm.group_id = p.group_id AND gm.user_id = ?))
+			AND (p.shared_post_id IS NULL OR EXISTS(
+				SELECT 1 FROM posts o WHERE o.id = p.shared_post_id AND `+visiblePostSQL("o")+`))
+		ORDER BY `+rank+`, p.id DESC
+		LIMIT ? OFFSET ?`,
+		S.searchText(terms), userID, userID, userID, userID, userID, userID, userID, limit+1, offset)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, false, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	more := len(ids) > limit
+	if more {
+		ids = ids[:limit]
+	}
+	posts := []Post{}
+	for _, id := range ids {
+		post, err := S.GetPostFromID(id, r)
+		if err != nil {
+			return nil, false, err
+		}
+		if post.ID != 0 {
+			posts = append(posts, post)
+		}
+	}
+	return posts, more, nil
+}
+
+func (S *Server) SearchGroups(r *http.Request, terms []string, limit, offset int) ([]Group, bool, error) {
+	userID, _ := CurrentUser(r)
+	from, match, rank := S.searchSQL("groups", "g")
+	rows, err := S.db.Query(`
+		SELECT g.id, g.creator_id, g.title, g.description, g.created_at,
+			EXISTS(SELECT 1 FROM group_members gm WHERE gm.group_id = g.id AND gm.user_id = ?)
+		FROM `+from+`
+		WHERE `+match+`
+		ORDER BY `+rank+`, g.id
+		LIMIT ? OFFSET ?`,
+		// the membership check comes before the search text in the SELECT list
+		userID, S.searchText(terms), limit+1, offset)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	groups := []Group{}
+	for rows.Next() {
+		var g Group
+		var description sql.NullString
+		if err := rows.Scan(&g.ID, &g.CreatorID, &g.Title, &description, &g.CreatedAt, &g.IsMember); err != nil {
+			return nil, false, err
+		}
+		g.Description = description.String
+		g.IsCreator = g.CreatorID == userID
+		groups = append(groups, g)
+	}
+	if len(groups) > limit {
+		return groups[:limit], true, rows.Err()
+	}
+	return groups, false, rows.Err()
+}
@@ -0,0 +1,385 @@
+package backend
+
+import (
+	tools "SOCIAL-NETWORK/pkg"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/twinj/uuid"
+)
+
+// last_seen_at is written, and the idle expiry pushed forward, at most this
+// often per session
+const sessionTouchInterval = time.Minute
+
+// SessionConfig holds how long sessions live. A session ends after IdleTimeout
+// without use or AbsoluteTimeout after login, whichever comes first.
+type SessionConfig struct {
+	IdleTimeout             time.Duration
+	AbsoluteTimeout         time.Duration
+	RememberIdleTimeout     time.Duration
+	RememberAbsoluteTimeout time.Duration
+	// SweepInterval is how often expired sessions are deleted, 0 never
+	SweepInterval time.Duration
+	// CookieSecure sends the session cookie over HTTPS only
+	CookieSecure bool
+}
+
+// LoadSessionConfig reads the SESSION_* settings from the environment
+func LoadSessionConfig() SessionConfig {
+	return SessionConfig{
+		IdleTimeout:             envDuration("SESSION_IDLE_TIMEOUT", 24*time.Hour),
+		AbsoluteTimeout:         envDuration("SESSION_ABSOLUTE_TIMEOUT", 7*24*time.Hour),
+		RememberIdleTimeout:     envDuration("SESSION_REMEMBER_IDLE_TIMEOUT", 30*24*time.Hour),
+		RememberAbsoluteTimeout: envDuration("SESSION_REMEMBER_ABSOLUTE_TIMEOUT", 90*24*time.Hour),
+		SweepInterval:           envDuration("SESSION_SWEEP_INTERVAL", 10*time.Minute),
+		CookieSecure:            os.Getenv("SESSION_COOKIE_SECURE") == "true",
+	}
+}
+
+// Timeouts returns the idle and absolute timeout of a session
+func (c SessionConfig) Timeouts(remember bool) (time.Duration, time.Duration) {
+	if remember {
+		return c.RememberIdleTimeout, c.RememberAbsoluteTimeout
+	}
+	return c.IdleTimeout, c.AbsoluteTimeout
+}
+
+// TouchInterval is how often a session's expiry is pushed forward. Short idle
+// timeouts are refreshed more often so an active session never lapses.
+func (c SessionConfig) TouchInterval(remember bool) time.Duration {
+	idle, _ := c.Timeouts(remember)
+	return min(sessionTouchInterval, idle/4)
+}
+
+// envDuration reads a duration like "24h" from name, def when unset or invalid
+func envDuration(name string, def time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("Invalid %s %q, using %s", name, v, def)
+		return def
+	}
+	return d
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+// SessionInfo describes one login of the user. ID is derived from the session
+// token so the token itself never leaves the cookie.
+type SessionInfo struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"userAgent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	Current    bool      `json:"current"`
+	Online     bool      `json:"online"`
+
+	sessionID string
+}
+
+// ClientIP is the address the request came from
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// PublicSessionID is the id a session is listed and revoked by
+func PublicSessionID(sessionID string) string {
+	return HashToken(sessionID)[:16]
+}
+
+// TouchSession records that the session was just used from r and slides its
+// expiry to a full idle timeout from now, capped by the absolute expiry
+func (S *Server) TouchSession(sessionID string, r *http.Request, remember bool, absoluteExpiry sql.NullTime) error {
+	now := time.Now()
+	idle, _ := S.sessionConfig.Timeouts(remember)
+	expiry := now.Add(idle)
+	if absoluteExpiry.Valid {
+		expiry = minTime(expiry, absoluteExpiry.Time)
+	}
+	_, err := S.db.Exec(`UPDATE sessions SET last_seen_at = ?, ip = ?, expires_at = ? WHERE session_id = ?`,
+		S.db.Timestamp(now), ClientIP(r), S.db.Timestamp(expiry), sessionID)
+	return err
+}
+
+// RotateSession moves the caller's session to a new ID, keeping everything
+// else about it. It is done when the account's credentials or 2FA change so
+// a session ID captured before can't be used after.
+func (S *Server) RotateSession(w http.ResponseWriter, r *http.Request) error {
+	userID, oldID := CurrentUser(r)
+	if oldID == "" {
+		return nil
+	}
+	newID := uuid.NewV4().String()
+
+	tx, err := S.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		INSERT INTO sessions (session_id, user_id, expires_at, absolute_expires_at, remember, user_agent, ip, created_at, last_seen_at)
+		SELECT ?, user_id, expires_at, absolute_expires_at, remember, user_agent, ip, created_at, last_seen_at
+		FROM sessions WHERE session_id = ?`, newID, oldID); err != nil {
+		return err
+	}
+	var remember bool
+	var absoluteExpiry sql.NullTime
+	if err := tx.QueryRow(`SELECT remember, absolute_expires_at FROM sessions WHERE session_id = ?`, oldID).
+		Scan(&remember, &absoluteExpiry); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM sessions WHERE session_id = ?`, oldID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// open tabs keep their connection, it now belongs to the new ID
+	S.Lock()
+	for _, c := range S.Users[userID] {
+		if c.SessionID == oldID {
+			c.SessionID = newID
+		}
+	}
+	S.Unlock()
+
+	S.setSessionCookie(w, newID, remember, absoluteExpiry.Time)
+	return nil
+}
+
+// SweepSessionsLoop deletes expired sessions every interval. It never returns.
+func (S *Server) SweepSessionsLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := S.SweepExpiredSessions(); err != nil {
+			log.Printf("Error sweeping sessions: %v", err)
+		}
+	}
+}
+
+// SweepExpiredSessions deletes the sessions, pending logins, OIDC logins, API
+// tokens and login attempt counters that ran out and closes live connections
+// still open on those sessions
+func (S *Server) SweepExpiredSessions() error {
+	now := S.db.Timestamp(time.Now())
+	rows, err := S.db.Query(`SELECT user_id, session_id FROM sessions WHERE expires_at <= ?`, now)
+	if err != nil {
+		return err
+	}
+	expired := make(map[int][]string)
+	for rows.Next() {
+		var userID int
+		var sessionID string
+		if err := rows.Scan(&userID, &sessionID); err != nil {
+			rows.Close()
+			return err
+		}
+		expired[userID] = append(expired[userID], sessionID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for userID, sessionIDs := range expired {
+		if err := S.RevokeSessions(userID, sessionIDs...); err != nil {
+			return err
+		}
+	}
+	if _, err := S.db.Exec(`DELETE FROM pending_logins WHERE expires_at <= ?`, now); err != nil {
+		return err
+	}
+	if _, err := S.db.Exec(`DELETE FROM api_tokens WHERE expires_at <= ?`, now); err != nil {
+		return err
+	}
+	if _, err := S.db.Exec(`DELETE FROM oidc_logins WHERE expires_at <= ?`, now); err != nil {
+		return err
+	}
+	return S.PruneLoginAttempts(S.loginLimits.Now())
+}
+
+// GetSessions lists the live sessions of userID, most recently used first
+func (S *Server) GetSessions(userID int) ([]SessionInfo, error) {
+	rows, err := S.db.Query(`
+		SELECT session_id, COALESCE(user_agent, ''), COALESCE(ip, ''), created_at, last_seen_at, expires_at
+		FROM sessions
+		WHERE user_id = ? AND expires_at > ?
+		ORDER BY last_seen_at DESC`, userID, S.db.Timestamp(time.Now()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []SessionInfo{}
+	for rows.Next() {
+		var s SessionInfo
+		var createdAt, lastSeenAt sql.NullTime
+		if err := rows.Scan(&s.sessionID, &s.UserAgent, &s.IP, &createdAt, &lastSeenAt, &s.ExpiresAt); err != nil {
+			return nil, err
+		}
+		s.ID = PublicSessionID(s.sessionID)
+		s.CreatedAt = createdAt.Time
+		s.LastSeenAt = lastSeenAt.Time
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// SessionsHandler lists the caller's sessions, marking the one making the request
+func (S *Server) SessionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, currentSession := CurrentUser(r)
+
+	sessions, err := S.GetSessions(userID)
+	if err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	online := make(map[string]bool)
+	for _, c := range S.GetConnections(userID) {
+		online[c.SessionID] = true
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].sessionID == currentSession
+		sessions[i].Online = online[sessions[i].sessionID]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// RevokeSessionHandler ends one of the caller's sessions by its public id,
+// DELETE /api/sessions/{id}. Revoking the current one logs the caller out.
+func (S *Server) RevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, currentSession := CurrentUser(r)
+	id := strings.TrimPrefix(r.URL.Path, "/api/sessions/")
+
+	sessions, err := S.GetSessions(userID)
+	if err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var sessionID string
+	for _, s := range sessions {
+		if s.ID == id {
+			sessionID = s.sessionID
+		}
+	}
+	if sessionID == "" {
+		tools.SendJSONError(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	if err := S.RevokeSessions(userID, sessionID); err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if sessionID == currentSession {
+		S.clearSessionCookie(w)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"revoked": 1})
+}
+
+// RevokeOtherSessionsHandler logs the caller out everywhere but here
+func (S *Server) RevokeOtherSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, currentSession := CurrentUser(r)
+
+	sessions, err := S.GetSessions(userID)
+	if err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var others []string
+	for _, s := range sessions {
+		if s.sessionID != currentSession {
+			others = append(others, s.sessionID)
+		}
+	}
+	if err := S.RevokeSessions(userID, others...); err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"revoked": len(others)})
+}
+
+// RevokeSessions deletes the given sessions of userID and closes their live
+// connections
+func (S *Server) RevokeSessions(userID int, sessionIDs ...string) error {
+	if len(sessionIDs) == 0 {
+		return nil
+	}
+	args := []interface{}{userID}
+	for _, id := range sessionIDs {
+		args = append(args, id)
+	}
+	if _, err := S.db.Exec(`DELETE FROM sessions WHERE user_id = ? AND session_id IN (`+Placeholders(len(sessionIDs))+`)`,
+		args...); err != nil {
+		return err
+	}
+	S.CloseClients(userID, sessionIDs...)
+	return nil
+}
+
+func (S *Server) setSessionCookie(w http.ResponseWriter, sessionID string, remember bool, absoluteExpiry time.Time) {
+	cookie := &http.Cookie{
+		Name:     "session_token",
+		Value:    sessionID,
+		HttpOnly: true,
+		Path:     "/",
+		SameSite: http.SameSiteLaxMode,
+		Secure:   S.sessionConfig.CookieSecure,
+	}
+	// without remember-me the cookie goes away with the browser
+	if remember {
+		cookie.Expires = absoluteExpiry
+	}
+	http.SetCookie(w, cookie)
+}
+
+func (S *Server) clearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session_token",
+		Value:    "",
+		Expires:  time.Unix(0, 0),
+		HttpOnly: true,
+		Path:     "/",
+		SameSite: http.SameSiteLaxMode,
+		Secure:   S.sessionConfig.CookieSecure,
+	})
+}
@@ -0,0 +1,167 @@
+package backend
+
+import (
+	tools "SOCIAL-NETWORK/pkg"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// GetTagPostsHandler lists the visible posts tagged with /api/tags/{tag},
+// paginated like the home feed.
+func (S *Server) GetTagPostsHandler(w http.ResponseWriter, r *http.Request) {
+	tag := strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/api/tags/"), "#"))
+	if tag == "" {
+		tools.SendJSONError(w, "Tag required", http.StatusBadRequest)
+		return
+	}
+
+	cursor, limit, err := ReadFeedPage(r)
+	if err != nil {
+		tools.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	posts, next, err := S.GetFeedPage(r, cursor, limit, `EXISTS(
+		SELECT 1 FROM post_hashtags ph JOIN hashtags h ON h.id = ph.hashtag_id
+		WHERE ph.post_id = p.id AND h.name = ?)`, tag)
+	if err != nil {
+		fmt.Println("GetTagPostsHandler GetFeedPage error : ", err)
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	if posts == nil {
+		posts = []Post{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tag":        tag,
+		"posts":      posts,
+		"nextCursor": next,
+	})
+}
+
+// LinkPostTags stores the hashtags and mentions found in the raw content of a
+// post, replacing those of a previous version. Only newly mentioned users are
+// notified, and only when they can see the post.
+func (S *Server) LinkPostTags(postID, authorID int, content string) error {
+	return S.linkTags("post", postID, postID, authorID, content)
+}
+
+// LinkCommentTags does the same as LinkPostTags for a comment on postID
+func (S *Server) LinkCommentTags(commentID, authorID, postID int, content string) error {
+	return S.linkTags("comment", commentID, postID, authorID, content)
+}
+
+// linkTags fills <kind>_hashtags and <kind>_mentions for the row id
+func (S *Server) linkTags(kind string, id, postID, authorID int, content string) error {
+	hashtagIDs, err := S.GetHashtagIDs(tools.ParseHashtags(content))
+	if err != nil {
+		return err
+	}
+	mentioned, err := S.GetMentionedUserIDs(tools.ParseMentions(content))
+	if err != nil {
+		return err
+	}
+
+	if _, err := S.db.Exec(fmt.Sprintf(`DELETE FROM %[1]s_hashtags WHERE %[1]s_id = ?`, kind), id); err != nil {
+		return err
+	}
+	for _, hashtagID := range hashtagIDs {
+		_, err := S.db.Exec(fmt.Sprintf(`
+			INSERT INTO %[1]s_hashtags (%[1]s_id, hashtag_id) VALUES (?, ?)
+			ON CONFLICT DO NOTHING`, kind), id, hashtagID)
+		if err != nil {
+			return err
+		}
+	}
+
+	// mentions that are still there are kept so an edit doesn't notify them again
+	stale := fmt.Sprintf(`DELETE FROM %[1]s_mentions WHERE %[1]s_id = ?`, kind)
+	args := []any{id}
+	if len(mentioned) > 0 {
+		stale += ` AND user_id NOT IN (` + Placeholders(len(mentioned)) + `)`
+		for _, userID := range mentioned {
+			args = append(args, userID)
+		}
+	}
+	if _, err := S.db.Exec(stale, args...); err != nil {
+		return err
+	}
+
+	for _, userID := range mentioned {
+		res, err := S.db.Exec(fmt.Sprintf(`
+			INSERT INTO %[1]s_mentions (%[1]s_id, user_id) VALUES (?, ?)
+			ON CONFLICT DO NOTHING`, kind), id, userID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 || userID == authorID {
+			continue
+		}
+
+		canSee, err := S.CanSeePost(userID, postID)
+		if err != nil {
+			return err
+		}
+		if !canSee {
+			continue
+		}
+		notification := Notification{ID: userID, ActorID: authorID, Type: "mention", Content: "Mentioned You In A Post", IsRead: false, PostID: postID}
+		if kind == "comment" {
+			notification.Content = "Mentioned You In A Comment"
+			notification.CommentID = id
+		}
+		S.IsertNotification(notification)
+		S.PushNotification("-new", userID, notification)
+	}
+	return nil
+}
+
+// GetHashtagIDs returns the ids of the named hashtags, creating missing ones
+func (S *Server) GetHashtagIDs(names []string) ([]int, error) {
+	var ids []int
+	for _, name := range names {
+		if _, err := S.db.Exec(`INSERT INTO hashtags (name) VALUES (?) ON CONFLICT (name) DO NOTHING`, name); err != nil {
+			return nil, err
+		}
+		var id int
+		if err := S.db.QueryRow(`SELECT id FROM hashtags WHERE name = ?`, name).Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// GetMentionedUserIDs resolves @names against user nicknames and urls
+func (S *Server) GetMentionedUserIDs(names []string) ([]int, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	args := make([]any, 0, 2*len(names))
+	for _, name := range names {
+		args = append(args, name)
+	}
+	args = append(args, args...)
+
+	rows, err := S.db.Query(`
+		SELECT id FROM users
+		WHERE nickname IN (`+Placeholders(len(names))+`) OR url IN (`+Placeholders(len(names))+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
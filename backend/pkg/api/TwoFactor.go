@@ -0,0 +1,498 @@
+package backend
+
+import (
+	tools "SOCIAL-NETWORK/pkg"
+	"SOCIAL-NETWORK/pkg/totp"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	totpIssuer = "Social Network"
+
+	// the second login step has to happen within pendingLoginTTL and
+	// maxPendingLoginAttempts tries
+	pendingLoginTTL         = 5 * time.Minute
+	maxPendingLoginAttempts = 5
+
+	recoveryCodeCount = 10
+)
+
+var errMFANotConfigured = errors.New("MFA_ENCRYPTION_KEY is not set")
+
+type TwoFactorCode struct {
+	Code string `json:"code"`
+}
+
+type TwoFactorDisable struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+type TwoFactorLogin struct {
+	PendingToken string `json:"pendingToken"`
+	Code         string `json:"code"`
+}
+
+// mfaKey is the AES-256 key TOTP secrets are encrypted with, from
+// MFA_ENCRYPTION_KEY as 64 hex characters
+func mfaKey() ([]byte, error) {
+	v := os.Getenv("MFA_ENCRYPTION_KEY")
+	if v == "" {
+		return nil, errMFANotConfigured
+	}
+	key, err := hex.DecodeString(v)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("MFA_ENCRYPTION_KEY must be 64 hex characters")
+	}
+	return key, nil
+}
+
+func mfaCipher() (cipher.AEAD, error) {
+	key, err := mfaKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealSecret encrypts a TOTP secret for storage as base64(nonce|ciphertext)
+func sealSecret(secret []byte) (string, error) {
+	gcm, err := mfaCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, secret, nil)), nil
+}
+
+func openSecret(sealed string) ([]byte, error) {
+	gcm, err := mfaCipher()
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("sealed secret too short")
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+}
+
+// TwoFactorEnabled reports whether userID has confirmed a TOTP secret
+func (S *Server) TwoFactorEnabled(userID int) (bool, error) {
+	var enabled bool
+	err := S.db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM user_totp WHERE user_id = ? AND enabled_at IS NOT NULL)`, userID).Scan(&enabled)
+	return enabled, err
+}
+
+// TwoFactorStatusHandler tells the caller whether 2FA is on and how many
+// recovery codes they have left
+func (S *Server) TwoFactorStatusHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := CurrentUser(r)
+
+	enabled, err := S.TwoFactorEnabled(userID)
+	if err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var codesLeft int
+	if err := S.db.QueryRow(`
+		SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL`, userID).Scan(&codesLeft); err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled":           enabled,
+		"recoveryCodesLeft": codesLeft,
+	})
+}
+
+// EnrollTwoFactorHandler starts 2FA setup with a new secret. It only takes
+// effect once ConfirmTwoFactorHandler sees a code made from it.
+func (S *Server) EnrollTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		tools.SendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, _ := CurrentUser(r)
+
+	enabled, err := S.TwoFactorEnabled(userID)
+	if err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if enabled {
+		tools.SendJSONError(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sealed, err := sealSecret(secret)
+	if err == errMFANotConfigured {
+		tools.SendJSONError(w, "Two-factor authentication is not available", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var email string
+	if err := S.db.QueryRow(`SELECT email FROM users WHERE id = ?`, userID).Scan(&email); err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := S.db.Exec(`
+		INSERT INTO user_totp (user_id, secret_enc) VALUES (?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET secret_enc = excluded.secret_enc, last_used_step = 0`,
+		userID, sealed); err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"secret":     totp.EncodeSecret(secret),
+		"otpauthUrl": totp.URI(totpIssuer, email, secret),
+	})
+}
+
+// ConfirmTwoFactorHandler turns 2FA on once the caller proves their app
+// produces codes for the enrolled secret, and hands out the recovery codes.
+// They are only shown this once.
+func (S *Server) ConfirmTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		tools.SendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, _ := CurrentUser(r)
+
+	var req TwoFactorCode
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		tools.SendJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var sealed string
+	err := S.db.QueryRow(`
+		SELECT secret_enc FROM user_totp WHERE user_id = ? AND enabled_at IS NULL`, userID).Scan(&sealed)
+	if err == sql.ErrNoRows {
+		tools.SendJSONError(w, "Start the two-factor setup first", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	secret, err := openSecret(sealed)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	step, ok := totp.Validate(secret, req.Code, time.Now())
+	if !ok {
+		tools.SendJSONError(w, "Invalid code", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := S.EnableTwoFactor(userID, step)
+	if err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := S.RotateSession(w, r); err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled":       true,
+		"recoveryCodes": codes,
+	})
+}
+
+// EnableTwoFactor marks the enrolled secret as confirmed at step and replaces
+// the user's recovery codes with new ones
+func (S *Server) EnableTwoFactor(userID int, step int64) ([]string, error) {
+	tx, err := S.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		UPDATE user_totp SET enabled_at = ?, last_used_step = ? WHERE user_id = ?`,
+		S.db.Timestamp(time.Now()), step, userID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(`INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)`,
+			userID, HashToken(normalizeRecoveryCode(code))); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, tx.Commit()
+}
+
+// newRecoveryCode looks like ABCDE-FGHIJ
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	s := totp.EncodeSecret(b)[:10]
+	return s[:5] + "-" + s[5:], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// DisableTwoFactorHandler turns 2FA off. It takes the password and a current
+// code or a recovery code, so a stolen session alone can't do it.
+func (S *Server) DisableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		tools.SendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, _ := CurrentUser(r)
+
+	var req TwoFactorDisable
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		tools.SendJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var hashedPassword string
+	if err := S.db.QueryRow(`SELECT password FROM users WHERE id = ?`, userID).Scan(&hashedPassword); err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tools.CheckPassword(hashedPassword, req.Password); err != nil {
+		tools.SendJSONError(w, "Password is incorrect", http.StatusForbidden)
+		return
+	}
+
+	ok, err := S.CheckSecondFactor(userID, req.Code)
+	if err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		tools.SendJSONError(w, "Invalid code", http.StatusForbidden)
+		return
+	}
+
+	if _, err := S.db.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID); err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := S.db.Exec(`DELETE FROM user_totp WHERE user_id = ?`, userID); err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := S.RotateSession(w, r); err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"enabled": false})
+}
+
+// CheckSecondFactor accepts a TOTP code from the user's app or one of their
+// unused recovery codes. Either can only be used once.
+func (S *Server) CheckSecondFactor(userID int, code string) (bool, error) {
+	var sealed string
+	err := S.db.QueryRow(`
+		SELECT secret_enc FROM user_totp WHERE user_id = ? AND enabled_at IS NOT NULL`, userID).Scan(&sealed)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if len(strings.ReplaceAll(code, " ", "")) == totp.Digits {
+		secret, err := openSecret(sealed)
+		if err != nil {
+			return false, err
+		}
+		step, ok := totp.Validate(secret, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		// a code is spent once a step at or after it has been used
+		res, err := S.db.Exec(`
+			UPDATE user_totp SET last_used_step = ? WHERE user_id = ? AND last_used_step < ?`, step, userID, step)
+		if err != nil {
+			return false, err
+		}
+		n, err := res.RowsAffected()
+		return n == 1, err
+	}
+
+	res, err := S.db.Exec(`
+		UPDATE recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`,
+		S.db.Timestamp(time.Now()), userID, HashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// CreatePendingLogin remembers that userID passed the password check and
+// returns the token the second login step has to present
+func (S *Server) CreatePendingLogin(userID int, remember bool) (string, error) {
+	token, hash, err := NewSecretToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	// old pending logins of the user are dead either way
+	if _, err := S.db.Exec(`DELETE FROM pending_logins WHERE user_id = ? OR expires_at <= ?`,
+		userID, S.db.Timestamp(now)); err != nil {
+		return "", err
+	}
+	_, err = S.db.Exec(`
+		INSERT INTO pending_logins (user_id, token_hash, expires_at, remember) VALUES (?, ?, ?, ?)`,
+		userID, hash, S.db.Timestamp(now.Add(pendingLoginTTL)), remember)
+	return token, err
+}
+
+// pendingLoginCookie carries the pending token of a provider sign-in to
+// LoginTwoFactorHandler
+const pendingLoginCookie = "pending_login"
+
+// setPendingLoginCookie hands token to the second login step, a negative
+// maxAge removes it
+func (S *Server) setPendingLoginCookie(w http.ResponseWriter, token string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     pendingLoginCookie,
+		Value:    token,
+		Path:     "/api/login/2fa",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   S.sessionConfig.CookieSecure,
+	})
+}
+
+// LoginTwoFactorHandler is the second login step for accounts with 2FA: the
+// pending token from LoginHandler, or the pending_login cookie of a provider
+// sign-in, plus a code give the session cookie.
+func (S *Server) LoginTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		tools.SendJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req TwoFactorLogin
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		tools.SendJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.PendingToken == "" {
+		if cookie, err := r.Cookie(pendingLoginCookie); err == nil {
+			req.PendingToken = cookie.Value
+		}
+	}
+	hash := HashToken(req.PendingToken)
+	var userID, attempts int
+	var remember bool
+	err := S.db.QueryRow(`
+		SELECT user_id, attempts, remember FROM pending_logins WHERE token_hash = ? AND expires_at > ?`,
+		hash, S.db.Timestamp(time.Now())).Scan(&userID, &attempts, &remember)
+	if err == sql.ErrNoRows || attempts >= maxPendingLoginAttempts {
+		tools.SendJSONError(w, "Your login has expired, please sign in again", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// wrong codes count like wrong passwords, so new pending logins don't
+	// give unlimited guesses
+	subjects := LoginSubjects(r, userID, "")
+	if S.RejectBlockedLogin(w, subjects) {
+		return
+	}
+
+	ok, err := S.CheckSecondFactor(userID, req.Code)
+	if err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		if _, err := S.db.Exec(`UPDATE pending_logins SET attempts = attempts + 1 WHERE token_hash = ?`, hash); err != nil {
+			http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		S.FailLogin(w, subjects, userID, "Invalid code")
+		return
+	}
+	if _, err := S.db.Exec(`DELETE FROM pending_logins WHERE token_hash = ?`, hash); err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := S.ClearLoginFailures(userID); err != nil {
+		log.Printf("Error clearing login failures: %v", err)
+	}
+
+	S.setPendingLoginCookie(w, "", -1)
+	S.MakeToken(w, r, userID, remember)
+
+	userData, err := S.GetUserData("", userID)
+	if err != nil {
+		tools.SendJSONError(w, "Failed to retrieve user data", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user": userData,
+	})
+}
@@ -0,0 +1,72 @@
+package backend
+
+import (
+	"SOCIAL-NETWORK/pkg/totp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSealSecret(t *testing.T) {
+	t.Setenv("MFA_ENCRYPTION_KEY", strings.Repeat("0f", 32))
+	secret := []byte("12345678901234567890")
+	sealed, err := sealSecret(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := sealSecret(secret); again == sealed {
+		t.Error("two seals of the same secret are equal, the nonce is reused")
+	}
+	opened, err := openSecret(sealed)
+	if err != nil || string(opened) != string(secret) {
+		t.Fatalf("openSecret = %q, %v, want %q", opened, err, secret)
+	}
+
+	// another key can't open it, nor can a tampered copy
+	t.Setenv("MFA_ENCRYPTION_KEY", strings.Repeat("f0", 32))
+	if _, err := openSecret(sealed); err == nil {
+		t.Error("opened with the wrong key")
+	}
+	t.Setenv("MFA_ENCRYPTION_KEY", strings.Repeat("0f", 32))
+	tampered := []byte(sealed)
+	tampered[len(tampered)-2] ^= 1
+	if _, err := openSecret(string(tampered)); err == nil {
+		t.Error("opened a tampered secret")
+	}
+	for _, key := range []string{"", "0f0f", strings.Repeat("zz", 32)} {
+		t.Setenv("MFA_ENCRYPTION_KEY", key)
+		if _, err := sealSecret(secret); err == nil {
+			t.Errorf("sealed with key %q", key)
+		}
+	}
+}
+
+func TestSecondFactorCodeIsSpent(t *testing.T) {
+	S := newTestServer(t)
+	alice := createTestUser(t, S, "alice", false)
+	secret := enableTestTwoFactor(t, S, alice)
+
+	now := time.Now()
+	check := func(code string) bool {
+		t.Helper()
+		ok, err := S.CheckSecondFactor(alice.ID, code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+	code := totp.Code(secret, now)
+	if !check(code) {
+		t.Fatal("current code rejected")
+	}
+	if check(code) {
+		t.Error("the same code worked twice")
+	}
+	// nor does an older one still inside the skew window
+	if check(totp.CodeAt(secret, totp.Step(now)-1)) {
+		t.Error("a code from before the spent one worked")
+	}
+	if !check(totp.CodeAt(secret, totp.Step(now)+1)) {
+		t.Error("the next code rejected")
+	}
+}
@@ -7,8 +7,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"html"
+	"log"
 	"net/http"
-	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -41,19 +41,47 @@ func (S *Server) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if user.AvatarUrl == "" {
+		user.AvatarUrl = defaultAvatar
+	}
+	if !ValidAvatarPath(user.AvatarUrl) {
+		tools.SendJSONError(w, "Invalid avatar", http.StatusBadRequest)
+		return
+	}
+	// only an upload no account has claimed yet can be taken
+	if user.AvatarUrl != defaultAvatar {
+		var free bool
+		if err := S.db.QueryRowContext(r.Context(), `SELECT EXISTS(SELECT 1 FROM avatar_uploads WHERE path = ? AND user_id IS NULL)`,
+			user.AvatarUrl).Scan(&free); err != nil {
+			tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !free {
+			tools.SendJSONError(w, "Invalid avatar", http.StatusBadRequest)
+			return
+		}
+	}
+
 	user.Age = tools.GetAge(user.DateOfBirth)
 
-	if user.Nickname == "" {
-		user.Url = tools.ToUsername(user.Email)
-	} else {
-		user.Url = user.Nickname
-	}
+	user.Url = ProfileURL(user)
 
-	if err := S.AddUser(user, r.Context()); err != nil {
+	userID, err := S.AddUser(user, r.Context())
+	if err != nil {
 		fmt.Println(err)
 		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
+	// someone else claimed the upload in between, fall back to the default
+	if claimed, err := S.ClaimAvatarUpload(userID, user.AvatarUrl); err != nil || !claimed {
+		if _, err := S.db.Exec(`UPDATE users SET avatar = ? WHERE id = ?`, defaultAvatar, userID); err != nil {
+			log.Printf("Error resetting avatar: %v", err)
+		}
+	}
+	// the account works without it, the link can be sent again later
+	if err := S.SendEmailVerification(userID); err != nil {
+		log.Printf("Error sending verification email: %v", err)
+	}
 
 	// Send success response
 	w.Header().Set("Content-Type", "application/json")
@@ -77,16 +105,46 @@ func (S *Server) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		tools.SendJSONError(w, "Email and password are required", http.StatusBadRequest)
 		return
 	}
-	url, hashedPassword, id, err := S.GetHashedPasswordFromDB(tools.ToLower(user.Identifier))
+	identifier := NormalizeLoginIdentifier(user.Identifier)
+	url, hashedPassword, id, err := S.GetHashedPasswordFromDB(identifier)
+	if err != nil {
+		// an unknown identifier takes as long to check as a wrong password
+		id, hashedPassword = 0, unknownUserPasswordHash
+	}
+	subjects := LoginSubjects(r, id, identifier)
+	if S.RejectBlockedLogin(w, subjects) {
+		return
+	}
+	if tools.CheckPassword(hashedPassword, user.Password) != nil || id == 0 {
+		S.FailLogin(w, subjects, id, "Invalid email or password")
+		return
+	}
+
+	// with 2FA on, the session waits for LoginTwoFactorHandler
+	twoFactor, err := S.TwoFactorEnabled(id)
 	if err != nil {
-		tools.SendJSONError(w, "Invalid email or password", http.StatusUnauthorized)
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
-	if err := tools.CheckPassword(hashedPassword, user.Password); err != nil {
-		tools.SendJSONError(w, "Invalid email or password", http.StatusUnauthorized)
+	if twoFactor {
+		// the account counter is cleared once the second factor passes too
+		pendingToken, err := S.CreatePendingLogin(id, user.RememberMe)
+		if err != nil {
+			tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"twoFactorRequired": true,
+			"pendingToken":      pendingToken,
+		})
 		return
 	}
-	S.MakeToken(w, id)
+
+	if err := S.ClearLoginFailures(id); err != nil {
+		log.Printf("Error clearing login failures: %v", err)
+	}
+	S.MakeToken(w, r, id, user.RememberMe)
 
 	userData, err := S.GetUserData(url, id)
 	if err != nil {
@@ -125,34 +183,11 @@ func (S *Server) LogoutHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// S.RLock()
-	// if clients, exists := S.clients[username]; exists {
-	// 	for _, client := range clients {
-	// 		client.Send <- map[string]string{
-	// 			"event":   "logout",
-	// 			"message": "Session terminated",
-	// 		}
-	// 		client.Conn.Close()
-	// 	}
-	// 	delete(S.clients, username)
-	// }
-	// S.RUnlock()
-
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_token",
-		Value:    "",
-		Expires:  time.Unix(0, 0),
-		HttpOnly: true,
-		Path:     "/",
-		SameSite: http.SameSiteLaxMode,
-		Secure:   false,
-	})
-
-	// Broadcast user status change to remaining connected clients
-	// go func() {
-	// 	time.Sleep(100 * time.Millisecond)
-	// 	S.broadcastUserStatusChange()
-	// }()
+	// the tabs of this session lose their live connection too
+	if userID != 0 {
+		S.CloseClients(userID, cookie.Value)
+	}
+	S.clearSessionCookie(w)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -165,11 +200,7 @@ func (S *Server) MeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	id, _, err := S.CheckSession(r)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
+	id, _ := CurrentUser(r)
 
 	userData, err := S.GetUserData("", id)
 	if err != nil {
@@ -183,10 +214,20 @@ func (S *Server) MeHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(userData)
 }
 
-func (S *Server) AddUser(user User, ctx context.Context) error {
+// ProfileURL is the url of a new account's profile: its nickname, or the part
+// of its email before the @
+func ProfileURL(user User) string {
+	if user.Nickname == "" {
+		return tools.ToUsername(user.Email)
+	}
+	return user.Nickname
+}
+
+// AddUser creates an unverified account and returns its id
+func (S *Server) AddUser(user User, ctx context.Context) (int, error) {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	// Handle nullable nickname - insert NULL if empty
@@ -206,8 +247,9 @@ func (S *Server) AddUser(user User, ctx context.Context) error {
 	}
 
 	query := `INSERT INTO users (first_name, last_name, birthdate, age, avatar, nickname, about_me,email,password,gender, url)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-	_, err = S.db.ExecContext(ctx, query,
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`
+	var id int
+	err = S.db.QueryRowContext(ctx, query,
 		html.EscapeString(user.FirstName),
 		html.EscapeString(user.LastName),
 		html.EscapeString(user.DateOfBirth),
@@ -218,11 +260,8 @@ func (S *Server) AddUser(user User, ctx context.Context) error {
 		html.EscapeString(user.Email),
 		string(hashedPassword),
 		html.EscapeString(user.Gender),
-		html.EscapeString(user.Url))
-	if err != nil {
-		return err
-	}
-	return nil
+		html.EscapeString(user.Url)).Scan(&id)
+	return id, err
 }
 
 func (S *Server) GetHashedPasswordFromDB(identifier string) (string, string, int, error) {
@@ -247,7 +286,8 @@ func (S *Server) GetUserData(url string, id int) (UserData, error) {
 	var user UserData
 
 	err := S.db.QueryRow(`
-		SELECT id, first_name, last_name, nickname, email, birthdate, avatar, about_me, is_private, created_at, url, age
+		SELECT id, first_name, last_name, nickname, email, birthdate, avatar, about_me, is_private, created_at, url, age,
+		       email_verified_at IS NOT NULL
 		FROM users 
 		WHERE url = ? OR id = ?
 	`, url, id).Scan(
@@ -263,6 +303,7 @@ func (S *Server) GetUserData(url string, id int) (UserData, error) {
 		&user.JoinedDate,
 		&user.Url,
 		&user.Age,
+		&user.EmailVerified,
 	)
 	if err != nil {
 		return UserData{}, err
@@ -4,6 +4,9 @@ import (
 	tools "SOCIAL-NETWORK/pkg"
 	"fmt"
 	"net/http"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/twinj/uuid"
@@ -15,14 +18,35 @@ type Client struct {
 	Send      chan interface{} `json:"-"`
 	UserID    int              `json:"user_id"`
 	SessionID string           `json:"session_id"`
+
+	// done is closed with the connection. Send itself is never closed since
+	// any goroutine may be pushing to it.
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
-func (S *Server) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
-	userID, SessionID, ok := S.CheckSession(r)
-	if ok != nil {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
-		return
+// Push queues msg for the writer. It reports false once the client is
+// closed instead of blocking or panicking.
+func (c *Client) Push(msg interface{}) bool {
+	select {
+	case c.Send <- msg:
+		return true
+	case <-c.done:
+		return false
 	}
+}
+
+// Close ends the connection and stops the writer, it may be called any
+// number of times
+func (c *Client) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.Conn.Close()
+	})
+}
+
+func (S *Server) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	userID, SessionID := CurrentUser(r)
 
 	S.initWebSocket()
 	conn, err := S.upgrader.Upgrade(w, r, nil)
@@ -37,6 +61,7 @@ func (S *Server) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
 		UserID:    userID,
 		SessionID: SessionID,
 		Send:      make(chan interface{}, 10),
+		done:      make(chan struct{}),
 	}
 
 	// add client
@@ -45,9 +70,10 @@ func (S *Server) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
 		S.Users[userID] = []*Client{}
 	}
 	S.Users[userID] = append(S.Users[userID], client)
+	first := len(S.Users[userID]) == 1
 	S.Unlock()
 
-	if len(S.Users[userID]) == 1 {
+	if first {
 		S.BroadcastOnlineStatus(userID, "online")
 	}
 
@@ -58,22 +84,35 @@ func (S *Server) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
 	go S.StartReader(client)
 }
 
-func (S *Server) StartReader(client *Client) {
-	defer func() {
-		client.Conn.Close()
-		S.Lock()
-		conns := S.Users[client.UserID]
-		for i, c := range conns {
-			if c == client {
-				S.Users[client.UserID] = append(conns[:i], conns[i+1:]...)
-				break
-			}
+// removeClients takes the clients of userID that match out of S.Users, so
+// nothing pushes to them anymore, and returns them for the caller to close.
+// The user is shown offline when that was their last connection.
+func (S *Server) removeClients(userID int, match func(*Client) bool) []*Client {
+	S.Lock()
+	var removed, kept []*Client
+	for _, c := range S.Users[userID] {
+		if match(c) {
+			removed = append(removed, c)
+		} else {
+			kept = append(kept, c)
 		}
-		S.Unlock()
+	}
+	if len(removed) > 0 {
+		S.Users[userID] = kept
+	}
+	S.Unlock()
 
-		if len(S.Users[client.UserID]) == 0 {
-			S.BroadcastOnlineStatus(client.UserID, "offline")
-		}
+	if len(removed) > 0 && len(kept) == 0 {
+		S.BroadcastOnlineStatus(userID, "offline")
+	}
+	return removed
+}
+
+func (S *Server) StartReader(client *Client) {
+	defer func() {
+		// CloseClients may have taken it out already
+		S.removeClients(client.UserID, func(c *Client) bool { return c == client })
+		client.Close()
 	}()
 
 	for {
@@ -127,31 +166,66 @@ func (S *Server) StartReader(client *Client) {
 }
 
 func (S *Server) StartWriter(c *Client) {
-	defer func() {
-		c.Conn.Close()
-		close(c.Send)
-	}()
+	defer c.Close()
 
-	for msg := range c.Send {
-		if err := c.Conn.WriteJSON(msg); err != nil {
-			fmt.Println("Error writing to client:", err)
+	for {
+		select {
+		case msg := <-c.Send:
+			if err := c.Conn.WriteJSON(msg); err != nil {
+				fmt.Println("Error writing to client:", err)
+				return
+			}
+		case <-c.done:
 			return
 		}
 	}
 }
 
+// CloseClients ends the live connections of userID that belong to one of
+// sessionIDs, or all of them when none is given. It is called once the
+// sessions themselves are gone.
+func (S *Server) CloseClients(userID int, sessionIDs ...string) {
+	closing := S.removeClients(userID, func(c *Client) bool {
+		return len(sessionIDs) == 0 || slices.Contains(sessionIDs, c.SessionID)
+	})
+	for _, c := range closing {
+		c.Conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "session ended"),
+			time.Now().Add(time.Second))
+		c.Close()
+	}
+}
+
+// PushNotification sends a notifications-{notifType} event with the user's
+// new unread count. A new Notification is dropped when the user turned off
+// live pushes for its type or muted its actor or target.
 func (S *Server) PushNotification(notifType string, userID int, notif interface{}) {
+	if len(S.GetConnections(userID)) == 0 {
+		return
+	}
+	if n, ok := notif.(Notification); ok && n.Type != "" {
+		n.ID = userID
+		if allowed, err := S.NotificationAllowed(n, ChannelLive); err != nil || !allowed {
+			return
+		}
+	}
+	unread, err := S.CountUnreadNotifications(userID)
+	if err != nil {
+		fmt.Println("Error counting unread notifications:", err)
+	}
+
 	S.RLock()
 	defer S.RUnlock()
 	for _, Session := range S.Users[userID] {
 		//fmt.Println("Sending notification to user", userID)
 		// fmt.Println("Notification:", notif)
-		Session.Send <- map[string]interface{}{
+		Session.Push(map[string]interface{}{
 			"channel": "notifications" + notifType,
 
 			"to":      userID,
 			"payload": notif,
-		}
+			"unread":  unread,
+		})
 	}
 }
 
@@ -160,10 +234,10 @@ func (S *Server) PushMessage(SessionID string, userID int, msg interface{}) {
 	defer S.RUnlock()
 	for _, Session := range S.Users[userID] {
 		if Session.SessionID != SessionID {
-			Session.Send <- map[string]interface{}{
+			Session.Push(map[string]interface{}{
 				"channel": "chat",
 				"payload": msg,
-			}
+			})
 		}
 	}
 }
@@ -172,10 +246,10 @@ func (S *Server) PushMessageSeen(userID int, msg interface{}) {
 	S.RLock()
 	defer S.RUnlock()
 	for _, Session := range S.Users[userID] {
-		Session.Send <- map[string]interface{}{
+		Session.Push(map[string]interface{}{
 			"channel": "chat-seen",
 			"payload": msg,
-		}
+		})
 	}
 }
 
@@ -188,9 +262,9 @@ func (S *Server) GetConnections(userID int) []*Client {
 }
 
 func (S *Server) BroadcastOnlineStatus(userID int, status string) {
+	UsersOnline := S.GetUsersStatus()
 	S.RLock()
 	defer S.RUnlock()
-	UsersOnline := S.GetUsersStatus()
 
 	for _, ID := range UsersOnline["online"] {
 		if ID == userID {
@@ -198,11 +272,11 @@ func (S *Server) BroadcastOnlineStatus(userID int, status string) {
 		}
 		chatID := S.GetChatID(userID, ID)
 		for _, Session := range S.Users[ID] {
-			Session.Send <- map[string]interface{}{
+			Session.Push(map[string]interface{}{
 				"channel": "status",
 				"user":    chatID,
 				"status":  status == "online",
-			}
+			})
 		}
 	}
 }
@@ -229,10 +303,10 @@ func (S *Server) PushChatDelete(SessionID string, userID int, message map[string
 		if Session.SessionID == SessionID {
 			continue
 		}
-		Session.Send <- map[string]interface{}{
+		Session.Push(map[string]interface{}{
 			"channel": "chat-delete",
 			"payload": message,
-		}
+		})
 	}
 }
 
@@ -240,10 +314,10 @@ func (S *Server) PushTypingStart(userID int, message map[string]interface{}) {
 	S.RLock()
 	defer S.RUnlock()
 	for _, Session := range S.Users[userID] {
-		Session.Send <- map[string]interface{}{
+		Session.Push(map[string]interface{}{
 			"channel": "typing-start",
 			"payload": message,
-		}
+		})
 	}
 }
 
@@ -251,10 +325,10 @@ func (S *Server) PushTypingStop(userID int, message map[string]interface{}) {
 	S.RLock()
 	defer S.RUnlock()
 	for _, Session := range S.Users[userID] {
-		Session.Send <- map[string]interface{}{
+		Session.Push(map[string]interface{}{
 			"channel": "typing-stop",
 			"payload": message,
-		}
+		})
 	}
 }
 
@@ -262,10 +336,10 @@ func (S *Server) PushNewChat(userID int, message map[string]interface{}) {
 	S.RLock()
 	defer S.RUnlock()
 	for _, Session := range S.Users[userID] {
-		Session.Send <- map[string]interface{}{
+		Session.Push(map[string]interface{}{
 			"channel": "new-chat",
 			"payload": message,
-		}
+		})
 	}
 }
 
@@ -273,9 +347,86 @@ func (S *Server) PushNewPost(userID int, message map[string]interface{}) {
 	S.RLock()
 	defer S.RUnlock()
 	for _, Session := range S.Users[userID] {
-		Session.Send <- map[string]interface{}{
+		Session.Push(map[string]interface{}{
 			"channel": "new-post",
 			"payload": message,
+		})
+	}
+}
+
+// PushPostViewers sends an event on channel to every connected user who can
+// see the post and, unless commentID is 0, that comment's thread
+func (S *Server) PushPostViewers(postID, commentID int, channel string, message map[string]interface{}) {
+	S.RLock()
+	userIDs := make([]int, 0, len(S.Users))
+	for userID, connections := range S.Users {
+		if len(connections) > 0 {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	S.RUnlock()
+
+	viewers, err := S.PostViewers(postID, commentID, userIDs)
+	if err != nil {
+		fmt.Println("Error finding post viewers:", err)
+		return
+	}
+
+	S.RLock()
+	defer S.RUnlock()
+	for _, userID := range viewers {
+		for _, Session := range S.Users[userID] {
+			Session.Push(map[string]interface{}{
+				"channel": channel,
+				"payload": message,
+			})
+		}
+	}
+}
+
+// PostViewers returns the users among userIDs who can see postID and, unless
+// commentID is 0, the comment and every comment above it, in one query
+func (S *Server) PostViewers(postID, commentID int, userIDs []int) ([]int, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+	args := []any{commentID, postID}
+	for _, id := range userIDs {
+		args = append(args, id)
+	}
+	rows, err := S.db.Query(commentAncestorsSQL+`
+		SELECT u.id FROM users u
+		JOIN posts p ON p.id = ?
+		WHERE u.id IN (`+Placeholders(len(userIDs))+`)
+			AND `+canSeePostSQL("p", "u.id")+`
+			AND NOT EXISTS(SELECT 1 FROM ancestors a WHERE NOT `+visibleCommentSQLFor("a", "u.id")+`)`,
+		args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var viewers []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		viewers = append(viewers, id)
+	}
+	return viewers, rows.Err()
+}
+
+// PushPostDeleted tells every connected client to drop a post from its feed
+func (S *Server) PushPostDeleted(message map[string]interface{}) {
+	S.RLock()
+	defer S.RUnlock()
+	for _, connections := range S.Users {
+		for _, Session := range connections {
+			Session.Push(map[string]interface{}{
+				"channel": "post-deleted",
+				"payload": message,
+			})
 		}
 	}
 }
@@ -0,0 +1,159 @@
+package backend
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialWebSocket opens a live connection for user and waits until the server
+// has registered it
+func dialWebSocket(t *testing.T, S *Server, srv *httptest.Server, user testUser) *websocket.Conn {
+	t.Helper()
+	before := len(S.GetConnections(user.ID))
+	header := http.Header{}
+	header.Set("Origin", "http://localhost:3000")
+	header.Set("Cookie", user.Session.String())
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	for len(S.GetConnections(user.ID)) == before {
+		time.Sleep(time.Millisecond)
+	}
+	return conn
+}
+
+func TestCloseClientsWhilePushing(t *testing.T) {
+	S := newTestServer(t)
+	srv := httptest.NewServer(S.mux)
+	defer srv.Close()
+	alice := createTestUser(t, S, "alice", false)
+	dialWebSocket(t, S, srv, alice)
+	dialWebSocket(t, S, srv, alice)
+
+	// pushes racing the close must neither panic nor hang
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 200 {
+				S.PushNewPost(alice.ID, map[string]interface{}{"id": 1})
+			}
+		}()
+	}
+	S.CloseClients(alice.ID)
+	wg.Wait()
+
+	if n := len(S.GetConnections(alice.ID)); n != 0 {
+		t.Errorf("%d connections left", n)
+	}
+	// a closed client drops what it is sent
+	c := &Client{Send: make(chan interface{}), done: make(chan struct{})}
+	close(c.done)
+	if c.Push("late") {
+		t.Error("a closed client took a message")
+	}
+}
+
+func TestPostViewers(t *testing.T) {
+	S := newTestServer(t)
+	alice := createTestUser(t, S, "alice", false)
+	bob := createTestUser(t, S, "bob", false)
+	carol := createTestUser(t, S, "carol", false)
+	everyone := []int{alice.ID, bob.ID, carol.ID}
+
+	post := createPost(t, S, alice, "/api/create-post", map[string]any{"content": "hello", "privacy": "public"})
+	private := createPost(t, S, alice, "/api/create-post", map[string]any{
+		"content": "secret", "privacy": "private", "selectedFollowers": []string{strconv.Itoa(carol.ID)},
+	})
+	hidden := addComment(t, S, carol, post, 0)
+	reply := addComment(t, S, alice, post, hidden)
+	if _, err := S.db.Exec(`UPDATE comments SET is_hidden = TRUE WHERE id = ?`, hidden); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name            string
+		post, commentID int
+		want            []int
+	}{
+		{"public post", post, 0, everyone},
+		{"private post", private, 0, []int{alice.ID, carol.ID}},
+		// only the hidden comment's author and the post's author see below it
+		{"reply to a hidden comment", post, reply, []int{alice.ID, carol.ID}},
+	} {
+		got, err := S.PostViewers(tt.post, tt.commentID, everyone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: viewers %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReplyToHiddenCommentIsNotPushed(t *testing.T) {
+	S := newTestServer(t)
+	srv := httptest.NewServer(S.mux)
+	defer srv.Close()
+	alice := createTestUser(t, S, "alice", false)
+	bob := createTestUser(t, S, "bob", false)
+	carol := createTestUser(t, S, "carol", false)
+
+	post := createPost(t, S, alice, "/api/create-post", map[string]any{"content": "hello", "privacy": "public"})
+	hidden := addComment(t, S, carol, post, 0)
+	if _, err := S.db.Exec(`UPDATE comments SET is_hidden = TRUE WHERE id = ?`, hidden); err != nil {
+		t.Fatal(err)
+	}
+	bobConn := dialWebSocket(t, S, srv, bob)
+	carolConn := dialWebSocket(t, S, srv, carol)
+
+	comment := func(parent *string) {
+		t.Helper()
+		if rec := do(t, S, &alice, http.MethodPost, "/api/create-comment", map[string]any{
+			"postId": post, "content": "reply", "parentCommentId": parent,
+		}); rec.Code != http.StatusOK {
+			t.Fatalf("comment: got %d %s", rec.Code, rec.Body)
+		}
+	}
+	hiddenID := strconv.Itoa(hidden)
+	comment(&hiddenID)
+	comment(nil)
+
+	// the first comment bob hears about is the one on the post itself
+	nextComment := func(conn *websocket.Conn) Comment {
+		t.Helper()
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for {
+			var event struct {
+				Channel string `json:"channel"`
+				Payload struct {
+					Comment Comment `json:"comment"`
+				} `json:"payload"`
+			}
+			if err := conn.ReadJSON(&event); err != nil {
+				t.Fatal(err)
+			}
+			if event.Channel == "comment-created" {
+				return event.Payload.Comment
+			}
+		}
+	}
+	if c := nextComment(bobConn); c.ParentCommentID != 0 {
+		t.Errorf("bob was sent the reply to a hidden comment")
+	}
+	if c := nextComment(carolConn); c.ParentCommentID != hidden {
+		t.Errorf("carol wasn't sent the reply to her hidden comment")
+	}
+}
@@ -1,7 +1,9 @@
 package backend
 
 import (
-	"SOCIAL-NETWORK/pkg/db/postgresql"
+	"SOCIAL-NETWORK/pkg/db"
+	"SOCIAL-NETWORK/pkg/mailer"
+	"SOCIAL-NETWORK/pkg/oidc"
 	"log"
 	"net/http"
 	"sync"
@@ -16,14 +18,18 @@ type Server struct {
 	upgrader websocket.Upgrader
 	Users    map[int][]*Client
 	sync.RWMutex
+
+	mailer        mailer.Mailer
+	outboxWake    chan struct{}
+	sessionConfig SessionConfig
+	loginLimits   LoginLimits
+	// oidc is nil when single sign-on isn't configured
+	oidc *oidc.Provider
 }
 
 func (S *Server) Run(addr string) {
-	// S.db = sqlite.ConnectAndMigrate("pkg/db/migrations/app.db", "pkg/db/migrations/sqlite")
-	// defer S.db.Close()
-
-	postgresqlConfig := &postgresql.Config{}
-	S.db = NewDB(postgresqlConfig.ConnectAndMigrate())
+	dbConfig := db.LoadConfig()
+	S.db = NewDB(dbConfig.ConnectAndMigrate(), dbConfig.Driver)
 	defer S.db.Close()
 
 	S.mux = http.NewServeMux()
@@ -31,11 +37,29 @@ func (S *Server) Run(addr string) {
 
 	S.Users = make(map[int][]*Client)
 
+	S.sessionConfig = LoadSessionConfig()
+	if S.sessionConfig.SweepInterval > 0 {
+		go S.SweepSessionsLoop(S.sessionConfig.SweepInterval)
+	}
+	S.loginLimits = LoadLoginLimits()
+	S.oidc = LoadOIDCProvider()
+
+	if retention := NotificationRetention(); retention > 0 {
+		go S.PruneNotificationsLoop(retention)
+	}
+
+	S.mailer = mailer.LoadConfig().New()
+	S.outboxWake = make(chan struct{}, 1)
+	go S.DeliverOutboxLoop()
+	if interval := DigestInterval(); interval > 0 {
+		go S.NotificationDigestLoop(interval)
+	}
+
 	// CORS configuration
 	c := cors.New(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:3000"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "OPTIONS"},
-		AllowedHeaders:   []string{"Content-Type"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization"},
 		AllowCredentials: true,
 	})
 
@@ -48,82 +72,115 @@ func (S *Server) Run(addr string) {
 	}
 }
 
+// initRoutes registers every route. The scopes after a handler are the API
+// token scopes that may call it; account and security routes take sessions only.
 func (S *Server) initRoutes() {
 	S.mux.Handle("/uploads/", http.StripPrefix("/uploads/", http.FileServer(http.Dir("./uploads"))))
 
 	//user handlers
-	S.mux.HandleFunc("/api/register", S.RegisterHandler)
-	S.mux.HandleFunc("/api/upload-avatar", S.UploadAvatarHandler)
-	S.mux.HandleFunc("/api/user/update", S.UpdateProfileHandler)
+	S.handle("/api/register", Public, S.RegisterHandler)
+	S.handle("/api/upload-avatar", OptionalAuth, S.UploadAvatarHandler)
+	S.handle("/api/user/update", RequireAuth, S.UpdateProfileHandler)
 
 	//notification handlers
-	S.mux.HandleFunc("/api/notifications", S.GetNotificationsHandler)
-	S.mux.HandleFunc("/api/mark-notification-as-read/", S.MarkNotificationAsReadHandler)
-	S.mux.HandleFunc("/api/mark-all-notification-as-read", S.MarkAllNotificationAsReadHandler)
-	S.mux.HandleFunc("/api/delete-notification/", S.DeleteNotificationHandler)
+	S.handle("/api/notifications", RequireAuth, S.GetNotificationsHandler, ScopeRead)
+	S.handle("/api/notifications/unread-count", RequireAuth, S.UnreadNotificationsCountHandler, ScopeRead)
+	S.handle("/api/notification-settings", RequireAuth, S.NotificationSettingsHandler)
+	S.handle("/api/notification-mutes", RequireAuth, S.NotificationMuteHandler)
+	S.handle("/api/mark-notification-as-read/", RequireAuth, S.MarkNotificationAsReadHandler)
+	S.handle("/api/mark-all-notification-as-read", RequireAuth, S.MarkAllNotificationAsReadHandler)
+	S.handle("/api/delete-notification/", RequireAuth, S.DeleteNotificationHandler)
 
 	//Websocket handlers
-	S.mux.HandleFunc("/ws", S.WebSocketHandler)
+	S.handle("/ws", RequireAuth, S.WebSocketHandler)
 
 	//auth handlers
-	S.mux.HandleFunc("/api/login", S.LoginHandler)
-	S.mux.HandleFunc("/api/logged", S.LoggedHandler)
-	S.mux.HandleFunc("/api/logout", S.LogoutHandler)
+	S.handle("/api/login", Public, S.LoginHandler)
+	S.handle("/api/logged", OptionalAuth, S.LoggedHandler, ScopeRead)
+	S.handle("/api/logout", OptionalAuth, S.LogoutHandler)
+	S.handle("/api/login/2fa", Public, S.LoginTwoFactorHandler)
+	S.handle("/api/sessions", RequireAuth, S.SessionsHandler)
+	S.handle("/api/sessions/", RequireAuth, S.RevokeSessionHandler)
+	S.handle("/api/sessions/revoke-others", RequireAuth, S.RevokeOtherSessionsHandler)
+	S.handle("/api/2fa", RequireAuth, S.TwoFactorStatusHandler)
+	S.handle("/api/2fa/enroll", RequireAuth, S.EnrollTwoFactorHandler)
+	S.handle("/api/2fa/confirm", RequireAuth, S.ConfirmTwoFactorHandler)
+	S.handle("/api/2fa/disable", RequireAuth, S.DisableTwoFactorHandler)
+	S.handle("/api/password-reset/request", Public, S.RequestPasswordResetHandler)
+	S.handle("/api/password-reset/confirm", Public, S.ConfirmPasswordResetHandler)
+	S.handle("/api/verify-email", Public, S.VerifyEmailHandler)
+	S.handle("/api/verify-email/resend", RequireAuth, S.ResendVerificationHandler)
+	S.handle("/api/tokens", RequireAuth, S.AccessTokensHandler)
+	S.handle("/api/tokens/", RequireAuth, S.RevokeAccessTokenHandler)
+	S.handle("/api/oidc", Public, S.OIDCStatusHandler)
+	S.handle("/api/oidc/login", OptionalAuth, S.OIDCLoginHandler)
+	S.handle("/api/oidc/callback", Public, S.OIDCCallbackHandler)
+	S.handle("/api/oidc/identities", RequireAuth, S.OIDCIdentitiesHandler)
+	S.handle("/api/oidc/identities/", RequireAuth, S.UnlinkOIDCIdentityHandler)
 
 	//follow handlers
-	S.mux.HandleFunc("/api/follow", S.FollowHandler)
-	S.mux.HandleFunc("/api/unfollow", S.UnfollowHandler)
-	S.mux.HandleFunc("/api/cancel-follow-request", S.CancelFollowRequestHandler)
-	S.mux.HandleFunc("/api/accept-follow-request/", S.AcceptFollowRequestHandler)
-	S.mux.HandleFunc("/api/decline-follow-request/", S.DeclineFollowRequestHandler)
-	S.mux.HandleFunc("/api/send-follow-request", S.SendFollowRequestHandler)
-	S.mux.HandleFunc("/api/get-followers", S.GetFollowersHandler)
+	S.handle("/api/follow", RequireAuth, S.FollowHandler)
+	S.handle("/api/unfollow", RequireAuth, S.UnfollowHandler)
+	S.handle("/api/cancel-follow-request", RequireAuth, S.CancelFollowRequestHandler)
+	S.handle("/api/accept-follow-request/", RequireAuth, S.AcceptFollowRequestHandler)
+	S.handle("/api/decline-follow-request/", RequireAuth, S.DeclineFollowRequestHandler)
+	S.handle("/api/send-follow-request", RequireAuth, S.SendFollowRequestHandler)
+	S.handle("/api/get-followers", RequireAuth, S.GetFollowersHandler, ScopeRead)
 
 	//profile handlers
-	S.mux.HandleFunc("/api/profile/", S.ProfileHandler)
-	S.mux.HandleFunc("/api/me", S.MeHandler)
+	S.handle("/api/profile/", RequireAuth, S.ProfileHandler, ScopeRead)
+	S.handle("/api/me", RequireAuth, S.MeHandler, ScopeRead)
 
 	//post handlers
-	S.mux.HandleFunc("/api/like/", S.LikeHandler)
-	S.mux.HandleFunc("/api/create-post", S.CreatePostHandler)
-	S.mux.HandleFunc("/api/get-posts", S.GetPostsHandler)
-	S.mux.HandleFunc("/api/upload-post-file", S.UploadPostHandler)
+	S.handle("/api/like/", RequireAuth, S.LikeHandler, ScopePosts)
+	S.handle("/api/create-post", RequireVerified, S.CreatePostHandler, ScopePosts)
+	S.handle("/api/get-posts", RequireAuth, S.GetPostsHandler, ScopeRead)
+	S.handle("/api/upload-post-file", RequireVerified, S.UploadPostHandler, ScopePosts)
+	S.handle("/api/edit-post/", RequireAuth, S.EditPostHandler, ScopePosts)
+	S.handle("/api/delete-post/", RequireAuth, S.DeletePostHandler, ScopePosts)
+	S.handle("/api/post-revisions/", RequireAuth, S.GetPostRevisionsHandler, ScopeRead)
+	S.handle("/api/share-post/", RequireVerified, S.SharePostHandler, ScopePosts)
+	S.handle("/api/tags/", RequireAuth, S.GetTagPostsHandler, ScopeRead)
+	S.handle("/api/search", RequireAuth, S.SearchHandler, ScopeRead)
 
 	//comment handlers
-	S.mux.HandleFunc("/api/create-comment", S.CreateCommentHandler)
-	S.mux.HandleFunc("/api/get-comments/", S.GetCommentsHandler)
-	S.mux.HandleFunc("/api/like-comment/", S.LikeCommentHandler)
-	// S.mux.HandleFunc("/api/delete-comment/", S.DeleteCommentHandler)
+	S.handle("/api/create-comment", RequireVerified, S.CreateCommentHandler, ScopePosts)
+	S.handle("/api/get-comments/", OptionalAuth, S.GetCommentsHandler, ScopeRead)
+	S.handle("/api/like-comment/", RequireAuth, S.LikeCommentHandler, ScopePosts)
+	S.handle("/api/edit-comment/", RequireAuth, S.EditCommentHandler, ScopePosts)
+	S.handle("/api/delete-comment/", RequireAuth, S.DeleteCommentHandler, ScopePosts)
+	S.handle("/api/hide-comment/", RequireAuth, S.HideCommentHandler, ScopePosts)
+	S.handle("/api/comment-revisions/", RequireAuth, S.GetCommentRevisionsHandler, ScopeRead)
 
 	//message handlers
-	S.mux.HandleFunc("/api/get-users", S.GetUsersHandler)
-	S.mux.HandleFunc("/api/get-users/profile/", S.GetUserProfileHandler)
-	S.mux.HandleFunc("/api/make-message/", S.MakeChatHandler)
-	S.mux.HandleFunc("/api/send-message/", S.SendMessageHandler)
-	S.mux.HandleFunc("/api/get-messages/", S.GetMessagesHandler)
-	S.mux.HandleFunc("/api/upoad-file", S.UploadFileHandler)
-	S.mux.HandleFunc("/api/set-seen-chat/", S.SeenMessageHandler)
-	S.mux.HandleFunc("/api/unsend-message/", S.UnsendMessageHandler)
+	S.handle("/api/get-users", RequireAuth, S.GetUsersHandler, ScopeRead)
+	S.handle("/api/get-users/profile/", RequireAuth, S.GetUserProfileHandler, ScopeRead)
+	S.handle("/api/make-message/", RequireVerified, S.MakeChatHandler, ScopeMessages)
+	S.handle("/api/send-message/", RequireVerified, S.SendMessageHandler, ScopeMessages)
+	S.handle("/api/get-messages/", RequireAuth, S.GetMessagesHandler, ScopeRead)
+	S.handle("/api/upoad-file", RequireVerified, S.UploadFileHandler, ScopeMessages)
+	S.handle("/api/set-seen-chat/", RequireAuth, S.SeenMessageHandler, ScopeMessages)
+	S.handle("/api/unsend-message/", RequireAuth, S.UnsendMessageHandler, ScopeMessages)
 
 	// Group handlers
-	S.mux.HandleFunc("/api/groups/create", S.CreateGroupHandler)
-	S.mux.HandleFunc("/api/groups", S.GetGroupsHandler)
-	S.mux.HandleFunc("/api/groups/", S.GetGroupHandler)
-	S.mux.HandleFunc("/api/groups/update", S.UpdateGroupHandler)
-	S.mux.HandleFunc("/api/groups/delete/", S.DeleteGroupHandler)
-	S.mux.HandleFunc("/api/groups/join", S.JoinGroupRequestHandler)
-	S.mux.HandleFunc("/api/groups/invite", S.InviteGroupMemberHandler)
-	S.mux.HandleFunc("/api/groups/requests/accept/", S.AcceptGroupRequestHandler)
-	S.mux.HandleFunc("/api/groups/requests/decline/", S.DeclineGroupRequestHandler)
-	S.mux.HandleFunc("/api/groups/requests", S.GetGroupRequestsHandler)
-	S.mux.HandleFunc("/api/groups/posts/create", S.CreateGroupPostHandler)
-	S.mux.HandleFunc("/api/groups/posts/", S.GetGroupPostsHandler)
-	S.mux.HandleFunc("/api/groups/events/create", S.CreateGroupEventHandler)
-	S.mux.HandleFunc("/api/groups/events/", S.GetGroupEventsHandler)
-	S.mux.HandleFunc("/api/groups/events/respond", S.RespondToGroupEventHandler)
-	S.mux.HandleFunc("/api/groups/chat/", S.GetGroupChatHandler)
-	S.mux.HandleFunc("/api/groups/chat/send", S.SendGroupMessageHandler)
-	S.mux.HandleFunc("/api/groups/members/", S.GetGroupMembersHandler)
+	S.handle("/api/groups/create", RequireVerified, S.CreateGroupHandler, ScopeGroups)
+	S.handle("/api/groups", OptionalAuth, S.GetGroupsHandler, ScopeRead)
+	S.handle("/api/groups/", OptionalAuth, S.GetGroupHandler, ScopeRead)
+	S.handle("/api/groups/update", RequireAuth, S.UpdateGroupHandler, ScopeGroups)
+	S.handle("/api/groups/delete/", RequireAuth, S.DeleteGroupHandler, ScopeGroups)
+	S.handle("/api/groups/join", RequireAuth, S.JoinGroupRequestHandler, ScopeGroups)
+	S.handle("/api/groups/invite", RequireAuth, S.InviteGroupMemberHandler, ScopeGroups)
+	S.handle("/api/groups/requests/accept/", RequireAuth, S.AcceptGroupRequestHandler, ScopeGroups)
+	S.handle("/api/groups/requests/decline/", RequireAuth, S.DeclineGroupRequestHandler, ScopeGroups)
+	S.handle("/api/groups/requests", RequireAuth, S.GetGroupRequestsHandler, ScopeRead)
+	S.handle("/api/groups/posts/create", RequireVerified, S.CreateGroupPostHandler, ScopeGroups)
+	S.handle("/api/groups/posts/", RequireAuth, S.GetGroupPostsHandler, ScopeRead)
+	S.handle("/api/groups/events/create", RequireAuth, S.CreateGroupEventHandler, ScopeGroups)
+	S.handle("/api/groups/events/", RequireAuth, S.GetGroupEventsHandler, ScopeRead)
+	S.handle("/api/groups/events/respond", RequireAuth, S.RespondToGroupEventHandler, ScopeGroups)
+	S.handle("/api/groups/chat/", RequireAuth, S.GetGroupChatHandler, ScopeRead)
+	S.handle("/api/groups/chat/send", RequireVerified, S.SendGroupMessageHandler, ScopeGroups)
+	S.handle("/api/groups/members/", RequireAuth, S.GetGroupMembersHandler, ScopeRead)
 }
 
 func (S *Server) initWebSocket() {
@@ -0,0 +1,190 @@
+package backend
+
+import (
+	"SOCIAL-NETWORK/pkg/db/postgresql"
+	"SOCIAL-NETWORK/pkg/db/sqlite"
+	"SOCIAL-NETWORK/pkg/totp"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/twinj/uuid"
+)
+
+func TestMain(m *testing.M) {
+	// migrations and request logs drown the test output
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// newTestServer returns a server with all routes on a fresh, migrated sqlite
+// database that is removed when the test ends
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	conn := sqlite.ConnectAndMigrate(filepath.Join(t.TempDir(), "test.db"), "../db/migrations/sqlite")
+	return newTestServerOn(t, NewDB(conn, "sqlite"))
+}
+
+// newTestServerOn returns a server with all routes on db, which is closed when
+// the test ends
+func newTestServerOn(t *testing.T, db *DB) *Server {
+	t.Helper()
+	S := &Server{
+		db:            db,
+		mux:           http.NewServeMux(),
+		Users:         make(map[int][]*Client),
+		outboxWake:    make(chan struct{}, 1),
+		sessionConfig: LoadSessionConfig(),
+		loginLimits:   LoadLoginLimits(),
+	}
+	S.initRoutes()
+	t.Cleanup(func() { S.db.Close() })
+	return S
+}
+
+// forEachDriver runs test on a fresh sqlite database and, when
+// TEST_DATABASE_URL points at a postgres server, on a fresh schema there that
+// is dropped afterwards
+func forEachDriver(t *testing.T, test func(t *testing.T, S *Server)) {
+	t.Run("sqlite", func(t *testing.T) { test(t, newTestServer(t)) })
+	t.Run("postgres", func(t *testing.T) {
+		dsn := os.Getenv("TEST_DATABASE_URL")
+		if dsn == "" {
+			t.Skip("TEST_DATABASE_URL is not set")
+		}
+		admin, err := sql.Open("postgres", dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer admin.Close()
+		schema := "test_" + strings.ReplaceAll(uuid.NewV4().String(), "-", "")
+		if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			if admin, err := sql.Open("postgres", dsn); err == nil {
+				admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`)
+				admin.Close()
+			}
+		})
+
+		u, err := url.Parse(dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q := u.Query()
+		q.Set("search_path", schema)
+		u.RawQuery = q.Encode()
+		pg := &postgresql.Config{DatabaseURL: u.String(), MigrationsDir: "../db/migrations/postgresql"}
+		test(t, newTestServerOn(t, NewDB(pg.ConnectAndMigrate(), "postgres")))
+	})
+}
+
+// testUser is an account created by createTestUser with a live session
+type testUser struct {
+	ID      int
+	Email   string
+	Session *http.Cookie
+}
+
+// createTestUser adds a verified account named name (its email is
+// name@example.com, its password "pass1234") and signs it in
+func createTestUser(t *testing.T, S *Server, name string, private bool) testUser {
+	t.Helper()
+	u := User{
+		Email:       name + "@example.com",
+		Password:    "pass1234",
+		FirstName:   name,
+		LastName:    "Test",
+		DateOfBirth: "2000-01-01T00:00:00.000Z",
+		Gender:      "other",
+		Nickname:    name,
+		Url:         name,
+		AvatarUrl:   defaultAvatar,
+	}
+	id, err := S.AddUser(u, t.Context())
+	if err != nil {
+		t.Fatalf("add user %s: %v", name, err)
+	}
+	if _, err := S.db.Exec(`UPDATE users SET is_private = ?, email_verified_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		private, id); err != nil {
+		t.Fatalf("update user %s: %v", name, err)
+	}
+
+	rec := httptest.NewRecorder()
+	S.MakeToken(rec, httptest.NewRequest(http.MethodPost, "/api/login", nil), id, false)
+	var session *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "session_token" {
+			session = c
+		}
+	}
+	if session == nil {
+		t.Fatalf("no session cookie for %s", name)
+	}
+	return testUser{ID: id, Email: u.Email, Session: session}
+}
+
+// do sends method path with body encoded as JSON through the routes, signed
+// in as user unless it is nil
+func do(t *testing.T, S *Server, user *testUser, method, path string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var r io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		r = strings.NewReader(b)
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, r)
+	req.Header.Set("Content-Type", "application/json")
+	if user != nil {
+		req.AddCookie(user.Session)
+	}
+	rec := httptest.NewRecorder()
+	S.mux.ServeHTTP(rec, req)
+	return rec
+}
+
+// count runs a SELECT COUNT(*) query
+func count(t *testing.T, S *Server, query string, args ...any) int {
+	t.Helper()
+	var n int
+	if err := S.db.QueryRow(query, args...).Scan(&n); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return n
+}
+
+// enableTestTwoFactor turns on 2FA for user and returns its TOTP secret
+func enableTestTwoFactor(t *testing.T, S *Server, user testUser) []byte {
+	t.Helper()
+	t.Setenv("MFA_ENCRYPTION_KEY", strings.Repeat("0f", 32))
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := sealSecret(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := S.db.Exec(`INSERT INTO user_totp (user_id, secret_enc, enabled_at) VALUES (?, ?, CURRENT_TIMESTAMP)`,
+		user.ID, sealed); err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
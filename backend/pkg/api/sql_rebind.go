@@ -3,20 +3,57 @@ package backend
 import (
 	"context"
 	"database/sql"
+	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 )
 
+// DB wraps *sql.DB and rewrites the `?` placeholders used across the
+// handlers into the bind style of the selected driver.
 type DB struct {
-	inner *sql.DB
+	inner  *sql.DB
+	driver string
+	bind   int
 }
 
 type Tx struct {
 	inner *sql.Tx
+	bind  int
 }
 
-func NewDB(inner *sql.DB) *DB {
-	return &DB{inner: inner}
+func NewDB(inner *sql.DB, driver string) *DB {
+	bind := sqlx.BindType(driver)
+	if bind == sqlx.UNKNOWN {
+		bind = sqlx.QUESTION
+	}
+	return &DB{inner: inner, driver: driver, bind: bind}
+}
+
+// Driver returns the driver name the DB was opened with ("sqlite" or "postgres")
+func (db *DB) Driver() string {
+	return db.driver
+}
+
+// Timestamp converts t into a value that compares correctly with the
+// DATETIME/TIMESTAMP columns of the driver (sqlite stores them as UTC text).
+func (db *DB) Timestamp(t time.Time) any {
+	if db.driver == "sqlite" {
+		return t.UTC().Format("2006-01-02 15:04:05")
+	}
+	return t.UTC()
+}
+
+func (db *DB) rebind(query string) string {
+	return sqlx.Rebind(db.bind, query)
+}
+
+// Placeholders returns "?, ?, ..." with n bind variables for an IN (...) list
+func Placeholders(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	return strings.Repeat("?, ", n-1) + "?"
 }
 
 func (db *DB) Close() error {
@@ -28,43 +65,43 @@ func (db *DB) Begin() (*Tx, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Tx{inner: tx}, nil
+	return &Tx{inner: tx, bind: db.bind}, nil
 }
 
 func (db *DB) Exec(query string, args ...any) (sql.Result, error) {
-	return db.inner.Exec(sqlx.Rebind(sqlx.DOLLAR, query), args...)
+	return db.inner.Exec(db.rebind(query), args...)
 }
 
 func (db *DB) Query(query string, args ...any) (*sql.Rows, error) {
-	return db.inner.Query(sqlx.Rebind(sqlx.DOLLAR, query), args...)
+	return db.inner.Query(db.rebind(query), args...)
 }
 
 func (db *DB) QueryRow(query string, args ...any) *sql.Row {
-	return db.inner.QueryRow(sqlx.Rebind(sqlx.DOLLAR, query), args...)
+	return db.inner.QueryRow(db.rebind(query), args...)
 }
 
 func (db *DB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
-	return db.inner.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, query), args...)
+	return db.inner.ExecContext(ctx, db.rebind(query), args...)
 }
 
 func (db *DB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
-	return db.inner.QueryContext(ctx, sqlx.Rebind(sqlx.DOLLAR, query), args...)
+	return db.inner.QueryContext(ctx, db.rebind(query), args...)
 }
 
 func (db *DB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
-	return db.inner.QueryRowContext(ctx, sqlx.Rebind(sqlx.DOLLAR, query), args...)
+	return db.inner.QueryRowContext(ctx, db.rebind(query), args...)
 }
 
 func (tx *Tx) Exec(query string, args ...any) (sql.Result, error) {
-	return tx.inner.Exec(sqlx.Rebind(sqlx.DOLLAR, query), args...)
+	return tx.inner.Exec(sqlx.Rebind(tx.bind, query), args...)
 }
 
 func (tx *Tx) Query(query string, args ...any) (*sql.Rows, error) {
-	return tx.inner.Query(sqlx.Rebind(sqlx.DOLLAR, query), args...)
+	return tx.inner.Query(sqlx.Rebind(tx.bind, query), args...)
 }
 
 func (tx *Tx) QueryRow(query string, args ...any) *sql.Row {
-	return tx.inner.QueryRow(sqlx.Rebind(sqlx.DOLLAR, query), args...)
+	return tx.inner.QueryRow(sqlx.Rebind(tx.bind, query), args...)
 }
 
 func (tx *Tx) Commit() error {
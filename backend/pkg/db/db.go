@@ -0,0 +1,82 @@
+package db
+
+import (
+	"SOCIAL-NETWORK/pkg/db/postgresql"
+	"SOCIAL-NETWORK/pkg/db/sqlite"
+	"database/sql"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+)
+
+// Supported values for DB_DRIVER
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+const (
+	defaultSQLitePath      = "pkg/db/migrations/app.db"
+	defaultSQLiteMigration = "pkg/db/migrations/sqlite"
+	defaultPgMigration     = "pkg/db/migrations/postgresql"
+)
+
+// Config selects the database backend at runtime.
+type Config struct {
+	Driver        string
+	DatabaseURL   string
+	SQLitePath    string
+	MigrationsDir string
+}
+
+// LoadConfig reads the database settings from the environment (and .env if present).
+// Without DB_DRIVER, postgres is used when DATABASE_URL is set and sqlite otherwise.
+func LoadConfig() *Config {
+	if err := godotenv.Load(); err != nil && !os.IsNotExist(err) {
+		log.Printf("Error loading .env file: %v", err)
+	}
+
+	c := &Config{
+		Driver:        os.Getenv("DB_DRIVER"),
+		DatabaseURL:   os.Getenv("DATABASE_URL"),
+		SQLitePath:    os.Getenv("SQLITE_PATH"),
+		MigrationsDir: os.Getenv("MIGRATIONS_DIR"),
+	}
+
+	if c.Driver == "" {
+		if c.DatabaseURL != "" {
+			c.Driver = DriverPostgres
+		} else {
+			c.Driver = DriverSQLite
+		}
+	}
+	if c.Driver == "postgresql" {
+		c.Driver = DriverPostgres
+	}
+
+	if c.SQLitePath == "" {
+		c.SQLitePath = defaultSQLitePath
+	}
+	if c.MigrationsDir == "" {
+		if c.Driver == DriverPostgres {
+			c.MigrationsDir = defaultPgMigration
+		} else {
+			c.MigrationsDir = defaultSQLiteMigration
+		}
+	}
+	return c
+}
+
+// ConnectAndMigrate opens the configured database and applies its migrations
+func (c *Config) ConnectAndMigrate() *sql.DB {
+	switch c.Driver {
+	case DriverPostgres:
+		pg := &postgresql.Config{DatabaseURL: c.DatabaseURL, MigrationsDir: c.MigrationsDir}
+		return pg.ConnectAndMigrate()
+	case DriverSQLite:
+		return sqlite.ConnectAndMigrate(c.SQLitePath, c.MigrationsDir)
+	}
+	log.Fatalf("Unknown DB_DRIVER %q (expected %q or %q)", c.Driver, DriverSQLite, DriverPostgres)
+	return nil
+}
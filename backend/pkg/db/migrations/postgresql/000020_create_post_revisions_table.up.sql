@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS post_revisions (
+    id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    post_id INTEGER NOT NULL,
+    content TEXT NOT NULL,
+    image TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE
+);
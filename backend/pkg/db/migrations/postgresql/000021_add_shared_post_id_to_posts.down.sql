@@ -0,0 +1 @@
+ALTER TABLE posts DROP COLUMN IF EXISTS shared_post_id;
\ No newline at end of file
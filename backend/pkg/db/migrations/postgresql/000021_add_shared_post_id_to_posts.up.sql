@@ -0,0 +1,2 @@
+ALTER TABLE posts
+ADD COLUMN IF NOT EXISTS shared_post_id INTEGER REFERENCES posts (id) ON DELETE SET NULL;
\ No newline at end of file
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_groups_search;
+ALTER TABLE groups DROP COLUMN IF EXISTS search;
+DROP INDEX IF EXISTS idx_posts_search;
+ALTER TABLE posts DROP COLUMN IF EXISTS search;
+DROP INDEX IF EXISTS idx_users_search;
+ALTER TABLE users DROP COLUMN IF EXISTS search;
@@ -0,0 +1,26 @@
+-- tsvector columns used by /api/search, 'simple' so results match the SQLite FTS5 index
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS search tsvector GENERATED ALWAYS AS (
+    to_tsvector(
+        'simple',
+        coalesce(first_name, '') || ' ' || coalesce(last_name, '') || ' ' ||
+        coalesce(nickname, '') || ' ' || coalesce(url, '')
+    )
+) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_users_search ON users USING GIN (search);
+
+ALTER TABLE posts
+ADD COLUMN IF NOT EXISTS search tsvector GENERATED ALWAYS AS (
+    to_tsvector('simple', content)
+) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_posts_search ON posts USING GIN (search);
+
+ALTER TABLE groups
+ADD COLUMN IF NOT EXISTS search tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', title), 'A') ||
+    setweight(to_tsvector('simple', coalesce(description, '')), 'B')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_groups_search ON groups USING GIN (search);
@@ -0,0 +1,19 @@
+ALTER TABLE comments
+ADD COLUMN IF NOT EXISTS is_hidden BOOLEAN DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS comment_revisions (
+    id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    comment_id INTEGER NOT NULL,
+    content TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (comment_id) REFERENCES comments (id) ON DELETE CASCADE
+);
+
+UPDATE posts SET comments = (
+    SELECT COUNT(*) FROM comments c
+    WHERE c.post_id = posts.id AND c.parent_comment_id IS NULL
+);
+
+UPDATE comments SET replies = (
+    SELECT COUNT(*) FROM comments r WHERE r.parent_comment_id = comments.id
+);
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS notification_actors;
+DROP INDEX IF EXISTS idx_notifications_target;
+ALTER TABLE notifications
+DROP COLUMN IF EXISTS event_id,
+DROP COLUMN IF EXISTS group_id,
+DROP COLUMN IF EXISTS comment_id,
+DROP COLUMN IF EXISTS post_id;
@@ -0,0 +1,20 @@
+ALTER TABLE notifications
+ADD COLUMN IF NOT EXISTS post_id INTEGER REFERENCES posts (id) ON DELETE CASCADE,
+ADD COLUMN IF NOT EXISTS comment_id INTEGER REFERENCES comments (id) ON DELETE CASCADE,
+ADD COLUMN IF NOT EXISTS group_id INTEGER REFERENCES groups (id) ON DELETE CASCADE,
+ADD COLUMN IF NOT EXISTS event_id INTEGER REFERENCES events (id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_notifications_target ON notifications (user_id, type, post_id, comment_id, group_id, event_id);
+
+CREATE TABLE IF NOT EXISTS notification_actors (
+    notification_id INTEGER NOT NULL,
+    actor_id INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (notification_id, actor_id),
+    FOREIGN KEY (notification_id) REFERENCES notifications (id) ON DELETE CASCADE,
+    FOREIGN KEY (actor_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+INSERT INTO notification_actors (notification_id, actor_id, created_at)
+SELECT id, actor_id, created_at FROM notifications
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,21 @@
+-- emails wait here until the mailer accepts them, failed sends are retried
+CREATE TABLE IF NOT EXISTS email_outbox (
+    id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    to_address TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    text_body TEXT NOT NULL,
+    html_body TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    sent_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_outbox_pending ON email_outbox (sent_at, next_attempt_at);
+
+CREATE TABLE IF NOT EXISTS notification_digests (
+    user_id INTEGER PRIMARY KEY,
+    last_sent_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_sessions_user;
+ALTER TABLE sessions
+DROP COLUMN IF EXISTS last_seen_at,
+DROP COLUMN IF EXISTS created_at,
+DROP COLUMN IF EXISTS ip,
+DROP COLUMN IF EXISTS user_agent;
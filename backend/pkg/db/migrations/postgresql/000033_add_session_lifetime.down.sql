@@ -0,0 +1,5 @@
+ALTER TABLE pending_logins DROP COLUMN IF EXISTS remember;
+DROP INDEX IF EXISTS idx_sessions_expires;
+ALTER TABLE sessions
+DROP COLUMN IF EXISTS absolute_expires_at,
+DROP COLUMN IF EXISTS remember;
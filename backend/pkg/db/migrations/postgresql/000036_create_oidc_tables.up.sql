@@ -0,0 +1,28 @@
+-- accounts at an OpenID provider signed in as a user, by issuer and subject
+CREATE TABLE IF NOT EXISTS oidc_identities (
+    id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    issuer TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    email TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_login_at TIMESTAMP,
+    UNIQUE (issuer, subject),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_oidc_identities_user ON oidc_identities (user_id);
+
+-- a sign-in sent to the provider and waiting for its callback; link_user_id is
+-- set when a signed-in user links the provider to their account
+CREATE TABLE IF NOT EXISTS oidc_logins (
+    id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    state_hash TEXT NOT NULL UNIQUE,
+    code_verifier TEXT NOT NULL,
+    nonce TEXT NOT NULL,
+    link_user_id INTEGER,
+    remember BOOLEAN NOT NULL DEFAULT FALSE,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (link_user_id) REFERENCES users (id) ON DELETE CASCADE
+);
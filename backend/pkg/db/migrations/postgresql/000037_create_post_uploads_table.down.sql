@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_post_uploads_user;
+DROP TABLE IF EXISTS post_uploads;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_avatar_uploads_user;
+DROP TABLE IF EXISTS avatar_uploads;
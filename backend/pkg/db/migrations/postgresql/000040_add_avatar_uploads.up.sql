@@ -0,0 +1,17 @@
+-- files saved by the avatar upload endpoint and who they belong to; uploads
+-- made while registering have no user until the new account claims them
+CREATE TABLE IF NOT EXISTS avatar_uploads (
+    id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    user_id INTEGER,
+    path TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_avatar_uploads_user ON avatar_uploads (user_id);
+
+-- avatars already in use belong to the first account that has them
+INSERT INTO avatar_uploads (user_id, path)
+SELECT MIN(id), avatar FROM users
+WHERE avatar LIKE '/uploads/Avatars/%'
+GROUP BY avatar;
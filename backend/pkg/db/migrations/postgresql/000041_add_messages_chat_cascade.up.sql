@@ -0,0 +1,3 @@
+-- messages.chat_id already cascades since 000014, this only keeps the
+-- version numbers aligned with the sqlite migrations.
+SELECT 1;
@@ -0,0 +1,4 @@
+-- SQLite cannot add a constraint to an existing table.
+-- messages.chat_id already references chats(id) in 000008, so this only keeps
+-- the version numbers aligned with the postgresql migrations.
+SELECT 1;
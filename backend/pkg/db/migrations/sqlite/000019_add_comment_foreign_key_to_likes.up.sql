@@ -0,0 +1,4 @@
+-- SQLite cannot add a constraint to an existing table.
+-- likes.comment_id already references comments(id) in 000015, so this only keeps
+-- the version numbers aligned with the postgresql migrations.
+SELECT 1;
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS post_revisions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    post_id INTEGER NOT NULL,
+    content TEXT NOT NULL, -- content before the edit
+    image TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP, -- when the edit replaced it
+    FOREIGN KEY(post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
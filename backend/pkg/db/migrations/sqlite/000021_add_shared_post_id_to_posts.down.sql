@@ -0,0 +1 @@
+ALTER TABLE posts DROP COLUMN shared_post_id;
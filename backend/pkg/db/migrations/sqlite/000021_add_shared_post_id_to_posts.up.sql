@@ -0,0 +1 @@
+ALTER TABLE posts ADD COLUMN shared_post_id INTEGER REFERENCES posts(id) ON DELETE SET NULL;
@@ -0,0 +1,61 @@
+-- FTS5 indexes kept in sync with their tables by triggers, used by /api/search.
+
+CREATE VIRTUAL TABLE IF NOT EXISTS users_fts USING fts5(
+    first_name, last_name, nickname, url,
+    content='users', content_rowid='id'
+);
+
+CREATE TRIGGER IF NOT EXISTS users_fts_insert AFTER INSERT ON users BEGIN
+    INSERT INTO users_fts(rowid, first_name, last_name, nickname, url) VALUES (new.id, new.first_name, new.last_name, new.nickname, new.url);
+END;
+
+CREATE TRIGGER IF NOT EXISTS users_fts_delete AFTER DELETE ON users BEGIN
+    INSERT INTO users_fts(users_fts, rowid, first_name, last_name, nickname, url) VALUES ('delete', old.id, old.first_name, old.last_name, old.nickname, old.url);
+END;
+
+CREATE TRIGGER IF NOT EXISTS users_fts_update AFTER UPDATE OF first_name, last_name, nickname, url ON users BEGIN
+    INSERT INTO users_fts(users_fts, rowid, first_name, last_name, nickname, url) VALUES ('delete', old.id, old.first_name, old.last_name, old.nickname, old.url);
+    INSERT INTO users_fts(rowid, first_name, last_name, nickname, url) VALUES (new.id, new.first_name, new.last_name, new.nickname, new.url);
+END;
+
+INSERT INTO users_fts(users_fts) VALUES ('rebuild');
+
+CREATE VIRTUAL TABLE IF NOT EXISTS posts_fts USING fts5(
+    content,
+    content='posts', content_rowid='id'
+);
+
+CREATE TRIGGER IF NOT EXISTS posts_fts_insert AFTER INSERT ON posts BEGIN
+    INSERT INTO posts_fts(rowid, content) VALUES (new.id, new.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS posts_fts_delete AFTER DELETE ON posts BEGIN
+    INSERT INTO posts_fts(posts_fts, rowid, content) VALUES ('delete', old.id, old.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS posts_fts_update AFTER UPDATE OF content ON posts BEGIN
+    INSERT INTO posts_fts(posts_fts, rowid, content) VALUES ('delete', old.id, old.content);
+    INSERT INTO posts_fts(rowid, content) VALUES (new.id, new.content);
+END;
+
+INSERT INTO posts_fts(posts_fts) VALUES ('rebuild');
+
+CREATE VIRTUAL TABLE IF NOT EXISTS groups_fts USING fts5(
+    title, description,
+    content='groups', content_rowid='id'
+);
+
+CREATE TRIGGER IF NOT EXISTS groups_fts_insert AFTER INSERT ON groups BEGIN
+    INSERT INTO groups_fts(rowid, title, description) VALUES (new.id, new.title, new.description);
+END;
+
+CREATE TRIGGER IF NOT EXISTS groups_fts_delete AFTER DELETE ON groups BEGIN
+    INSERT INTO groups_fts(groups_fts, rowid, title, description) VALUES ('delete', old.id, old.title, old.description);
+END;
+
+CREATE TRIGGER IF NOT EXISTS groups_fts_update AFTER UPDATE OF title, description ON groups BEGIN
+    INSERT INTO groups_fts(groups_fts, rowid, title, description) VALUES ('delete', old.id, old.title, old.description);
+    INSERT INTO groups_fts(rowid, title, description) VALUES (new.id, new.title, new.description);
+END;
+
+INSERT INTO groups_fts(groups_fts) VALUES ('rebuild');
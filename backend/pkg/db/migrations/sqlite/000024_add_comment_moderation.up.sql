@@ -0,0 +1,20 @@
+-- hidden comments are only shown to their author and the post author
+ALTER TABLE comments ADD COLUMN is_hidden BOOLEAN DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS comment_revisions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    comment_id INTEGER NOT NULL,
+    content TEXT NOT NULL, -- content before the edit
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(comment_id) REFERENCES comments(id) ON DELETE CASCADE
+);
+
+-- posts.comments counts visible top-level comments, comments.replies visible direct replies
+UPDATE posts SET comments = (
+    SELECT COUNT(*) FROM comments c
+    WHERE c.post_id = posts.id AND c.parent_comment_id IS NULL
+);
+
+UPDATE comments SET replies = (
+    SELECT COUNT(*) FROM comments r WHERE r.parent_comment_id = comments.id
+);
@@ -0,0 +1,3 @@
+CREATE INDEX IF NOT EXISTS idx_notifications_user_created ON notifications (user_id, created_at, id);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user_unread ON notifications (user_id, is_read);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS notification_actors;
+DROP INDEX IF EXISTS idx_notifications_target;
+ALTER TABLE notifications DROP COLUMN event_id;
+ALTER TABLE notifications DROP COLUMN group_id;
+ALTER TABLE notifications DROP COLUMN comment_id;
+ALTER TABLE notifications DROP COLUMN post_id;
@@ -0,0 +1,20 @@
+-- one row per user and notification type, missing rows use the defaults
+CREATE TABLE IF NOT EXISTS notification_settings (
+    user_id INTEGER NOT NULL,
+    type TEXT NOT NULL,
+    in_app BOOLEAN DEFAULT 1, -- stored in the notifications list
+    live BOOLEAN DEFAULT 1, -- pushed over the WebSocket
+    email_digest BOOLEAN DEFAULT 0,
+    PRIMARY KEY (user_id, type),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- target_type is user, post or group
+CREATE TABLE IF NOT EXISTS notification_mutes (
+    user_id INTEGER NOT NULL,
+    target_type TEXT NOT NULL,
+    target_id INTEGER NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, target_type, target_id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
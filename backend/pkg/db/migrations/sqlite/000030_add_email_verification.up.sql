@@ -0,0 +1,14 @@
+-- users start unverified; accounts made before this migration count as verified
+ALTER TABLE users ADD COLUMN email_verified_at DATETIME;
+UPDATE users SET email_verified_at = CURRENT_TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS email_verifications (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_verifications_user ON email_verifications (user_id, created_at);
@@ -0,0 +1,8 @@
+-- what the account security page shows about each login
+ALTER TABLE sessions ADD COLUMN user_agent TEXT;
+ALTER TABLE sessions ADD COLUMN ip TEXT;
+ALTER TABLE sessions ADD COLUMN created_at DATETIME;
+ALTER TABLE sessions ADD COLUMN last_seen_at DATETIME;
+UPDATE sessions SET created_at = CURRENT_TIMESTAMP, last_seen_at = CURRENT_TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions (user_id);
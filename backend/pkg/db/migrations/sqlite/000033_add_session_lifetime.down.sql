@@ -0,0 +1,4 @@
+ALTER TABLE pending_logins DROP COLUMN remember;
+DROP INDEX IF EXISTS idx_sessions_expires;
+ALTER TABLE sessions DROP COLUMN absolute_expires_at;
+ALTER TABLE sessions DROP COLUMN remember;
@@ -0,0 +1,9 @@
+-- expires_at slides forward while the session is used, absolute_expires_at
+-- never moves; remember-me sessions get the longer timeouts
+ALTER TABLE sessions ADD COLUMN remember BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE sessions ADD COLUMN absolute_expires_at DATETIME;
+UPDATE sessions SET absolute_expires_at = expires_at;
+
+CREATE INDEX IF NOT EXISTS idx_sessions_expires ON sessions (expires_at);
+
+ALTER TABLE pending_logins ADD COLUMN remember BOOLEAN NOT NULL DEFAULT 0;
@@ -0,0 +1,13 @@
+-- failed logins counted per account (subject = user id) and per client IP;
+-- no login is tried for that scope and subject before blocked_until
+CREATE TABLE IF NOT EXISTS login_attempts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    scope TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at DATETIME NOT NULL,
+    blocked_until DATETIME,
+    UNIQUE (scope, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_attempts_last_failure ON login_attempts (last_failure_at);
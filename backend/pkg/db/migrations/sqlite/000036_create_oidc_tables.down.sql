@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS oidc_logins;
+DROP INDEX IF EXISTS idx_oidc_identities_user;
+DROP TABLE IF EXISTS oidc_identities;
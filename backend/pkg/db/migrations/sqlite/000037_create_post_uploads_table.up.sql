@@ -0,0 +1,11 @@
+-- files saved by the post upload endpoint and who uploaded them; a post can
+-- only use an uploaded file that belongs to its author
+CREATE TABLE IF NOT EXISTS post_uploads (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    path TEXT NOT NULL UNIQUE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_uploads_user ON post_uploads (user_id);
@@ -0,0 +1,2 @@
+-- replies are read per parent, oldest first
+CREATE INDEX IF NOT EXISTS idx_comments_parent ON comments (parent_comment_id, created_at, id);
@@ -0,0 +1,30 @@
+-- one notification per receiver, type and target, so that concurrent actions
+-- can't start the same group twice. Rows that were already duplicated are
+-- folded into the newest one first.
+INSERT INTO notification_actors (notification_id, actor_id, created_at)
+SELECT (SELECT MAX(k.id) FROM notifications k
+        WHERE k.user_id = n.user_id AND k.type = n.type
+          AND COALESCE(k.post_id, 0) = COALESCE(n.post_id, 0)
+          AND COALESCE(k.comment_id, 0) = COALESCE(n.comment_id, 0)
+          AND COALESCE(k.group_id, 0) = COALESCE(n.group_id, 0)
+          AND COALESCE(k.event_id, 0) = COALESCE(n.event_id, 0)),
+       na.actor_id, na.created_at
+FROM notifications n
+JOIN notification_actors na ON na.notification_id = n.id
+WHERE n.post_id IS NOT NULL OR n.comment_id IS NOT NULL OR n.group_id IS NOT NULL OR n.event_id IS NOT NULL
+ON CONFLICT (notification_id, actor_id) DO NOTHING;
+
+DELETE FROM notifications
+WHERE (post_id IS NOT NULL OR comment_id IS NOT NULL OR group_id IS NOT NULL OR event_id IS NOT NULL)
+  AND id < (SELECT MAX(k.id) FROM notifications k
+            WHERE k.user_id = notifications.user_id AND k.type = notifications.type
+              AND COALESCE(k.post_id, 0) = COALESCE(notifications.post_id, 0)
+              AND COALESCE(k.comment_id, 0) = COALESCE(notifications.comment_id, 0)
+              AND COALESCE(k.group_id, 0) = COALESCE(notifications.group_id, 0)
+              AND COALESCE(k.event_id, 0) = COALESCE(notifications.event_id, 0));
+
+DELETE FROM notification_actors WHERE notification_id NOT IN (SELECT id FROM notifications);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_notifications_group ON notifications
+    (user_id, type, COALESCE(post_id, 0), COALESCE(comment_id, 0), COALESCE(group_id, 0), COALESCE(event_id, 0))
+    WHERE post_id IS NOT NULL OR comment_id IS NOT NULL OR group_id IS NOT NULL OR event_id IS NOT NULL;
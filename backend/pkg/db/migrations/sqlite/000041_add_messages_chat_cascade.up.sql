@@ -0,0 +1,24 @@
+-- deleting a chat deletes its messages, as in postgresql 000014. SQLite
+-- cannot change a constraint in place, so the table is rebuilt; migrations
+-- run without foreign key enforcement, so the copy doesn't trip it.
+CREATE TABLE messages_new (
+    backend_id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    id TEXT NOT NULL UNIQUE,
+    chat_id INTEGER NOT NULL,
+    sender_id INTEGER NOT NULL,
+    content TEXT,
+    type TEXT CHECK(type IN ('text', 'emoji', 'gif', 'image')),
+    reply_to TEXT,
+    is_read BOOLEAN DEFAULT 0,
+    read_at TIMESTAMP DEFAULT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(chat_id) REFERENCES chats(id) ON DELETE CASCADE,
+    FOREIGN KEY(sender_id) REFERENCES users(id),
+    FOREIGN KEY(reply_to) REFERENCES messages(id)
+);
+
+INSERT INTO messages_new (backend_id, id, chat_id, sender_id, content, type, reply_to, is_read, read_at, created_at)
+SELECT backend_id, id, chat_id, sender_id, content, type, reply_to, is_read, read_at, created_at FROM messages;
+
+DROP TABLE messages;
+ALTER TABLE messages_new RENAME TO messages;
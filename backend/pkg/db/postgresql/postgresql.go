@@ -14,7 +14,8 @@ import (
 )
 
 type Config struct {
-	DatabaseURL string
+	DatabaseURL   string
+	MigrationsDir string
 }
 
 func (c *Config) DSN() {
@@ -26,7 +27,12 @@ func (c *Config) DSN() {
 }
 
 func (c *Config) ConnectAndMigrate() *sql.DB {
-	c.DSN()
+	if c.DatabaseURL == "" {
+		c.DSN()
+	}
+	if c.MigrationsDir == "" {
+		c.MigrationsDir = "pkg/db/migrations/postgresql"
+	}
 
 	// Open a database/sql connection used by handlers.
 	db, err := sql.Open("postgres", c.DatabaseURL)
@@ -40,7 +46,7 @@ func (c *Config) ConnectAndMigrate() *sql.DB {
 
 	// Run migrations using golang-migrate
 	m, err := migrate.New(
-		"file://pkg/db/migrations/postgresql",
+		"file://"+c.MigrationsDir,
 		c.DatabaseURL,
 	)
 	if err != nil {
@@ -16,8 +16,11 @@ import (
 
 // ConnectAndMigrate opens a SQLite connection and applies migrations
 func ConnectAndMigrate(dbPath string, migrationsDir string) *sql.DB {
-	// Open SQLite connection
-	db, err := sql.Open("sqlite", dbPath)
+	// Open SQLite connection. The pragmas are in the DSN so that every pooled
+	// connection gets them: each one waits for a lock held by another (e.g. a
+	// background job) instead of failing with SQLITE_BUSY, and enforces
+	// foreign keys, which SQLite turns on per connection.
+	db, err := sql.Open("sqlite", dbPath+"?_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)")
 	if err != nil {
 		log.Fatalf("Error opening database: %v", err)
 	}
@@ -27,11 +30,6 @@ func ConnectAndMigrate(dbPath string, migrationsDir string) *sql.DB {
 		log.Fatalf("Error pinging database: %v", err)
 	}
 
-	// ✅ Enable foreign keys
-	if _, err := db.Exec("PRAGMA foreign_keys = ON"); err != nil {
-		log.Fatalf("Error enabling foreign keys: %v", err)
-	}
-
 	// Test if foreign keys are really enabled
 	var enabled int
 	if err := db.QueryRow("PRAGMA foreign_keys;").Scan(&enabled); err != nil {
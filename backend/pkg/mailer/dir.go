@@ -0,0 +1,27 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DirMailer writes every message as an .eml file in Dir instead of sending it,
+// for development and tests
+type DirMailer struct {
+	Dir  string
+	From string
+}
+
+func (m *DirMailer) Send(msg Message) error {
+	raw, err := Build(m.From, msg)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), randomID()[:8])
+	return os.WriteFile(filepath.Join(m.Dir, name), raw, 0o644)
+}
@@ -0,0 +1,187 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// Supported values for MAIL_DRIVER
+const (
+	DriverSMTP = "smtp"
+	DriverDir  = "dir"
+)
+
+const (
+	defaultMailDir  = "mail"
+	defaultMailFrom = "Social Network <no-reply@localhost>"
+	defaultSMTPPort = "1025" // MailHog
+)
+
+// Message is one email with a plain text and an HTML body
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer delivers a message or returns why it couldn't
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// Config selects the mail backend at runtime.
+type Config struct {
+	Driver   string
+	From     string
+	Dir      string
+	Host     string
+	Port     string
+	Username string
+	Password string
+}
+
+// LoadConfig reads the mail settings from the environment (and .env if present).
+// Without MAIL_DRIVER, smtp is used when SMTP_HOST is set and the directory sink otherwise.
+func LoadConfig() *Config {
+	if err := godotenv.Load(); err != nil && !os.IsNotExist(err) {
+		log.Printf("Error loading .env file: %v", err)
+	}
+
+	c := &Config{
+		Driver:   os.Getenv("MAIL_DRIVER"),
+		From:     os.Getenv("MAIL_FROM"),
+		Dir:      os.Getenv("MAIL_DIR"),
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     os.Getenv("SMTP_PORT"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+	}
+
+	if c.Driver == "" {
+		if c.Host != "" {
+			c.Driver = DriverSMTP
+		} else {
+			c.Driver = DriverDir
+		}
+	}
+	if c.From == "" {
+		c.From = defaultMailFrom
+	}
+	if c.Dir == "" {
+		c.Dir = defaultMailDir
+	}
+	if c.Port == "" {
+		c.Port = defaultSMTPPort
+	}
+	return c
+}
+
+// New returns the configured Mailer
+func (c *Config) New() Mailer {
+	switch c.Driver {
+	case DriverSMTP:
+		return &SMTPMailer{Host: c.Host, Port: c.Port, Username: c.Username, Password: c.Password, From: c.From}
+	case DriverDir:
+		return &DirMailer{Dir: c.Dir, From: c.From}
+	}
+	log.Fatalf("Unknown MAIL_DRIVER %q (expected %q or %q)", c.Driver, DriverSMTP, DriverDir)
+	return nil
+}
+
+// Build encodes msg as a multipart/alternative MIME message from `from`
+func Build(from string, msg Message) ([]byte, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		if part.content == "" {
+			continue
+		}
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"8bit"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write([]byte(normalizeNewlines(part.content))); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	headers := [][2]string{
+		{"From", from},
+		{"To", msg.To},
+		{"Subject", encodeHeader(msg.Subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", "<" + randomID() + "@" + domainOf(from) + ">"},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + mw.Boundary()},
+	}
+	for _, h := range headers {
+		fmt.Fprintf(&out, "%s: %s\r\n", h[0], h[1])
+	}
+	out.WriteString("\r\n")
+	out.Write(body.Bytes())
+	return out.Bytes(), nil
+}
+
+// encodeHeader Q-encodes a header value that isn't plain ASCII
+func encodeHeader(s string) string {
+	for _, r := range s {
+		if r > 127 {
+			return "=?utf-8?q?" + strings.ReplaceAll(qEncode(s), " ", "_") + "?="
+		}
+	}
+	return s
+}
+
+func qEncode(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if c > 127 || c == '=' || c == '?' || c == '_' {
+			fmt.Fprintf(&b, "=%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func normalizeNewlines(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.ReplaceAll(s, "\n", "\r\n")
+}
+
+// domainOf returns the domain of an address like "Name <user@example.com>"
+func domainOf(addr string) string {
+	addr = strings.TrimSuffix(strings.TrimSpace(addr), ">")
+	if i := strings.LastIndex(addr, "@"); i >= 0 {
+		return addr[i+1:]
+	}
+	return "localhost"
+}
+
+func randomID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,38 @@
+package mailer
+
+import (
+	"net"
+	"net/mail"
+	"net/smtp"
+)
+
+// SMTPMailer sends through an SMTP server. Without a Username it doesn't
+// authenticate, which is what local stand-ins like MailHog expect.
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	raw, err := Build(m.From, msg)
+	if err != nil {
+		return err
+	}
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return err
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	return smtp.SendMail(net.JoinHostPort(m.Host, m.Port), auth, from.Address, []string{to.Address}, raw)
+}
@@ -0,0 +1,53 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Every email has templates/<name>.txt, which also defines its "subject",
+// and templates/<name>.html
+//
+//go:embed templates
+var templateFS embed.FS
+
+var (
+	textTemplates = texttemplate.Must(texttemplate.ParseFS(templateFS, "templates/*.txt"))
+	htmlTemplates = htmltemplate.Must(htmltemplate.ParseFS(templateFS, "templates/*.html", "templates/layout.gohtml"))
+)
+
+// Render fills the named email templates with data. The caller sets To.
+func Render(name string, data any) (Message, error) {
+	var subject, text, html bytes.Buffer
+
+	textTemplate := textTemplates.Lookup(name + ".txt")
+	if textTemplate == nil {
+		return Message{}, &UnknownTemplateError{name}
+	}
+	if err := textTemplate.ExecuteTemplate(&subject, name+".subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := textTemplate.Execute(&text, data); err != nil {
+		return Message{}, err
+	}
+	if err := htmlTemplates.ExecuteTemplate(&html, name+".html", data); err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+		HTML:    html.String(),
+	}, nil
+}
+
+type UnknownTemplateError struct {
+	Name string
+}
+
+func (e *UnknownTemplateError) Error() string {
+	return "mailer: unknown template " + e.Name
+}
@@ -3,6 +3,7 @@ package tools
 import (
 	"encoding/json"
 	"net/http"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -72,3 +73,34 @@ func ToUsername(s string) string {
 	s = s[:strings.Index(s, "@")]
 	return s
 }
+
+var (
+	hashtagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_&])#([\p{L}\p{N}_]{1,50})`)
+	mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_.@])@([A-Za-z0-9_.+\-]{1,50})`)
+)
+
+// ParseHashtags returns the distinct #hashtags of s, lowercase and without the #
+func ParseHashtags(s string) []string {
+	return uniqueMatches(hashtagPattern, s, strings.ToLower)
+}
+
+// ParseMentions returns the distinct @nickname / @url mentions of s without the @
+func ParseMentions(s string) []string {
+	return uniqueMatches(mentionPattern, s, func(m string) string {
+		return strings.TrimRight(m, ".-")
+	})
+}
+
+func uniqueMatches(re *regexp.Regexp, s string, clean func(string) string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, m := range re.FindAllStringSubmatch(s, -1) {
+		v := clean(m[1])
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		out = append(out, v)
+	}
+	return out
+}
@@ -0,0 +1,101 @@
+// Package totp implements the time-based one-time passwords of RFC 6238 as
+// used by authenticator apps: HMAC-SHA1, 6 digits, 30 second steps.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	Digits = 6
+	Period = 30 * time.Second
+	// codes from this many steps before or after now are accepted too, to
+	// allow for clock drift and typing time
+	Skew = 1
+
+	secretSize = 20
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a new random secret
+func GenerateSecret() ([]byte, error) {
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// EncodeSecret is the base32 form authenticator apps take
+func EncodeSecret(secret []byte) string {
+	return encoding.EncodeToString(secret)
+}
+
+// DecodeSecret reverses EncodeSecret, ignoring case and spaces
+func DecodeSecret(s string) ([]byte, error) {
+	s = strings.ToUpper(strings.ReplaceAll(s, " ", ""))
+	return encoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// Step is the counter of the time step t falls in
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period/time.Second)
+}
+
+// CodeAt is the code for the given time step (RFC 4226 HOTP)
+func CodeAt(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", Digits, value%uint32(math.Pow10(Digits)))
+}
+
+// Code is the code an authenticator shows at t
+func Code(secret []byte, t time.Time) string {
+	return CodeAt(secret, Step(t))
+}
+
+// Validate checks code against the steps around t and returns the step it
+// matched. Callers should reject steps at or before the last one used so a
+// code can't be replayed.
+func Validate(secret []byte, code string, t time.Time) (int64, bool) {
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) != Digits {
+		return 0, false
+	}
+	now := Step(t)
+	for step := now - Skew; step <= now+Skew; step++ {
+		if subtle.ConstantTimeCompare([]byte(CodeAt(secret, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// URI is the otpauth:// link authenticator apps read from a QR code
+func URI(issuer, account string, secret []byte) string {
+	v := url.Values{}
+	v.Set("secret", EncodeSecret(secret))
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(Digits))
+	v.Set("period", fmt.Sprint(int(Period/time.Second)))
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + v.Encode()
+}
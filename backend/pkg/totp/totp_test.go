@@ -0,0 +1,73 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// the SHA-1 seed of RFC 6238 appendix B
+var rfcSecret = []byte("12345678901234567890")
+
+func TestCodeRFC6238(t *testing.T) {
+	// the RFC lists 8 digit codes, the last 6 are the same value mod 10^6
+	for _, tt := range []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	} {
+		want := tt.want[len(tt.want)-Digits:]
+		if got := Code(rfcSecret, time.Unix(tt.unix, 0)); got != want {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, want)
+		}
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+	for _, tt := range []struct {
+		offset int64
+		ok     bool
+	}{
+		{-2, false},
+		{-1, true},
+		{0, true},
+		{1, true},
+		{2, false},
+	} {
+		code := CodeAt(rfcSecret, step+tt.offset)
+		got, ok := Validate(rfcSecret, code, now)
+		if ok != tt.ok || (ok && got != step+tt.offset) {
+			t.Errorf("code from step %+d: got step %d, %v, want %v", tt.offset, got-step, ok, tt.ok)
+		}
+	}
+
+	code := Code(rfcSecret, now)
+	if _, ok := Validate(rfcSecret, code[:3]+" "+code[3:], now); !ok {
+		t.Error("code with a space rejected")
+	}
+	for _, bad := range []string{"", code[:Digits-1], code + "0", strings.Repeat("x", Digits)} {
+		if _, ok := Validate(rfcSecret, bad, now); ok {
+			t.Errorf("Validate(%q) accepted", bad)
+		}
+	}
+}
+
+func TestSecretEncoding(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := EncodeSecret(secret)
+	decoded, err := DecodeSecret(strings.ToLower(encoded[:8]) + " " + encoded[8:])
+	if err != nil || string(decoded) != string(secret) {
+		t.Errorf("DecodeSecret(EncodeSecret) = %x, %v, want %x", decoded, err, secret)
+	}
+}
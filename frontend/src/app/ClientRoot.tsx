@@ -1,9 +1,10 @@
 "use client";
 
-import { useEffect } from "react";
-import { useRouter } from "next/navigation";
+import { useEffect, useState } from "react";
+import { usePathname, useRouter } from "next/navigation";
 import { authUtils } from "@/lib/navigation";
 import { initWebSocket } from "@/lib/websocket";
+import { VerifyEmailBanner } from "@/components/verify-email-banner";
 
 export default function ClientRoot({
   children,
@@ -11,6 +12,11 @@ export default function ClientRoot({
   children: React.ReactNode;
 }) {
   const router = useRouter();
+  const pathname = usePathname();
+  // links from emails (reset password, verify email) open under /auth and
+  // have to work without a session
+  const isAuthPage = pathname.startsWith("/auth");
+  const [unverified, setUnverified] = useState(false);
 
   useEffect(() => {
     const checkAuth = async () => {
@@ -18,13 +24,19 @@ export default function ClientRoot({
         const { loggedIn, user } = await authUtils.checkAuth();
         if (loggedIn) {
           initWebSocket(user.id);
-        } else router.push("/auth");
+          setUnverified(!user.emailVerified);
+        } else if (!isAuthPage) router.push("/auth");
       } catch {
-        router.push("/auth");
+        if (!isAuthPage) router.push("/auth");
       }
     };
     checkAuth();
-  }, [router]);
+  }, [router, isAuthPage]);
 
-  return <>{children}</>;
+  return (
+    <>
+      {unverified && !isAuthPage && <VerifyEmailBanner />}
+      {children}
+    </>
+  );
 }
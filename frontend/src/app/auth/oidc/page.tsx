@@ -0,0 +1,53 @@
+"use client";
+
+import { Suspense } from "react";
+import { useSearchParams } from "next/navigation";
+import { Button } from "@/components/ui/button";
+import {
+  Card,
+  CardContent,
+  CardDescription,
+  CardHeader,
+  CardTitle,
+} from "@/components/ui/card";
+
+// Where the backend sends the browser after a provider sign-in or link that
+// didn't end on the home page
+function SingleSignOnResult() {
+  const params = useSearchParams();
+  const linked = params.get("status") === "linked";
+  const error = params.get("error") || "Something went wrong";
+
+  return (
+    <Card className="w-full max-w-md mx-auto shadow-lg glass-card">
+      <CardHeader className="space-y-1 text-center">
+        <CardTitle className="text-2xl font-bold text-balance">
+          {linked ? "Account linked" : "Sign-in failed"}
+        </CardTitle>
+        <CardDescription className="text-muted-foreground text-pretty">
+          {linked
+            ? "You can now sign in with your provider account too."
+            : `${error}.`}
+        </CardDescription>
+      </CardHeader>
+      <CardContent>
+        <Button
+          className="w-full cursor-pointer glass-button text-white"
+          onClick={() => window.location.assign(linked ? "/" : "/auth")}
+        >
+          Continue
+        </Button>
+      </CardContent>
+    </Card>
+  );
+}
+
+export default function SingleSignOnPage() {
+  return (
+    <div className="auth-scope min-h-screen glass-page flex items-center justify-center p-6">
+      <Suspense fallback={<div>Loading...</div>}>
+        <SingleSignOnResult />
+      </Suspense>
+    </div>
+  );
+}
@@ -0,0 +1,142 @@
+"use client";
+
+import type React from "react";
+
+import { Suspense, useState } from "react";
+import { useRouter, useSearchParams } from "next/navigation";
+import { Button } from "@/components/ui/button";
+import { Input } from "@/components/ui/input";
+import { Label } from "@/components/ui/label";
+import {
+  Card,
+  CardContent,
+  CardDescription,
+  CardHeader,
+  CardTitle,
+} from "@/components/ui/card";
+import { ArrowLeft } from "lucide-react";
+import { siteConfig } from "@/config/site.config";
+
+function ResetPasswordForm() {
+  const router = useRouter();
+  const token = useSearchParams().get("token") || "";
+  const [password, setPassword] = useState("");
+  const [confirmPassword, setConfirmPassword] = useState("");
+  const [error, setError] = useState("");
+  const [done, setDone] = useState(false);
+  const [isLoading, setIsLoading] = useState(false);
+
+  const handleSubmit = async (event: React.FormEvent) => {
+    event.preventDefault();
+
+    if (password.length < 8) {
+      setError("Password must be at least 8 characters");
+      return;
+    }
+    if (password !== confirmPassword) {
+      setError("Passwords do not match");
+      return;
+    }
+
+    setIsLoading(true);
+    setError("");
+    try {
+      const res = await fetch(
+        `${siteConfig.domain}/api/password-reset/confirm`,
+        {
+          method: "POST",
+          headers: { "Content-Type": "application/json" },
+          body: JSON.stringify({ token, password }),
+        }
+      );
+      const data = await res.json();
+      if (!res.ok) {
+        setError(data.error || "Could not reset your password");
+        return;
+      }
+      setDone(true);
+    } catch {
+      setError("An error occurred. Please try again.");
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
+  return (
+    <Card className="w-full max-w-md mx-auto shadow-lg glass-card">
+      <CardHeader className="space-y-1 text-center">
+        <CardTitle className="text-2xl font-bold text-balance">
+          Choose a new password
+        </CardTitle>
+        <CardDescription className="text-muted-foreground text-pretty">
+          {done
+            ? "Your password has been updated. Sign in with your new password."
+            : "You will be signed out everywhere once it is changed"}
+        </CardDescription>
+      </CardHeader>
+      <CardContent>
+        {done || !token ? (
+          <div className="space-y-4 text-center">
+            {!token && (
+              <p className="text-sm text-destructive">
+                This reset link is invalid or has expired.
+              </p>
+            )}
+            <Button
+              className="w-full cursor-pointer glass-button text-white"
+              onClick={() => router.push("/auth")}
+            >
+              <ArrowLeft className="h-4 w-4 mr-2" />
+              Back to Sign In
+            </Button>
+          </div>
+        ) : (
+          <form onSubmit={handleSubmit} className="space-y-4">
+            <div className="space-y-2">
+              <Label htmlFor="new-password">New Password</Label>
+              <Input
+                id="new-password"
+                type="password"
+                value={password}
+                onChange={(e) => setPassword(e.target.value)}
+                className="glass-input"
+                required
+              />
+            </div>
+            <div className="space-y-2">
+              <Label htmlFor="confirm-new-password">Confirm Password</Label>
+              <Input
+                id="confirm-new-password"
+                type="password"
+                value={confirmPassword}
+                onChange={(e) => setConfirmPassword(e.target.value)}
+                className="glass-input"
+                required
+              />
+            </div>
+            {error && (
+              <p className="text-sm text-center text-destructive">{error}</p>
+            )}
+            <Button
+              type="submit"
+              className="w-full cursor-pointer glass-button text-white"
+              disabled={isLoading}
+            >
+              {isLoading ? "Saving..." : "Reset Password"}
+            </Button>
+          </form>
+        )}
+      </CardContent>
+    </Card>
+  );
+}
+
+export default function ResetPasswordPage() {
+  return (
+    <div className="auth-scope min-h-screen glass-page flex items-center justify-center p-6">
+      <Suspense fallback={<div>Loading...</div>}>
+        <ResetPasswordForm />
+      </Suspense>
+    </div>
+  );
+}
@@ -0,0 +1,91 @@
+"use client";
+
+import { Suspense, useEffect, useState } from "react";
+import { useSearchParams } from "next/navigation";
+import { Button } from "@/components/ui/button";
+import {
+  Card,
+  CardContent,
+  CardDescription,
+  CardHeader,
+  CardTitle,
+} from "@/components/ui/card";
+import { siteConfig } from "@/config/site.config";
+
+function VerifyEmail() {
+  const token = useSearchParams().get("token") || "";
+  const [status, setStatus] = useState<"pending" | "verified" | "failed">(
+    "pending"
+  );
+  const [error, setError] = useState("");
+
+  useEffect(() => {
+    if (!token) {
+      setStatus("failed");
+      setError("This verification link is invalid or has expired");
+      return;
+    }
+    const verify = async () => {
+      try {
+        const res = await fetch(`${siteConfig.domain}/api/verify-email`, {
+          method: "POST",
+          headers: { "Content-Type": "application/json" },
+          body: JSON.stringify({ token }),
+        });
+        const data = await res.json();
+        if (!res.ok) {
+          setStatus("failed");
+          setError(data.error || "Could not verify your email");
+          return;
+        }
+        setStatus("verified");
+      } catch {
+        setStatus("failed");
+        setError("An error occurred. Please try again.");
+      }
+    };
+    verify();
+  }, [token]);
+
+  return (
+    <Card className="w-full max-w-md mx-auto shadow-lg glass-card">
+      <CardHeader className="space-y-1 text-center">
+        <CardTitle className="text-2xl font-bold text-balance">
+          {status === "pending"
+            ? "Verifying your email..."
+            : status === "verified"
+            ? "Email verified"
+            : "Verification failed"}
+        </CardTitle>
+        <CardDescription className="text-muted-foreground text-pretty">
+          {status === "verified"
+            ? "Thanks! You can now post, message and create groups."
+            : status === "failed"
+            ? `${error}. You can ask for a new link from the banner once signed in.`
+            : ""}
+        </CardDescription>
+      </CardHeader>
+      {status !== "pending" && (
+        <CardContent>
+          <Button
+            className="w-full cursor-pointer glass-button text-white"
+            // a full load so the app picks up the new verification status
+            onClick={() => window.location.assign("/")}
+          >
+            Continue
+          </Button>
+        </CardContent>
+      )}
+    </Card>
+  );
+}
+
+export default function VerifyEmailPage() {
+  return (
+    <div className="auth-scope min-h-screen glass-page flex items-center justify-center p-6">
+      <Suspense fallback={<div>Loading...</div>}>
+        <VerifyEmail />
+      </Suspense>
+    </div>
+  );
+}
@@ -0,0 +1,171 @@
+"use client";
+
+import { useEffect, useState } from "react";
+import { KeyRound, X } from "lucide-react";
+import { Button } from "@/components/ui/button";
+import { Input } from "@/components/ui/input";
+import { Label } from "@/components/ui/label";
+import {
+  createAccessToken,
+  fetchAccessTokens,
+  revokeAccessToken,
+  type AccessToken,
+  type TokenScope,
+} from "@/lib/security";
+
+const scopeLabels: Record<TokenScope, string> = {
+  read: "Read",
+  posts: "Posts & comments",
+  messages: "Messages",
+  groups: "Groups",
+};
+
+const expiryOptions = [7, 30, 90, 365];
+
+const formatDate = (date: string) =>
+  new Date(date).toLocaleDateString(undefined, { dateStyle: "medium" });
+
+// Personal access tokens for scripts and bots, sent as "Authorization: Bearer"
+export function AccessTokensSettings() {
+  const [tokens, setTokens] = useState<AccessToken[]>([]);
+  const [name, setName] = useState("");
+  const [scopes, setScopes] = useState<TokenScope[]>(["read"]);
+  const [expiresInDays, setExpiresInDays] = useState(30);
+  const [newToken, setNewToken] = useState("");
+  const [error, setError] = useState("");
+  const [isLoading, setIsLoading] = useState(false);
+
+  useEffect(() => {
+    fetchAccessTokens().then(setTokens);
+  }, []);
+
+  const toggleScope = (scope: TokenScope) =>
+    setScopes((prev) =>
+      prev.includes(scope)
+        ? prev.filter((s) => s !== scope)
+        : [...prev, scope]
+    );
+
+  const handleCreate = async () => {
+    setIsLoading(true);
+    setError("");
+    try {
+      const data = await createAccessToken(name, scopes, expiresInDays);
+      setNewToken(data.token);
+      setTokens((prev) => [data.accessToken, ...prev]);
+      setName("");
+    } catch (err) {
+      setError(err instanceof Error ? err.message : "Something went wrong");
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
+  const handleRevoke = async (id: number) => {
+    setError("");
+    try {
+      await revokeAccessToken(id);
+      setTokens((prev) => prev.filter((t) => t.id !== id));
+    } catch (err) {
+      setError(err instanceof Error ? err.message : "Something went wrong");
+    }
+  };
+
+  return (
+    <div className="space-y-4 pt-6 border-t border-border/40">
+      <div className="flex items-center gap-3">
+        <div className="bg-primary/10 p-2 rounded-lg">
+          <KeyRound className="h-5 w-5 text-primary" />
+        </div>
+        <Label className="text-foreground font-bold text-base">
+          API tokens
+        </Label>
+      </div>
+
+      <div className="space-y-3 bg-muted/30 p-4 rounded-xl border border-border/30 text-sm">
+        {newToken && (
+          <div className="space-y-1">
+            <p className="text-foreground">
+              Copy this token now, it won&apos;t be shown again.
+            </p>
+            <p className="font-mono text-xs break-all">{newToken}</p>
+          </div>
+        )}
+
+        {tokens.map((token) => (
+          <div key={token.id} className="flex items-start gap-3">
+            <div className="flex-1 min-w-0">
+              <p className="text-foreground truncate">
+                {token.name}{" "}
+                <span className="font-mono text-xs text-muted-foreground">
+                  …{token.hint}
+                </span>
+              </p>
+              <p className="text-xs text-muted-foreground">
+                {token.scopes.map((s) => scopeLabels[s]).join(", ")} · Expires{" "}
+                {formatDate(token.expiresAt)} ·{" "}
+                {token.lastUsedAt
+                  ? `Last used ${formatDate(token.lastUsedAt)}`
+                  : "Never used"}
+              </p>
+            </div>
+            <Button
+              variant="ghost"
+              size="icon"
+              onClick={() => handleRevoke(token.id)}
+              className="h-7 w-7 text-muted-foreground hover:text-destructive"
+              title="Revoke"
+            >
+              <X className="h-4 w-4" />
+            </Button>
+          </div>
+        ))}
+
+        <Input
+          placeholder="Token name"
+          value={name}
+          maxLength={50}
+          onChange={(e) => setName(e.target.value)}
+          className="glass-input"
+        />
+        <div className="flex flex-wrap gap-x-4 gap-y-2">
+          {(Object.keys(scopeLabels) as TokenScope[]).map((scope) => (
+            <label
+              key={scope}
+              className="flex items-center gap-2 text-muted-foreground cursor-pointer"
+            >
+              <input
+                type="checkbox"
+                checked={scopes.includes(scope)}
+                onChange={() => toggleScope(scope)}
+                className="h-4 w-4 accent-primary cursor-pointer"
+              />
+              {scopeLabels[scope]}
+            </label>
+          ))}
+        </div>
+        <select
+          value={expiresInDays}
+          onChange={(e) => setExpiresInDays(Number(e.target.value))}
+          className="w-full rounded-md border border-input bg-transparent px-3 py-2 text-sm"
+        >
+          {expiryOptions.map((days) => (
+            <option key={days} value={days}>
+              Expires in {days} days
+            </option>
+          ))}
+        </select>
+        <Button
+          variant="outline"
+          onClick={handleCreate}
+          disabled={isLoading || !name.trim() || scopes.length === 0}
+          className="w-full rounded-xl"
+        >
+          Create token
+        </Button>
+
+        {error && <p className="text-destructive">{error}</p>}
+      </div>
+    </div>
+  );
+}
@@ -1,7 +1,7 @@
 "use client";
 import type React from "react";
 
-import { useState } from "react";
+import { Fragment, useEffect, useState } from "react";
 import {
   Dialog,
   DialogContent,
@@ -24,6 +24,7 @@ import {
   Mail,
   Lock,
   FileText,
+  Bell,
 } from "lucide-react";
 import { Calendar } from "@/components/ui/calendar";
 import { Popover, PopoverContent, PopoverTrigger } from "./ui/popover";
@@ -31,6 +32,15 @@ import { format } from "date-fns";
 import { cn } from "@/lib/utils";
 import { useRouter } from "next/navigation";
 import { siteConfig } from "@/config/site.config";
+import {
+  fetchNotificationSettings,
+  updateNotificationSetting,
+  type NotificationSetting,
+} from "@/lib/notifications";
+import { TwoFactorSettings } from "./two-factor-settings";
+import { SessionsSettings } from "./sessions-settings";
+import { AccessTokensSettings } from "./access-tokens-settings";
+import { LinkedAccountsSettings } from "./linked-accounts-settings";
 
 export interface UserData {
   id: string;
@@ -65,8 +75,32 @@ export function ProfileSettings({ userData, onSave }: ProfileSettingsProps) {
   const [isOpen, setIsOpen] = useState(false);
   const [formData, setFormData] = useState<UserData>(userData);
   const [isLoading, setIsLoading] = useState(false);
+  const [notificationSettings, setNotificationSettings] = useState<
+    NotificationSetting[]
+  >([]);
   const router = useRouter();
 
+  useEffect(() => {
+    if (!isOpen) return;
+    fetchNotificationSettings().then((data) =>
+      setNotificationSettings(data.settings || [])
+    );
+  }, [isOpen]);
+
+  /**
+   * Toggle one channel of a notification type, saved right away
+   */
+  const handleNotificationToggle = (
+    type: string,
+    channel: "inApp" | "live" | "emailDigest",
+    checked: boolean
+  ) => {
+    setNotificationSettings((prev) =>
+      prev.map((s) => (s.type === type ? { ...s, [channel]: checked } : s))
+    );
+    updateNotificationSetting({ type, [channel]: checked });
+  };
+
   /**
    * Handle form input changes
    */
@@ -152,7 +186,7 @@ export function ProfileSettings({ userData, onSave }: ProfileSettingsProps) {
 
     try {
       const res = await fetch(`${siteConfig.domain}/api/user/update`, {
-        method: "PUT",
+        method: "PATCH",
         headers: {
           "Content-Type": "application/json",
         },
@@ -437,6 +471,61 @@ export function ProfileSettings({ userData, onSave }: ProfileSettingsProps) {
               </div>
             </div>
 
+            {/* Notification Settings */}
+            <div className="space-y-4 pt-6 border-t border-border/40">
+              <div className="flex items-center gap-3">
+                <div className="bg-primary/10 p-2 rounded-lg">
+                  <Bell className="h-5 w-5 text-primary" />
+                </div>
+                <Label className="text-foreground font-bold text-base">
+                  Notifications
+                </Label>
+              </div>
+              <div className="grid grid-cols-[1fr_repeat(3,auto)] gap-x-6 gap-y-3 items-center bg-muted/30 p-4 rounded-xl border border-border/30 text-sm">
+                <span />
+                <span className="text-muted-foreground">In-app</span>
+                <span className="text-muted-foreground">Live</span>
+                <span className="text-muted-foreground">Email</span>
+                {notificationSettings.map((setting) => (
+                  <Fragment key={setting.type}>
+                    <span className="capitalize text-foreground">
+                      {setting.type.replace("_", " ")}
+                    </span>
+                    <Switch
+                      checked={setting.inApp}
+                      onCheckedChange={(checked) =>
+                        handleNotificationToggle(setting.type, "inApp", checked)
+                      }
+                    />
+                    <Switch
+                      checked={setting.live}
+                      onCheckedChange={(checked) =>
+                        handleNotificationToggle(setting.type, "live", checked)
+                      }
+                    />
+                    <Switch
+                      checked={setting.emailDigest}
+                      onCheckedChange={(checked) =>
+                        handleNotificationToggle(
+                          setting.type,
+                          "emailDigest",
+                          checked
+                        )
+                      }
+                    />
+                  </Fragment>
+                ))}
+              </div>
+            </div>
+
+            <TwoFactorSettings />
+
+            <SessionsSettings />
+
+            <LinkedAccountsSettings />
+
+            <AccessTokensSettings />
+
             {/* Action Buttons */}
             <div className="flex gap-3 pt-4 sticky bottom-0 bg-background/80 backdrop-blur-md pb-2 -mx-6 px-6 border-t border-border/40 mt-4">
               <Button
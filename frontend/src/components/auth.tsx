@@ -2,7 +2,7 @@
 
 import type React from "react";
 
-import { useState } from "react";
+import { useEffect, useState } from "react";
 import { useRouter } from "next/navigation";
 import { Button } from "@/components/ui/button";
 import { Input } from "@/components/ui/input";
@@ -34,6 +34,11 @@ import { CalendarIcon, Upload, Eye, EyeOff, ArrowLeft } from "lucide-react";
 import { format } from "date-fns";
 import { cn } from "@/lib/utils";
 import { siteConfig } from "@/config/site.config";
+import {
+  fetchSingleSignOn,
+  singleSignOnURL,
+  type SingleSignOnStatus,
+} from "@/lib/security";
 
 interface FormData {
   // Required fields for registration
@@ -70,8 +75,25 @@ export function AuthForm() {
   const [showConfirmPassword, setShowConfirmPassword] = useState(false);
   const [isLoading, setIsLoading] = useState(false);
   const [forgotPasswordEmail, setForgotPasswordEmail] = useState("");
+  // set when the password was right but the account also wants a 2FA code
+  const [pendingToken, setPendingToken] = useState("");
+  // a provider sign-in hands its pending login over in a cookie instead
+  const [pendingCookie, setPendingCookie] = useState(false);
+  const [twoFactorCode, setTwoFactorCode] = useState("");
+  const [rememberMe, setRememberMe] = useState(false);
+  const [singleSignOn, setSingleSignOn] = useState<SingleSignOnStatus | null>(
+    null
+  );
   const router = useRouter();
 
+  useEffect(() => {
+    fetchSingleSignOn().then(setSingleSignOn);
+    // a provider sign-in of an account with 2FA lands here for the code
+    if (new URLSearchParams(window.location.search).get("twoFactor") === "1") {
+      setPendingCookie(true);
+    }
+  }, []);
+
   // Form data state with proper typing
   const [formData, setFormData] = useState<FormData>({
     email: "",
@@ -230,6 +252,7 @@ export function AuthForm() {
           body: JSON.stringify({
             identifier: formData.email,
             password: formData.password,
+            rememberMe,
           }),
         })
           .then(async (res) => {
@@ -257,6 +280,8 @@ export function AuthForm() {
           .then((data) => {
             if (data.error) {
               setErrors({ general: data.error });
+            } else if (data.twoFactorRequired) {
+              setPendingToken(data.pendingToken);
             } else {
               router.push("/");
             }
@@ -391,6 +416,40 @@ export function AuthForm() {
     }
   };
 
+  /**
+   * Second login step for accounts with two-factor authentication
+   */
+  const handleTwoFactorSubmit = async (event: React.FormEvent) => {
+    event.preventDefault();
+    setIsLoading(true);
+    setErrors({});
+
+    try {
+      const res = await fetch(`${siteConfig.domain}/api/login/2fa`, {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        credentials: "include",
+        body: JSON.stringify({ pendingToken, code: twoFactorCode }),
+      });
+      const data = await res.json();
+      if (!res.ok) {
+        // an expired or exhausted pending login starts over at the password
+        if (res.status === 401 && data.error !== "Invalid code") {
+          setPendingToken("");
+          setPendingCookie(false);
+        }
+        setTwoFactorCode("");
+        setErrors({ general: data.error || "Login failed" });
+        return;
+      }
+      router.push("/");
+    } catch {
+      setErrors({ general: "An error occurred. Please try again." });
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
   /**
    * Handles forgot password form submission
    */
@@ -412,16 +471,22 @@ export function AuthForm() {
     setErrors({});
 
     try {
-      // Handle password reset logic here
-      console.log("Password reset request for:", forgotPasswordEmail);
-      // TODO: Implement actual password reset API call (backend dyalek)
-
-      // Simulate API call delay
-      await new Promise((resolve) => setTimeout(resolve, 1000));
+      const res = await fetch(
+        `${siteConfig.domain}/api/password-reset/request`,
+        {
+          method: "POST",
+          headers: { "Content-Type": "application/json" },
+          body: JSON.stringify({ email: forgotPasswordEmail }),
+        }
+      );
+      if (!res.ok) {
+        throw new Error("Password reset request failed");
+      }
 
-      // Show success message (you can customize this)
+      // the backend answers the same for unknown emails
       setErrors({
-        general: "Password reset instructions have been sent to your email.",
+        general:
+          "If an account exists for this email, reset instructions have been sent.",
       });
     } catch {
       setErrors({ general: "An error occurred. Please try again." });
@@ -439,6 +504,9 @@ export function AuthForm() {
     setErrors({});
     setIsForgotPassword(false);
     setForgotPasswordEmail("");
+    setPendingToken("");
+    setPendingCookie(false);
+    setTwoFactorCode("");
 
     // Reset form data when switching modes
     setFormData({
@@ -562,96 +630,178 @@ export function AuthForm() {
 
               {/* Login Form */}
               <TabsContent value="login" className="space-y-4">
-                <form onSubmit={handleSubmit} className="space-y-4">
-                  {/* Email Field */}
-                  <div className="space-y-2">
-                    <Label htmlFor="login-email">Email</Label>
-                    <Input
-                      id="login-email"
-                      type="email"
-                      placeholder="Enter your email"
-                      value={formData.email}
-                      onChange={(e) =>
-                        handleInputChange("email", e.target.value)
-                      }
-                      className={cn(
-                        "glass-input",
-                        errors.email && "border-destructive"
-                      )}
-                      required
-                    />
-                    {errors.email && (
-                      <p className="text-sm text-destructive">{errors.email}</p>
+                {pendingToken || pendingCookie ? (
+                  <form onSubmit={handleTwoFactorSubmit} className="space-y-4">
+                    <div className="space-y-2">
+                      <Label htmlFor="login-2fa-code">Authentication code</Label>
+                      <Input
+                        id="login-2fa-code"
+                        inputMode="numeric"
+                        autoComplete="one-time-code"
+                        placeholder="6-digit code or a recovery code"
+                        value={twoFactorCode}
+                        onChange={(e) => setTwoFactorCode(e.target.value)}
+                        className="glass-input"
+                        autoFocus
+                        required
+                      />
+                    </div>
+
+                    {errors.general && (
+                      <p className="text-sm text-destructive text-center">
+                        {errors.general}
+                      </p>
                     )}
-                  </div>
 
-                  {/* Password Field with visibility toggle */}
-                  <div className="space-y-2">
-                    <Label htmlFor="login-password">Password</Label>
-                    <div className="relative">
+                    <Button
+                      type="submit"
+                      className="w-full cursor-pointer glass-button text-white"
+                      disabled={isLoading}
+                    >
+                      {isLoading ? "Verifying..." : "Verify"}
+                    </Button>
+
+                    <div className="text-center">
+                      <Button
+                        type="button"
+                        variant="ghost"
+                        className="text-sm text-muted-foreground cursor-pointer"
+                        onClick={() => {
+                          setPendingToken("");
+                          setPendingCookie(false);
+                          setTwoFactorCode("");
+                          setErrors({});
+                        }}
+                      >
+                        <ArrowLeft className="h-4 w-4 mr-2" />
+                        Back to Sign In
+                      </Button>
+                    </div>
+                  </form>
+                ) : (
+                  <form onSubmit={handleSubmit} className="space-y-4">
+                    {/* Email Field */}
+                    <div className="space-y-2">
+                      <Label htmlFor="login-email">Email</Label>
                       <Input
-                        id="login-password"
-                        type={showPassword ? "text" : "password"}
-                        placeholder="Enter your password"
-                        value={formData.password}
+                        id="login-email"
+                        type="email"
+                        placeholder="Enter your email"
+                        value={formData.email}
                         onChange={(e) =>
-                          handleInputChange("password", e.target.value)
+                          handleInputChange("email", e.target.value)
                         }
                         className={cn(
                           "glass-input",
-                          errors.password && "border-destructive",
-                          "pr-10"
+                          errors.email && "border-destructive"
                         )}
                         required
                       />
-                      <Button
-                        type="button"
-                        variant="ghost"
-                        size="sm"
-                        className="absolute right-0 top-0 h-full px-3 py-2 hover:bg-transparent"
-                        onClick={() => setShowPassword(!showPassword)}
+                      {errors.email && (
+                        <p className="text-sm text-destructive">{errors.email}</p>
+                      )}
+                    </div>
+
+                    {/* Password Field with visibility toggle */}
+                    <div className="space-y-2">
+                      <Label htmlFor="login-password">Password</Label>
+                      <div className="relative">
+                        <Input
+                          id="login-password"
+                          type={showPassword ? "text" : "password"}
+                          placeholder="Enter your password"
+                          value={formData.password}
+                          onChange={(e) =>
+                            handleInputChange("password", e.target.value)
+                          }
+                          className={cn(
+                            "glass-input",
+                            errors.password && "border-destructive",
+                            "pr-10"
+                          )}
+                          required
+                        />
+                        <Button
+                          type="button"
+                          variant="ghost"
+                          size="sm"
+                          className="absolute right-0 top-0 h-full px-3 py-2 hover:bg-transparent"
+                          onClick={() => setShowPassword(!showPassword)}
+                        >
+                          {showPassword ? (
+                            <EyeOff className="h-4 w-4 text-muted-foreground" />
+                          ) : (
+                            <Eye className="h-4 w-4 text-muted-foreground" />
+                          )}
+                        </Button>
+                      </div>
+                      {errors.password && (
+                        <p className="text-sm text-destructive">
+                          {errors.password}
+                        </p>
+                      )}
+                    </div>
+
+                    {/* Remember me */}
+                    <div className="flex items-center gap-2">
+                      <input
+                        id="login-remember"
+                        type="checkbox"
+                        checked={rememberMe}
+                        onChange={(e) => setRememberMe(e.target.checked)}
+                        className="h-4 w-4 accent-primary cursor-pointer"
+                      />
+                      <Label
+                        htmlFor="login-remember"
+                        className="text-sm text-muted-foreground cursor-pointer"
                       >
-                        {showPassword ? (
-                          <EyeOff className="h-4 w-4 text-muted-foreground" />
-                        ) : (
-                          <Eye className="h-4 w-4 text-muted-foreground" />
-                        )}
-                      </Button>
+                        Keep me signed in
+                      </Label>
                     </div>
-                    {errors.password && (
-                      <p className="text-sm text-destructive">
-                        {errors.password}
+
+                    {/* General error message */}
+                    {errors.general && (
+                      <p className="text-sm text-destructive text-center">
+                        {errors.general}
                       </p>
                     )}
-                  </div>
-
-                  {/* General error message */}
-                  {errors.general && (
-                    <p className="text-sm text-destructive text-center">
-                      {errors.general}
-                    </p>
-                  )}
-
-                  {/* Submit Button */}
-                  <Button
-                    type="submit"
-                    className="w-full cursor-pointer glass-button text-white"
-                    disabled={isLoading}
-                  >
-                    {isLoading ? "Signing in..." : "Sign In"}
-                  </Button>
 
-                  <div className="text-center">
+                    {/* Submit Button */}
                     <Button
-                      type="button"
-                      variant="link"
-                      className="text-sm text-muted-foreground cursor-pointer"
-                      onClick={() => setIsForgotPassword(true)}
+                      type="submit"
+                      className="w-full cursor-pointer glass-button text-white"
+                      disabled={isLoading}
                     >
-                      Forgot your password?
+                      {isLoading ? "Signing in..." : "Sign In"}
                     </Button>
-                  </div>
-                </form>
+
+                    {singleSignOn?.enabled && (
+                      <Button
+                        type="button"
+                        variant="outline"
+                        className="w-full cursor-pointer"
+                        onClick={() =>
+                          window.location.assign(
+                            singleSignOnURL({ remember: rememberMe })
+                          )
+                        }
+                      >
+                        Continue with {singleSignOn.name}
+                      </Button>
+                    )}
+
+                    <div className="text-center">
+                      <Button
+                        type="button"
+                        variant="link"
+                        className="text-sm text-muted-foreground cursor-pointer"
+                        onClick={() => setIsForgotPassword(true)}
+                      >
+                        Forgot your password?
+                      </Button>
+                    </div>
+                  </form>
+                )}
               </TabsContent>
 
               {/* Registration Form */}
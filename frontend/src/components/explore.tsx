@@ -6,6 +6,7 @@ import { Button } from "@/components/ui/button";
 import { Input } from "@/components/ui/input";
 import { Avatar, AvatarFallback, AvatarImage } from "@/components/ui/avatar";
 import { Search, UserPlus, UserCheck, Compass } from "lucide-react";
+import { siteConfig } from "@/config/site.config";
 import { useNotificationCount } from "@/lib/notifications";
 
 interface User {
@@ -76,28 +77,35 @@ export function ExplorePage({ onNavigate, onNewPost }: ExplorePageProps) {
   // Get notification count for sidebar
   const notificationCount = useNotificationCount();
 
-  const filteredUsers = users.filter(
-    (user) =>
-      user.name.toLowerCase().includes(searchQuery.toLowerCase()) ||
-      user.username.toLowerCase().includes(searchQuery.toLowerCase()) ||
-      user.bio.toLowerCase().includes(searchQuery.toLowerCase())
-  );
+  // search results come already matched and ranked from /api/search
+  const filteredUsers = users;
 
   const handleSearch = async (query: string) => {
     setSearchQuery(query);
     if (query.trim()) {
       setIsSearching(true);
       try {
-        console.log("Searching for users:", query);
-        // TODO: Replace with actual API call
-        // const response = await fetch(`${siteConfig.domain}/api/users/search?q=${encodeURIComponent(query)}`);
-        // const searchResults = await response.json();
-        // setUsers(searchResults);
-
-        // For now, using filtered sample data
-        setTimeout(() => {
-          setIsSearching(false);
-        }, 500);
+        const response = await fetch(
+          `${siteConfig.domain}/api/search?type=users&q=${encodeURIComponent(
+            query
+          )}`,
+          { credentials: "include" }
+        );
+        const searchResults = await response.json();
+        setUsers(
+          // eslint-disable-next-line @typescript-eslint/no-explicit-any
+          (searchResults.users || []).map((u: any) => ({
+            id: String(u.id),
+            name: `${u.firstName} ${u.lastName}`,
+            username: `@${u.url}`,
+            avatar: u.avatar,
+            bio: "",
+            followers: 0,
+            following: 0,
+            isFollowing: false,
+          }))
+        );
+        setIsSearching(false);
       } catch (error) {
         console.error("Error searching users:", error);
         setIsSearching(false);
@@ -6,6 +6,12 @@ import { Avatar, AvatarFallback, AvatarImage } from "@/components/ui/avatar";
 import { Button } from "@/components/ui/button";
 import { Card, CardContent } from "@/components/ui/card";
 import { Input } from "@/components/ui/input";
+import {
+  DropdownMenu,
+  DropdownMenuContent,
+  DropdownMenuItem,
+  DropdownMenuTrigger,
+} from "@/components/ui/dropdown-menu";
 import {
   Heart,
   MessageCircle,
@@ -15,6 +21,8 @@ import {
   ImagePlay,
   Smile,
   Search,
+  Pencil,
+  Trash2,
 } from "lucide-react";
 import { useNotificationCount } from "@/lib/notifications";
 import EmojiPicker, { Theme } from "emoji-picker-react";
@@ -25,6 +33,7 @@ import { siteConfig } from "@/config/site.config";
 interface Comment {
   id: string;
   author: {
+    id?: number;
     name: string;
     username: string;
     avatar: string;
@@ -33,13 +42,19 @@ interface Comment {
   createdAt: string;
   likes: number;
   isLiked: boolean;
+  isEdited?: boolean;
+  isHidden?: boolean;
+  repliesCount?: number;
   parentId?: string;
+  parentCommentId?: number;
   replies?: Comment[];
+  nextRepliesCursor?: string;
 }
 
 interface Post {
   id: string;
   author: {
+    id: number;
     name: string;
     username: string;
     avatar: string;
@@ -51,8 +66,11 @@ interface Post {
   comments: number;
   shares: number;
   isLiked: boolean;
+  isEdited?: boolean;
+  sharedPost?: Post;
   privacy: "public" | "almost-private" | "private";
   commentsList?: Comment[];
+  commentsCursor?: string;
 }
 
 interface HomeFeedProps {
@@ -64,6 +82,10 @@ function HomeFeed({ onNewPost }: HomeFeedProps) {
   // Get notification count for sidebar
   const notificationCount = useNotificationCount();
   const [postsState, setPostsState] = useState<Post[]>([]);
+  const [nextCursor, setNextCursor] = useState<string>("");
+  const [currentUserId, setCurrentUserId] = useState<number | null>(null);
+  const [loadingPosts, setLoadingPosts] = useState(false);
+  const loadMoreRef = useRef<HTMLDivElement | null>(null);
   const [isMobileMenuOpen, setIsMobileMenuOpen] = useState(false);
   const [showComments, setShowComments] = useState<{ [key: string]: boolean }>(
     {}
@@ -109,27 +131,172 @@ function HomeFeed({ onNewPost }: HomeFeedProps) {
       case "new-post":
         setPostsState((prevPosts) => [data.payload.post, ...prevPosts]);
         break;
+      case "comment-created":
+        setPostsState((prevPosts) =>
+          prevPosts.map((post) =>
+            String(post.id) === String(data.payload.postId)
+              ? addComment(post, data.payload.comment)
+              : post
+          )
+        );
+        break;
+      case "comment-updated":
+        setPostsState((prevPosts) =>
+          prevPosts.map((post) =>
+            String(post.id) === String(data.payload.postId) && post.commentsList
+              ? {
+                  ...post,
+                  commentsList: replaceComment(
+                    post.commentsList,
+                    data.payload.comment
+                  ),
+                }
+              : post
+          )
+        );
+        break;
+      case "comment-deleted":
+        setPostsState((prevPosts) =>
+          prevPosts.map((post) =>
+            String(post.id) === String(data.payload.postId) && post.commentsList
+              ? {
+                  ...post,
+                  commentsList: removeComments(
+                    post.commentsList,
+                    (data.payload.deletedIds || []).map(String)
+                  ),
+                }
+              : post
+          )
+        );
+        break;
+      case "post-deleted":
+        setPostsState((prevPosts) =>
+          prevPosts.filter(
+            (post) => String(post.id) !== String(data.payload.postId)
+          )
+        );
+        break;
       default:
         break;
     }
   };
 
-  useEffect(() => {
-    const fetchPosts = async () => {
-      try {
-        const res = await fetch(`${siteConfig.domain}/api/get-posts`, {
-          credentials: "include",
-        });
-        const data = await res.json();
-        setPostsState(data.posts || []);
-      } catch (err) {
-        console.error("Failed to fetch posts", err);
-      }
-    };
+  const fetchPosts = async (cursor = "") => {
+    setLoadingPosts(true);
+    try {
+      const params = cursor ? `?cursor=${encodeURIComponent(cursor)}` : "";
+      const res = await fetch(`${siteConfig.domain}/api/get-posts${params}`, {
+        credentials: "include",
+      });
+      const data = await res.json();
+      const page: Post[] = data.posts || [];
+      setPostsState((prevPosts) => {
+        if (!cursor) return page;
+        // a post pushed over ws while scrolling may already be in the list
+        const seen = new Set(prevPosts.map((p) => p.id));
+        return [...prevPosts, ...page.filter((p) => !seen.has(p.id))];
+      });
+      setNextCursor(data.nextCursor || "");
+      setCurrentUserId(data.user?.userID ?? null);
+    } catch (err) {
+      console.error("Failed to fetch posts", err);
+    } finally {
+      setLoadingPosts(false);
+    }
+  };
 
+  useEffect(() => {
     fetchPosts();
   }, []);
 
+  // load the next page when the end of the feed scrolls into view
+  useEffect(() => {
+    const el = loadMoreRef.current;
+    if (!el || !nextCursor || loadingPosts) return;
+
+    const observer = new IntersectionObserver((entries) => {
+      if (entries[0].isIntersecting) {
+        observer.disconnect();
+        fetchPosts(nextCursor);
+      }
+    });
+    observer.observe(el);
+
+    return () => observer.disconnect();
+  }, [nextCursor, loadingPosts]);
+
+  const handleEditPost = async (post: Post) => {
+    const content = window.prompt("Edit post", post.content);
+    if (content === null || content === post.content) return;
+
+    try {
+      const res = await fetch(`${siteConfig.domain}/api/edit-post/${post.id}`, {
+        method: "PATCH",
+        headers: { "Content-Type": "application/json" },
+        credentials: "include",
+        body: JSON.stringify({ content }),
+      });
+      if (!res.ok) throw new Error("Failed to edit post");
+      const updated: Post = await res.json();
+      setPostsState((prevPosts) =>
+        prevPosts.map((p) =>
+          p.id === post.id ? { ...updated, commentsList: p.commentsList } : p
+        )
+      );
+    } catch (err) {
+      console.error(err);
+    }
+  };
+
+  const handleDeletePost = async (postId: string) => {
+    if (!window.confirm("Delete this post?")) return;
+
+    try {
+      const res = await fetch(`${siteConfig.domain}/api/delete-post/${postId}`, {
+        method: "DELETE",
+        credentials: "include",
+      });
+      if (!res.ok) throw new Error("Failed to delete post");
+      setPostsState((prevPosts) => prevPosts.filter((p) => p.id !== postId));
+    } catch (err) {
+      console.error(err);
+    }
+  };
+
+  // repost, or quote-post when the user writes something about it
+  const handleShare = async (post: Post, quote: boolean) => {
+    let content = "";
+    if (quote) {
+      const text = window.prompt("Say something about this post");
+      if (text === null) return;
+      content = text;
+    }
+
+    try {
+      const res = await fetch(`${siteConfig.domain}/api/share-post/${post.id}`, {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        credentials: "include",
+        body: JSON.stringify({ content }),
+      });
+      const data = await res.json();
+      if (!res.ok) {
+        alert(data.error || "Failed to share post");
+        return;
+      }
+      // the new share itself arrives through the "new-post" ws event
+      const originalId = String(data.sharedPost?.id);
+      setPostsState((prevPosts) =>
+        prevPosts.map((p) =>
+          String(p.id) === originalId ? { ...p, shares: p.shares + 1 } : p
+        )
+      );
+    } catch (err) {
+      console.error("Failed to share post", err);
+    }
+  };
+
   const handleLike = async (postId: string) => {
     try {
       const res = await fetch(`${siteConfig.domain}/api/like/${postId}`, {
@@ -193,7 +360,8 @@ function HomeFeed({ onNewPost }: HomeFeedProps) {
           post.id === postId
             ? {
                 ...post,
-                commentsList: data || [],
+                commentsList: data.comments || [],
+                commentsCursor: data.nextCursor || "",
               }
             : post
         )
@@ -233,25 +401,7 @@ function HomeFeed({ onNewPost }: HomeFeedProps) {
       // Update the post with new comment
       setPostsState((prevPosts) =>
         prevPosts.map((post) =>
-          post.id === postId
-            ? {
-                ...post,
-                comments: post.comments + 1,
-                commentsList: post.commentsList
-                  ? parentCommentId
-                    ? post.commentsList.map((comment) => {
-                        if (comment.id === parentCommentId) {
-                          return {
-                            ...comment,
-                            replies: [...(comment.replies || []), data],
-                          };
-                        }
-                        return comment;
-                      })
-                    : [...post.commentsList, data]
-                  : [data],
-              }
-            : post
+          post.id === postId ? addComment(post, data) : post
         )
       );
 
@@ -330,6 +480,184 @@ function HomeFeed({ onNewPost }: HomeFeedProps) {
     });
   };
 
+  const replaceComment = (comments: Comment[], updated: Comment): Comment[] =>
+    comments.map((comment) =>
+      comment.id === updated.id
+        ? { ...updated, replies: comment.replies }
+        : { ...comment, replies: replaceComment(comment.replies || [], updated) }
+    );
+
+  const appendReplies = (
+    comments: Comment[],
+    parentId: string,
+    replies: Comment[],
+    nextRepliesCursor?: string
+  ): Comment[] =>
+    comments.map((comment) =>
+      comment.id === parentId
+        ? {
+            ...comment,
+            replies: [...(comment.replies || []), ...replies],
+            nextRepliesCursor:
+              nextRepliesCursor === undefined
+                ? comment.nextRepliesCursor
+                : nextRepliesCursor,
+          }
+        : {
+            ...comment,
+            replies: appendReplies(
+              comment.replies || [],
+              parentId,
+              replies,
+              nextRepliesCursor
+            ),
+          }
+    );
+
+  const hasComment = (comments: Comment[], id: string): boolean =>
+    comments.some(
+      (comment) => comment.id === id || hasComment(comment.replies || [], id)
+    );
+
+  // addComment inserts a new comment once, whether it arrives from the
+  // create request or the comment-created event
+  const addComment = (post: Post, comment: Comment): Post => {
+    if (post.commentsList && hasComment(post.commentsList, comment.id)) {
+      return post;
+    }
+    const parentId = comment.parentCommentId
+      ? String(comment.parentCommentId)
+      : "";
+    return {
+      ...post,
+      comments: parentId ? post.comments : post.comments + 1,
+      commentsList: post.commentsList
+        ? parentId
+          ? appendReplies(post.commentsList, parentId, [comment])
+          : [...post.commentsList, comment]
+        : post.commentsList,
+    };
+  };
+
+  const removeComments = (comments: Comment[], ids: string[]): Comment[] =>
+    comments
+      .filter((comment) => !ids.includes(comment.id))
+      .map((comment) => ({
+        ...comment,
+        replies: removeComments(comment.replies || [], ids),
+      }));
+
+  const updatePostComments = (
+    postId: string,
+    update: (comments: Comment[]) => Comment[]
+  ) => {
+    setPostsState((prevPosts) =>
+      prevPosts.map((post) =>
+        post.id === postId && post.commentsList
+          ? { ...post, commentsList: update(post.commentsList) }
+          : post
+      )
+    );
+  };
+
+  const loadMoreComments = async (post: Post) => {
+    try {
+      const res = await fetch(
+        `${siteConfig.domain}/api/get-comments/${post.id}?cursor=${post.commentsCursor}`,
+        { credentials: "include" }
+      );
+      if (!res.ok) throw new Error("Failed to fetch comments");
+      const data = await res.json();
+      setPostsState((prevPosts) =>
+        prevPosts.map((p) =>
+          p.id === post.id
+            ? {
+                ...p,
+                commentsList: [...(p.commentsList || []), ...data.comments],
+                commentsCursor: data.nextCursor || "",
+              }
+            : p
+        )
+      );
+    } catch (err) {
+      console.error("Failed to fetch comments", err);
+    }
+  };
+
+  const loadMoreReplies = async (comment: Comment, postId: string) => {
+    try {
+      const res = await fetch(
+        `${siteConfig.domain}/api/get-comments/${postId}?parent=${comment.id}&cursor=${comment.nextRepliesCursor || ""}`,
+        { credentials: "include" }
+      );
+      if (!res.ok) throw new Error("Failed to fetch replies");
+      const data = await res.json();
+      updatePostComments(postId, (comments) =>
+        appendReplies(comments, comment.id, data.comments, data.nextCursor || "")
+      );
+    } catch (err) {
+      console.error("Failed to fetch replies", err);
+    }
+  };
+
+  const handleEditComment = async (comment: Comment, postId: string) => {
+    const content = window.prompt("Edit comment", comment.content);
+    if (content === null || content === comment.content) return;
+
+    try {
+      const res = await fetch(
+        `${siteConfig.domain}/api/edit-comment/${comment.id}`,
+        {
+          method: "PATCH",
+          headers: { "Content-Type": "application/json" },
+          credentials: "include",
+          body: JSON.stringify({ content }),
+        }
+      );
+      if (!res.ok) throw new Error("Failed to edit comment");
+      const updated: Comment = await res.json();
+      updatePostComments(postId, (comments) =>
+        replaceComment(comments, updated)
+      );
+    } catch (err) {
+      console.error(err);
+    }
+  };
+
+  const handleDeleteComment = async (commentId: string, postId: string) => {
+    if (!window.confirm("Delete this comment and its replies?")) return;
+
+    try {
+      const res = await fetch(
+        `${siteConfig.domain}/api/delete-comment/${commentId}`,
+        { method: "DELETE", credentials: "include" }
+      );
+      if (!res.ok) throw new Error("Failed to delete comment");
+      const data = await res.json();
+      updatePostComments(postId, (comments) =>
+        removeComments(comments, (data.deletedIds || []).map(String))
+      );
+    } catch (err) {
+      console.error(err);
+    }
+  };
+
+  const handleHideComment = async (comment: Comment, postId: string) => {
+    try {
+      const res = await fetch(
+        `${siteConfig.domain}/api/hide-comment/${comment.id}`,
+        { method: "POST", credentials: "include" }
+      );
+      if (!res.ok) throw new Error("Failed to hide comment");
+      const data = await res.json();
+      updatePostComments(postId, (comments) =>
+        replaceComment(comments, { ...comment, isHidden: data.hidden })
+      );
+    } catch (err) {
+      console.error(err);
+    }
+  };
+
   const handleReply = (postId: string, commentId: string) => {
     setReplyingTo((prev) => ({
       ...prev,
@@ -347,6 +675,10 @@ function HomeFeed({ onNewPost }: HomeFeedProps) {
   };
 
   const renderComment = (comment: Comment, postId: string, isReply = false) => {
+    const postAuthorId = postsState.find((p) => p.id === postId)?.author.id;
+    const isCommentAuthor = comment.author.id === currentUserId;
+    const isPostAuthor = postAuthorId === currentUserId;
+
     return (
       <div
         key={comment.id}
@@ -375,6 +707,8 @@ function HomeFeed({ onNewPost }: HomeFeedProps) {
                 </span>
                 <span className="text-xs text-muted-foreground">
                   {new Date(comment.createdAt).toLocaleString()}
+                  {comment.isEdited && " • edited"}
+                  {comment.isHidden && " • hidden"}
                 </span>
               </div>
               <p className="text-sm text-foreground">{comment.content}</p>
@@ -393,15 +727,43 @@ function HomeFeed({ onNewPost }: HomeFeedProps) {
                 />
                 <span className="text-xs">{comment.likes}</span>
               </Button>
-              {!isReply && (
+              <Button
+                variant="ghost"
+                size="sm"
+                onClick={() => handleReply(postId, comment.id)}
+                className="flex items-center gap-1 h-6 px-2 text-muted-foreground"
+              >
+                <MessageCircle className="h-3 w-3" />
+                <span className="text-xs">Reply</span>
+              </Button>
+              {isCommentAuthor && (
+                <Button
+                  variant="ghost"
+                  size="sm"
+                  onClick={() => handleEditComment(comment, postId)}
+                  className="h-6 px-2 text-xs text-muted-foreground"
+                >
+                  Edit
+                </Button>
+              )}
+              {isPostAuthor && (
+                <Button
+                  variant="ghost"
+                  size="sm"
+                  onClick={() => handleHideComment(comment, postId)}
+                  className="h-6 px-2 text-xs text-muted-foreground"
+                >
+                  {comment.isHidden ? "Unhide" : "Hide"}
+                </Button>
+              )}
+              {(isCommentAuthor || isPostAuthor) && (
                 <Button
                   variant="ghost"
                   size="sm"
-                  onClick={() => handleReply(postId, comment.id)}
-                  className="flex items-center gap-1 h-6 px-2 text-muted-foreground"
+                  onClick={() => handleDeleteComment(comment.id, postId)}
+                  className="h-6 px-2 text-xs text-destructive"
                 >
-                  <MessageCircle className="h-3 w-3" />
-                  <span className="text-xs">Reply</span>
+                  Delete
                 </Button>
               )}
             </div>
@@ -410,6 +772,17 @@ function HomeFeed({ onNewPost }: HomeFeedProps) {
               comment.replies.map((reply) =>
                 renderComment(reply, postId, true)
               )}
+            {(comment.nextRepliesCursor ||
+              (!comment.replies && (comment.repliesCount || 0) > 0)) && (
+              <Button
+                variant="ghost"
+                size="sm"
+                onClick={() => loadMoreReplies(comment, postId)}
+                className="ml-8 mt-2 h-6 px-2 text-xs text-muted-foreground"
+              >
+                Load more replies
+              </Button>
+            )}
           </div>
         </div>
       </div>
@@ -479,16 +852,42 @@ function HomeFeed({ onNewPost }: HomeFeedProps) {
                             dateStyle: "medium",
                             timeStyle: "short",
                           })}
+                          {post.isEdited && " • edited"}
                         </p>
                       </div>
                     </div>
-                    <Button
-                      variant="ghost"
-                      size="icon"
-                      className="text-muted-foreground hover:text-foreground rounded-full"
-                    >
-                      <MoreHorizontal className="h-5 w-5" />
-                    </Button>
+                    {post.author.id === currentUserId && (
+                      <DropdownMenu>
+                        <DropdownMenuTrigger asChild>
+                          <Button
+                            variant="ghost"
+                            size="icon"
+                            className="text-muted-foreground hover:text-foreground rounded-full"
+                          >
+                            <MoreHorizontal className="h-5 w-5" />
+                          </Button>
+                        </DropdownMenuTrigger>
+                        <DropdownMenuContent
+                          align="end"
+                          className="glass-panel border-border/50"
+                        >
+                          <DropdownMenuItem
+                            onClick={() => handleEditPost(post)}
+                            className="cursor-pointer"
+                          >
+                            <Pencil className="h-4 w-4 mr-2" />
+                            Edit
+                          </DropdownMenuItem>
+                          <DropdownMenuItem
+                            onClick={() => handleDeletePost(post.id)}
+                            className="text-destructive focus:text-destructive focus:bg-destructive/10 cursor-pointer"
+                          >
+                            <Trash2 className="h-4 w-4 mr-2" />
+                            Delete
+                          </DropdownMenuItem>
+                        </DropdownMenuContent>
+                      </DropdownMenu>
+                    )}
                   </div>
 
                   {/* Post Content */}
@@ -496,6 +895,32 @@ function HomeFeed({ onNewPost }: HomeFeedProps) {
                     <p className="text-foreground/90 leading-relaxed text-[15px] whitespace-pre-wrap">
                       {post.content}
                     </p>
+                    {post.sharedPost && (
+                      <div className="mt-3 rounded-xl border border-border/50 p-4">
+                        <p className="text-sm font-bold text-foreground">
+                          {post.sharedPost.author.name}{" "}
+                          <span className="font-medium text-muted-foreground">
+                            @{post.sharedPost.author.username}
+                          </span>
+                        </p>
+                        <p className="mt-1 text-foreground/90 text-[15px] whitespace-pre-wrap">
+                          {post.sharedPost.content}
+                        </p>
+                        {post.sharedPost.image && (
+                          // eslint-disable-next-line @next/next/no-img-element
+                          <img
+                            src={
+                              post.sharedPost.image.startsWith("http")
+                                ? post.sharedPost.image
+                                : `${siteConfig.domain}/${post.sharedPost.image}`
+                            }
+                            alt="Shared post content"
+                            className="mt-2 w-full h-auto max-h-[400px] object-contain rounded-lg"
+                            loading="lazy"
+                          />
+                        )}
+                      </div>
+                    )}
                   </div>
 
                   {post.image && (
@@ -545,14 +970,35 @@ function HomeFeed({ onNewPost }: HomeFeedProps) {
                         <span className="font-medium">{post.comments}</span>
                       </Button>
 
-                      <Button
-                        variant="ghost"
-                        size="sm"
-                        className="flex items-center gap-2 rounded-full px-4 text-muted-foreground hover:text-green-400 hover:bg-green-400/10 transition-colors"
-                      >
-                        <Share className="h-5 w-5" />
-                        <span className="font-medium">{post.shares}</span>
-                      </Button>
+                      <DropdownMenu>
+                        <DropdownMenuTrigger asChild>
+                          <Button
+                            variant="ghost"
+                            size="sm"
+                            className="flex items-center gap-2 rounded-full px-4 text-muted-foreground hover:text-green-400 hover:bg-green-400/10 transition-colors"
+                          >
+                            <Share className="h-5 w-5" />
+                            <span className="font-medium">{post.shares}</span>
+                          </Button>
+                        </DropdownMenuTrigger>
+                        <DropdownMenuContent
+                          align="start"
+                          className="glass-panel border-border/50"
+                        >
+                          <DropdownMenuItem
+                            onClick={() => handleShare(post, false)}
+                            className="cursor-pointer"
+                          >
+                            Repost
+                          </DropdownMenuItem>
+                          <DropdownMenuItem
+                            onClick={() => handleShare(post, true)}
+                            className="cursor-pointer"
+                          >
+                            Quote
+                          </DropdownMenuItem>
+                        </DropdownMenuContent>
+                      </DropdownMenu>
                     </div>
                   </div>
 
@@ -710,6 +1156,16 @@ function HomeFeed({ onNewPost }: HomeFeedProps) {
                           post.commentsList.map((comment) =>
                             renderComment(comment, post.id)
                           )}
+                        {post.commentsCursor && (
+                          <Button
+                            variant="ghost"
+                            size="sm"
+                            onClick={() => loadMoreComments(post)}
+                            className="w-full text-xs text-muted-foreground"
+                          >
+                            Load more comments
+                          </Button>
+                        )}
                         {(!post.commentsList ||
                           post.commentsList.length === 0) && (
                           <div className="text-center py-8 bg-muted/30 rounded-xl border border-dashed border-border/50">
@@ -726,6 +1182,12 @@ function HomeFeed({ onNewPost }: HomeFeedProps) {
                 </CardContent>
               </Card>
             ))}
+            <div ref={loadMoreRef} />
+            {loadingPosts && (
+              <p className="text-center text-sm text-muted-foreground py-4">
+                Loading posts...
+              </p>
+            )}
           </div>
         </div>
       </div>
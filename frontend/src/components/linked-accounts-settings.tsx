@@ -0,0 +1,92 @@
+"use client";
+
+import { useEffect, useState } from "react";
+import { Link2, X } from "lucide-react";
+import { Button } from "@/components/ui/button";
+import { Label } from "@/components/ui/label";
+import {
+  fetchLinkedIdentities,
+  fetchSingleSignOn,
+  singleSignOnURL,
+  unlinkIdentity,
+  type LinkedIdentity,
+  type SingleSignOnStatus,
+} from "@/lib/security";
+
+// Provider accounts that can sign in as this user, shown when single sign-on
+// is configured
+export function LinkedAccountsSettings() {
+  const [singleSignOn, setSingleSignOn] = useState<SingleSignOnStatus | null>(
+    null
+  );
+  const [identities, setIdentities] = useState<LinkedIdentity[]>([]);
+  const [error, setError] = useState("");
+
+  useEffect(() => {
+    fetchSingleSignOn().then(setSingleSignOn);
+    fetchLinkedIdentities().then(setIdentities);
+  }, []);
+
+  const handleUnlink = async (id: number) => {
+    setError("");
+    try {
+      await unlinkIdentity(id);
+      setIdentities((prev) => prev.filter((i) => i.id !== id));
+    } catch (err) {
+      setError(err instanceof Error ? err.message : "Something went wrong");
+    }
+  };
+
+  if (!singleSignOn?.enabled && identities.length === 0) return null;
+
+  return (
+    <div className="space-y-4 pt-6 border-t border-border/40">
+      <div className="flex items-center gap-3">
+        <div className="bg-primary/10 p-2 rounded-lg">
+          <Link2 className="h-5 w-5 text-primary" />
+        </div>
+        <Label className="text-foreground font-bold text-base">
+          Linked accounts
+        </Label>
+      </div>
+
+      <div className="space-y-3 bg-muted/30 p-4 rounded-xl border border-border/30 text-sm">
+        {identities.map((identity) => (
+          <div key={identity.id} className="flex items-start gap-3">
+            <div className="flex-1 min-w-0">
+              <p className="text-foreground truncate">
+                {identity.email || identity.issuer}
+              </p>
+              <p className="text-xs text-muted-foreground truncate">
+                {identity.issuer}
+              </p>
+            </div>
+            <Button
+              variant="ghost"
+              size="icon"
+              onClick={() => handleUnlink(identity.id)}
+              className="h-7 w-7 text-muted-foreground hover:text-destructive"
+              title="Unlink"
+            >
+              <X className="h-4 w-4" />
+            </Button>
+          </div>
+        ))}
+
+        {singleSignOn?.enabled && (
+          <Button
+            variant="outline"
+            onClick={() =>
+              window.location.assign(singleSignOnURL({ link: true }))
+            }
+            className="w-full rounded-xl"
+          >
+            Link a {singleSignOn.name} account
+          </Button>
+        )}
+
+        {error && <p className="text-destructive">{error}</p>}
+      </div>
+    </div>
+  );
+}
@@ -15,16 +15,21 @@ import {
   Heart,
   UserPlus,
   MessageSquare,
+  Repeat2,
   MoreHorizontal,
   Trash2,
   Check,
   MailOpen,
+  BellOff,
+  Users,
+  Calendar,
 } from "lucide-react";
 import { SidebarNavigation } from "./sidebar";
 import {
   fetchNotifications,
   markNotificationAsRead,
   deleteNotification,
+  setNotificationMute,
   type Notification,
 } from "@/lib/notifications";
 import { siteConfig } from "@/config/site.config";
@@ -37,24 +42,16 @@ function NotificationsPage({ onNewPost }: NotificationsPageProps) {
   // Use shared notification utilities
   const [count, setCount] = useState(0);
   const [notifications, setNotifications] = useState<Notification[]>([]);
+  const [nextCursor, setNextCursor] = useState("");
   const [isMobileMenuOpen, setIsMobileMenuOpen] = useState(false);
 
   const useNotificationCount = () => {
     useEffect(() => {
       const init = async () => {
-        try {
-          const res = await fetch(`${siteConfig.domain}/api/notifications`, {
-            credentials: "include",
-          });
-          const data = await res.json();
-          // eslint-disable-next-line @typescript-eslint/no-explicit-any
-          const unread = data?.filter((n: any) => !n.isRead).length || 0;
-
-          setNotifications(data || []);
-          setCount(unread);
-        } catch (err) {
-          console.error("Failed to fetch initial notifications", err);
-        }
+        const page = await fetchNotifications();
+        setNotifications(page.notifications);
+        setNextCursor(page.nextCursor);
+        setCount(page.unreadCount);
       };
       init();
 
@@ -64,20 +61,13 @@ function NotificationsPage({ onNewPost }: NotificationsPageProps) {
       ws.onmessage = (event) => {
         const data = JSON.parse(event.data);
 
-        if (data.channel === "notifications-new") {
-          init();
-        }
-
-        if (data.channel === "notifications-read") {
-          setCount((prev) => Math.max(prev - 1, 0));
-        }
-
-        if (data.channel === "notifications-delete") {
+        if (
+          data.channel === "notifications-new" ||
+          data.channel === "notifications-delete"
+        ) {
           init();
-        }
-
-        if (data.channel === "notifications-all-read") {
-          setCount(0);
+        } else if (typeof data.unread === "number") {
+          setCount(data.unread);
         }
       };
     }, []);
@@ -85,19 +75,14 @@ function NotificationsPage({ onNewPost }: NotificationsPageProps) {
     return count;
   };
 
-  // Load notifications when component mounts
-  useEffect(() => {
-    const loadNotifications = async () => {
-      try {
-        const fetchedNotifications = await fetchNotifications();
-        setNotifications(fetchedNotifications);
-      } catch (error) {
-        console.error("Error loading notifications:", error);
-      }
-    };
-
-    loadNotifications();
-  }, []);
+  const loadMoreNotifications = async () => {
+    const page = await fetchNotifications(nextCursor);
+    setNotifications((prev) => [
+      ...prev,
+      ...page.notifications.filter((n) => !prev.some((p) => p.id === n.id)),
+    ]);
+    setNextCursor(page.nextCursor);
+  };
 
   const getNotificationIcon = (type: string) => {
     switch (type) {
@@ -106,9 +91,17 @@ function NotificationsPage({ onNewPost }: NotificationsPageProps) {
       case "follow":
         return <UserPlus className="h-4 w-4 text-blue-500" />;
       case "comment":
+      case "reply":
         return <MessageSquare className="h-4 w-4 text-green-500" />;
       case "follow_request":
         return <UserPlus className="h-4 w-4 text-yellow-500" />;
+      case "share":
+        return <Repeat2 className="h-4 w-4 text-emerald-500" />;
+      case "group_invite":
+      case "group_join_request":
+        return <Users className="h-4 w-4 text-indigo-500" />;
+      case "group_event":
+        return <Calendar className="h-4 w-4 text-indigo-500" />;
       default:
         return <Star className="h-4 w-4 text-purple-500" />;
     }
@@ -241,10 +234,15 @@ function NotificationsPage({ onNewPost }: NotificationsPageProps) {
                             ? "bg-pink-500/10"
                             : notification.type === "follow"
                             ? "bg-blue-500/10"
-                            : notification.type === "comment"
+                            : notification.type === "comment" ||
+                              notification.type === "reply"
                             ? "bg-green-500/10"
                             : notification.type === "follow_request"
                             ? "bg-yellow-500/10"
+                            : notification.type === "share"
+                            ? "bg-emerald-500/10"
+                            : notification.type.startsWith("group_")
+                            ? "bg-indigo-500/10"
                             : "bg-purple-500/10"
                         }`}
                       >
@@ -277,7 +275,16 @@ function NotificationsPage({ onNewPost }: NotificationsPageProps) {
                             <p className="text-[15px] leading-snug text-foreground/90">
                               <span className="font-bold text-foreground hover:underline cursor-pointer">
                                 {notification.user.name}
-                              </span>{" "}
+                              </span>
+                              {(notification.actorCount || 1) > 1 && (
+                                <span className="text-muted-foreground">
+                                  {" "}
+                                  and {(notification.actorCount || 1) - 1}{" "}
+                                  {(notification.actorCount || 1) === 2
+                                    ? "other"
+                                    : "others"}
+                                </span>
+                              )}{" "}
                               <span className="text-muted-foreground">
                                 {notification.content}
                               </span>
@@ -347,6 +354,35 @@ function NotificationsPage({ onNewPost }: NotificationsPageProps) {
                                   Mark as read
                                 </DropdownMenuItem>
                               )}
+                              <DropdownMenuItem
+                                onClick={() =>
+                                  setNotificationMute(
+                                    {
+                                      type: "user",
+                                      id: Number(notification.user.id),
+                                    },
+                                    true
+                                  )
+                                }
+                                className="cursor-pointer"
+                              >
+                                <BellOff className="h-4 w-4 mr-2" />
+                                Mute {notification.user.name}
+                              </DropdownMenuItem>
+                              {notification.postId ? (
+                                <DropdownMenuItem
+                                  onClick={() =>
+                                    setNotificationMute(
+                                      { type: "post", id: notification.postId! },
+                                      true
+                                    )
+                                  }
+                                  className="cursor-pointer"
+                                >
+                                  <BellOff className="h-4 w-4 mr-2" />
+                                  Mute this post
+                                </DropdownMenuItem>
+                              ) : null}
                               <DropdownMenuItem
                                 onClick={() => handleDelete(notification.id)}
                                 className="text-destructive focus:text-destructive focus:bg-destructive/10 cursor-pointer"
@@ -361,6 +397,15 @@ function NotificationsPage({ onNewPost }: NotificationsPageProps) {
                     </div>
                   </div>
                 ))}
+                {nextCursor && (
+                  <Button
+                    variant="ghost"
+                    onClick={loadMoreNotifications}
+                    className="w-full text-muted-foreground"
+                  >
+                    Load more
+                  </Button>
+                )}
               </div>
             )}
           </div>
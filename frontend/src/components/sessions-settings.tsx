@@ -0,0 +1,105 @@
+"use client";
+
+import { useEffect, useState } from "react";
+import { MonitorSmartphone, X } from "lucide-react";
+import { Button } from "@/components/ui/button";
+import { Label } from "@/components/ui/label";
+import {
+  fetchSessions,
+  revokeOtherSessions,
+  revokeSession,
+  type SessionInfo,
+} from "@/lib/security";
+
+// Devices signed in to the account, each can be signed out from here
+export function SessionsSettings() {
+  const [sessions, setSessions] = useState<SessionInfo[]>([]);
+  const [error, setError] = useState("");
+
+  useEffect(() => {
+    fetchSessions().then(setSessions);
+  }, []);
+
+  const handleRevoke = async (session: SessionInfo) => {
+    setError("");
+    try {
+      await revokeSession(session.id);
+      if (session.current) {
+        window.location.href = "/auth";
+        return;
+      }
+      setSessions((prev) => prev.filter((s) => s.id !== session.id));
+    } catch (err) {
+      setError(err instanceof Error ? err.message : "Something went wrong");
+    }
+  };
+
+  const handleRevokeOthers = async () => {
+    setError("");
+    try {
+      await revokeOtherSessions();
+      setSessions((prev) => prev.filter((s) => s.current));
+    } catch (err) {
+      setError(err instanceof Error ? err.message : "Something went wrong");
+    }
+  };
+
+  return (
+    <div className="space-y-4 pt-6 border-t border-border/40">
+      <div className="flex items-center gap-3">
+        <div className="bg-primary/10 p-2 rounded-lg">
+          <MonitorSmartphone className="h-5 w-5 text-primary" />
+        </div>
+        <Label className="text-foreground font-bold text-base">
+          Where you&apos;re signed in
+        </Label>
+      </div>
+
+      <div className="space-y-3 bg-muted/30 p-4 rounded-xl border border-border/30 text-sm">
+        {sessions.map((session) => (
+          <div key={session.id} className="flex items-start gap-3">
+            <div className="flex-1 min-w-0">
+              <p className="text-foreground truncate">
+                {session.userAgent || "Unknown device"}
+              </p>
+              <p className="text-xs text-muted-foreground">
+                {session.ip} ·{" "}
+                {session.current
+                  ? "This device"
+                  : session.online
+                  ? "Online now"
+                  : `Last active ${new Date(
+                      session.lastSeenAt
+                    ).toLocaleString(undefined, {
+                      dateStyle: "medium",
+                      timeStyle: "short",
+                    })}`}
+              </p>
+            </div>
+            <Button
+              variant="ghost"
+              size="icon"
+              onClick={() => handleRevoke(session)}
+              className="h-7 w-7 text-muted-foreground hover:text-destructive"
+              title="Sign out"
+            >
+              <X className="h-4 w-4" />
+            </Button>
+          </div>
+        ))}
+
+        {sessions.length > 1 && (
+          <Button
+            variant="outline"
+            onClick={handleRevokeOthers}
+            className="w-full rounded-xl hover:bg-destructive/10 hover:text-destructive hover:border-destructive/30"
+          >
+            Sign out all other devices
+          </Button>
+        )}
+
+        {error && <p className="text-destructive">{error}</p>}
+      </div>
+    </div>
+  );
+}
@@ -0,0 +1,173 @@
+"use client";
+
+import { useEffect, useState } from "react";
+import { ShieldCheck } from "lucide-react";
+import { Button } from "@/components/ui/button";
+import { Input } from "@/components/ui/input";
+import { Label } from "@/components/ui/label";
+import {
+  confirmTwoFactor,
+  disableTwoFactor,
+  enrollTwoFactor,
+  fetchTwoFactorStatus,
+  type TwoFactorEnrollment,
+  type TwoFactorStatus,
+} from "@/lib/security";
+
+// Two-factor authentication section of the account settings: enroll an
+// authenticator app, confirm it with a first code, or turn 2FA off.
+export function TwoFactorSettings() {
+  const [status, setStatus] = useState<TwoFactorStatus | null>(null);
+  const [enrollment, setEnrollment] = useState<TwoFactorEnrollment | null>(
+    null
+  );
+  const [recoveryCodes, setRecoveryCodes] = useState<string[]>([]);
+  const [code, setCode] = useState("");
+  const [password, setPassword] = useState("");
+  const [error, setError] = useState("");
+  const [isLoading, setIsLoading] = useState(false);
+
+  useEffect(() => {
+    fetchTwoFactorStatus().then(setStatus);
+  }, []);
+
+  const run = async (action: () => Promise<void>) => {
+    setIsLoading(true);
+    setError("");
+    try {
+      await action();
+    } catch (err) {
+      setError(err instanceof Error ? err.message : "Something went wrong");
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
+  const handleEnroll = () =>
+    run(async () => {
+      setEnrollment(await enrollTwoFactor());
+    });
+
+  const handleConfirm = () =>
+    run(async () => {
+      const data = await confirmTwoFactor(code);
+      setRecoveryCodes(data.recoveryCodes);
+      setEnrollment(null);
+      setCode("");
+      setStatus(await fetchTwoFactorStatus());
+    });
+
+  const handleDisable = () =>
+    run(async () => {
+      await disableTwoFactor(password, code);
+      setCode("");
+      setPassword("");
+      setRecoveryCodes([]);
+      setStatus(await fetchTwoFactorStatus());
+    });
+
+  if (!status) return null;
+
+  return (
+    <div className="space-y-4 pt-6 border-t border-border/40">
+      <div className="flex items-center gap-3">
+        <div className="bg-primary/10 p-2 rounded-lg">
+          <ShieldCheck className="h-5 w-5 text-primary" />
+        </div>
+        <Label className="text-foreground font-bold text-base">
+          Two-factor authentication
+        </Label>
+      </div>
+
+      <div className="space-y-3 bg-muted/30 p-4 rounded-xl border border-border/30 text-sm">
+        {recoveryCodes.length > 0 && (
+          <div className="space-y-2">
+            <p className="text-foreground">
+              Save these recovery codes somewhere safe. Each one signs you in
+              once if you lose your authenticator. They won&apos;t be shown
+              again.
+            </p>
+            <div className="grid grid-cols-2 gap-1 font-mono text-xs">
+              {recoveryCodes.map((c) => (
+                <span key={c}>{c}</span>
+              ))}
+            </div>
+          </div>
+        )}
+
+        {status.enabled ? (
+          <>
+            <p className="text-muted-foreground">
+              On. {status.recoveryCodesLeft} recovery codes left.
+            </p>
+            <Input
+              type="password"
+              placeholder="Password"
+              value={password}
+              onChange={(e) => setPassword(e.target.value)}
+              className="glass-input"
+            />
+            <Input
+              placeholder="Authentication or recovery code"
+              value={code}
+              onChange={(e) => setCode(e.target.value)}
+              className="glass-input"
+            />
+            <Button
+              variant="outline"
+              onClick={handleDisable}
+              disabled={isLoading || !password || !code}
+              className="w-full rounded-xl hover:bg-destructive/10 hover:text-destructive hover:border-destructive/30"
+            >
+              Turn off
+            </Button>
+          </>
+        ) : enrollment ? (
+          <>
+            <p className="text-muted-foreground">
+              Add this key to your authenticator app, then enter the code it
+              shows.
+            </p>
+            <a
+              href={enrollment.otpauthUrl}
+              className="block font-mono text-xs break-all text-primary"
+            >
+              {enrollment.secret}
+            </a>
+            <Input
+              inputMode="numeric"
+              autoComplete="one-time-code"
+              placeholder="6-digit code"
+              value={code}
+              onChange={(e) => setCode(e.target.value)}
+              className="glass-input"
+            />
+            <Button
+              onClick={handleConfirm}
+              disabled={isLoading || !code}
+              className="w-full rounded-xl"
+            >
+              Confirm
+            </Button>
+          </>
+        ) : (
+          <>
+            <p className="text-muted-foreground">
+              Ask for a code from an authenticator app when signing in.
+            </p>
+            <Button
+              variant="outline"
+              onClick={handleEnroll}
+              disabled={isLoading}
+              className="w-full rounded-xl"
+            >
+              Set up
+            </Button>
+          </>
+        )}
+
+        {error && <p className="text-destructive">{error}</p>}
+      </div>
+    </div>
+  );
+}
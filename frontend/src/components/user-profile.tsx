@@ -22,7 +22,6 @@ import {
   ImagePlay,
   Send,
 } from "lucide-react";
-import { authUtils } from "@/lib/navigation";
 import { useNotificationCount } from "@/lib/notifications";
 import EmojiPicker, { Theme } from "emoji-picker-react";
 import GifPicker from "gif-picker-react";
@@ -118,14 +117,8 @@ function UserProfile({
   // Toggle follow/unfollow state or send follow request for private profiles
   const handleFollowToggle = async () => {
     try {
-      const currentUser = await authUtils.CurrentUser();
-      if (!currentUser) {
-        console.error("No logged in user");
-        return;
-      }
-
+      // the backend takes the follower from the session
       const body = {
-        follower: currentUser.id,
         following: profileData.id,
       };
 
@@ -261,7 +254,7 @@ function UserProfile({
           post.id === postId
             ? {
                 ...post,
-                commentsList: data || [],
+                commentsList: data.comments || [],
               }
             : post
         )
@@ -0,0 +1,47 @@
+"use client";
+
+import { useState } from "react";
+import { MailWarning } from "lucide-react";
+import { Button } from "@/components/ui/button";
+import { authUtils } from "@/lib/navigation";
+
+// Shown until the user opens the link from their verification email. Posting,
+// messaging and creating groups stay disabled until then.
+export function VerifyEmailBanner() {
+  const [message, setMessage] = useState("");
+  const [isSending, setIsSending] = useState(false);
+
+  const handleResend = async () => {
+    setIsSending(true);
+    try {
+      await authUtils.resendVerification();
+      setMessage("Verification email sent, check your inbox.");
+    } catch (err) {
+      setMessage(err instanceof Error ? err.message : "Something went wrong");
+    } finally {
+      setIsSending(false);
+    }
+  };
+
+  return (
+    <div className="sticky top-0 z-50 flex flex-wrap items-center justify-center gap-3 bg-yellow-500/15 border-b border-yellow-500/30 px-4 py-2 text-sm text-foreground backdrop-blur">
+      <MailWarning className="h-4 w-4 text-yellow-600" />
+      <span>
+        Verify your email address to post, send messages and create groups.
+      </span>
+      {message ? (
+        <span className="text-muted-foreground">{message}</span>
+      ) : (
+        <Button
+          size="sm"
+          variant="outline"
+          onClick={handleResend}
+          disabled={isSending}
+          className="h-7 cursor-pointer"
+        >
+          {isSending ? "Sending..." : "Resend email"}
+        </Button>
+      )}
+    </div>
+  );
+}
@@ -120,6 +120,17 @@ export const authUtils = {
       return null;
     }
   },
+  resendVerification: async () => {
+    const res = await fetch(`${siteConfig.domain}/api/verify-email/resend`, {
+      method: "POST",
+      credentials: "include",
+    });
+    const data = await res.json();
+    if (!res.ok) {
+      throw new Error(data.error || "Could not send the email");
+    }
+    return data;
+  },
   logout: async () => {
     try {
       await fetch(`${siteConfig.domain}/api/logout`, {
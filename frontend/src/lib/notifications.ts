@@ -6,7 +6,17 @@ import { getWebSocket } from "@/lib/websocket";
 import { siteConfig } from "@/config/site.config";
 export interface Notification {
   id: number;
-  type: "like" | "follow" | "comment" | "mention" | "follow_request";
+  type:
+    | "like"
+    | "follow"
+    | "comment"
+    | "mention"
+    | "follow_request"
+    | "share"
+    | "reply"
+    | "group_invite"
+    | "group_join_request"
+    | "group_event";
   user: {
     id: string;
     name: string;
@@ -16,31 +26,31 @@ export interface Notification {
   content?: string;
   timestamp: string;
   isRead: boolean;
+  // everyone grouped into this notification, newest first (only the latest few)
+  actors?: { id: number; name: string; avatar?: string }[];
+  actorCount?: number;
+  postId?: number;
+  commentId?: number;
+  groupId?: number;
+  eventId?: number;
   actionData?: {
     postId?: string;
     commentId?: string;
   };
 }
 
+export interface NotificationPage {
+  notifications: Notification[];
+  nextCursor: string;
+  unreadCount: number;
+}
+
 // Hook to get unread notification count
 export const useNotificationCount = () => {
   const [count, setCount] = useState(0);
 
   useEffect(() => {
-    const init = async () => {
-      try {
-        const res = await fetch(`${siteConfig.domain}/api/notifications`, {
-          credentials: "include",
-        });
-        const data = await res.json();
-        // eslint-disable-next-line @typescript-eslint/no-explicit-any
-        const unread = data?.filter((n: any) => !n.isRead).length || 0;
-        setCount(unread);
-      } catch (err) {
-        console.error("Failed to fetch initial notifications", err);
-      }
-    };
-    init();
+    fetchUnreadCount().then(setCount);
 
     const ws = getWebSocket();
     if (!ws) return;
@@ -48,42 +58,58 @@ export const useNotificationCount = () => {
     ws.onmessage = (event) => {
       const data = JSON.parse(event.data);
 
-      if (data.channel === "notifications-new") {
-        setCount((prev) => prev + 1);
-      }
-
-      if (data.channel === "notifications-read") {
-        setCount((prev) => Math.max(prev - 1, 0));
-      }
-
-      if (data.channel === "notifications-delete") {
-        init();
-      }
-
-      if (data.channel === "notifications-all-read") {
-        setCount(0);
+      // every notifications-* push carries the new unread count
+      if (
+        typeof data.channel === "string" &&
+        data.channel.startsWith("notifications-") &&
+        typeof data.unread === "number"
+      ) {
+        setCount(data.unread);
       }
     };
   }, []);
 
   return count;
 };
-// Function to fetch notifications from API (placeholder)
-export const fetchNotifications = async (): Promise<Notification[]> => {
+
+// Function to fetch the unread notification count
+export const fetchUnreadCount = async (): Promise<number> => {
   try {
-    // TODO: Replace with actual API call
-    const response = await fetch(`${siteConfig.domain}/api/notifications`, {
-      credentials: "include",
-    });
+    const response = await fetch(
+      `${siteConfig.domain}/api/notifications/unread-count`,
+      { credentials: "include" }
+    );
+    if (!response.ok) throw new Error("Failed to fetch unread count");
+    const data = await response.json();
+    return data.count || 0;
+  } catch (error) {
+    console.error("Error fetching unread count:", error);
+    return 0;
+  }
+};
+
+// Function to fetch one page of notifications, newest first
+export const fetchNotifications = async (
+  cursor = ""
+): Promise<NotificationPage> => {
+  try {
+    const response = await fetch(
+      `${siteConfig.domain}/api/notifications?cursor=${cursor}`,
+      {
+        credentials: "include",
+      }
+    );
     if (!response.ok) throw new Error("Failed to fetch notifications");
     const data = await response.json();
-    console.log("Fetched notifications", data);
 
-    if (!data) return [];
-    return data;
+    return {
+      notifications: data.notifications || [],
+      nextCursor: data.nextCursor || "",
+      unreadCount: data.unreadCount || 0,
+    };
   } catch (error) {
     console.error("Error fetching notifications:", error);
-    return [];
+    return { notifications: [], nextCursor: "", unreadCount: 0 };
   }
 };
 
@@ -135,3 +161,98 @@ export const deleteNotification = async (
     console.error("Error deleting notification:", error);
   }
 };
+
+// Function to mark a selection of notifications as read
+export const markNotificationsAsRead = async (
+  notificationIds: number[]
+): Promise<void> => {
+  try {
+    await fetch(`${siteConfig.domain}/api/mark-notification-as-read/`, {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      credentials: "include",
+      body: JSON.stringify({ ids: notificationIds }),
+    });
+  } catch (error) {
+    console.error("Error marking notifications as read:", error);
+  }
+};
+
+// Function to delete a selection of notifications
+export const deleteNotifications = async (
+  notificationIds: number[]
+): Promise<void> => {
+  try {
+    await fetch(`${siteConfig.domain}/api/delete-notification/`, {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      credentials: "include",
+      body: JSON.stringify({ ids: notificationIds }),
+    });
+  } catch (error) {
+    console.error("Error deleting notifications:", error);
+  }
+};
+
+export interface NotificationSetting {
+  type: string;
+  inApp: boolean;
+  live: boolean;
+  emailDigest: boolean;
+}
+
+export interface NotificationMute {
+  type: "user" | "post" | "group";
+  id: number;
+}
+
+// Function to fetch the per-type notification settings and mutes
+export const fetchNotificationSettings = async (): Promise<{
+  settings: NotificationSetting[];
+  mutes: NotificationMute[];
+}> => {
+  try {
+    const response = await fetch(
+      `${siteConfig.domain}/api/notification-settings`,
+      { credentials: "include" }
+    );
+    if (!response.ok) throw new Error("Failed to fetch settings");
+    return await response.json();
+  } catch (error) {
+    console.error("Error fetching notification settings:", error);
+    return { settings: [], mutes: [] };
+  }
+};
+
+// Function to change one channel of a notification type
+export const updateNotificationSetting = async (
+  update: Partial<NotificationSetting> & { type: string }
+): Promise<void> => {
+  try {
+    await fetch(`${siteConfig.domain}/api/notification-settings`, {
+      method: "PATCH",
+      headers: { "Content-Type": "application/json" },
+      credentials: "include",
+      body: JSON.stringify([update]),
+    });
+  } catch (error) {
+    console.error("Error updating notification settings:", error);
+  }
+};
+
+// Function to mute or unmute notifications from a user or about a post/group
+export const setNotificationMute = async (
+  mute: NotificationMute,
+  muted: boolean
+): Promise<void> => {
+  try {
+    await fetch(`${siteConfig.domain}/api/notification-mutes`, {
+      method: muted ? "POST" : "DELETE",
+      headers: { "Content-Type": "application/json" },
+      credentials: "include",
+      body: JSON.stringify(mute),
+    });
+  } catch (error) {
+    console.error("Error updating notification mute:", error);
+  }
+};
@@ -0,0 +1,209 @@
+// Utility functions for account security settings
+import { siteConfig } from "@/config/site.config";
+
+export interface TwoFactorStatus {
+  enabled: boolean;
+  recoveryCodesLeft: number;
+}
+
+export interface TwoFactorEnrollment {
+  secret: string;
+  otpauthUrl: string;
+}
+
+// POSTs body to an account security endpoint and throws the backend's error
+const post = async <T>(path: string, body?: unknown): Promise<T> => {
+  const res = await fetch(`${siteConfig.domain}${path}`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    credentials: "include",
+    body: body === undefined ? undefined : JSON.stringify(body),
+  });
+  const data = await res.json();
+  if (!res.ok) {
+    throw new Error(data.error || "Request failed");
+  }
+  return data;
+};
+
+// Function to fetch whether two-factor authentication is on
+export const fetchTwoFactorStatus = async (): Promise<TwoFactorStatus> => {
+  try {
+    const res = await fetch(`${siteConfig.domain}/api/2fa`, {
+      credentials: "include",
+    });
+    if (!res.ok) throw new Error("Failed to fetch 2FA status");
+    return await res.json();
+  } catch (error) {
+    console.error("Error fetching 2FA status:", error);
+    return { enabled: false, recoveryCodesLeft: 0 };
+  }
+};
+
+// Function to start 2FA setup, returns the secret for the authenticator app
+export const enrollTwoFactor = () =>
+  post<TwoFactorEnrollment>("/api/2fa/enroll");
+
+// Function to finish 2FA setup with a first code, returns the recovery codes
+export const confirmTwoFactor = (code: string) =>
+  post<{ enabled: boolean; recoveryCodes: string[] }>("/api/2fa/confirm", {
+    code,
+  });
+
+// Function to turn 2FA off with the password and a code or recovery code
+export const disableTwoFactor = (password: string, code: string) =>
+  post<{ enabled: boolean }>("/api/2fa/disable", { password, code });
+
+export interface SessionInfo {
+  id: string;
+  userAgent: string;
+  ip: string;
+  createdAt: string;
+  lastSeenAt: string;
+  expiresAt: string;
+  current: boolean;
+  online: boolean;
+}
+
+// Function to list the signed-in devices of the current user
+export const fetchSessions = async (): Promise<SessionInfo[]> => {
+  try {
+    const res = await fetch(`${siteConfig.domain}/api/sessions`, {
+      credentials: "include",
+    });
+    if (!res.ok) throw new Error("Failed to fetch sessions");
+    return await res.json();
+  } catch (error) {
+    console.error("Error fetching sessions:", error);
+    return [];
+  }
+};
+
+// Function to sign out one device
+export const revokeSession = async (id: string): Promise<void> => {
+  const res = await fetch(`${siteConfig.domain}/api/sessions/${id}`, {
+    method: "DELETE",
+    credentials: "include",
+  });
+  if (!res.ok) {
+    const data = await res.json();
+    throw new Error(data.error || "Failed to revoke session");
+  }
+};
+
+// Function to sign out every device but this one
+export const revokeOtherSessions = () =>
+  post<{ revoked: number }>("/api/sessions/revoke-others");
+
+export type TokenScope = "read" | "posts" | "messages" | "groups";
+
+export interface AccessToken {
+  id: number;
+  name: string;
+  scopes: TokenScope[];
+  hint: string;
+  createdAt: string;
+  expiresAt: string;
+  lastUsedAt: string | null;
+}
+
+// Function to list the caller's API tokens
+export const fetchAccessTokens = async (): Promise<AccessToken[]> => {
+  try {
+    const res = await fetch(`${siteConfig.domain}/api/tokens`, {
+      credentials: "include",
+    });
+    if (!res.ok) throw new Error("Failed to fetch tokens");
+    return await res.json();
+  } catch (error) {
+    console.error("Error fetching tokens:", error);
+    return [];
+  }
+};
+
+// Function to create an API token, the token itself is only returned here
+export const createAccessToken = (
+  name: string,
+  scopes: TokenScope[],
+  expiresInDays: number
+) =>
+  post<{ token: string; accessToken: AccessToken }>("/api/tokens", {
+    name,
+    scopes,
+    expiresInDays,
+  });
+
+// Function to revoke an API token
+export const revokeAccessToken = async (id: number): Promise<void> => {
+  const res = await fetch(`${siteConfig.domain}/api/tokens/${id}`, {
+    method: "DELETE",
+    credentials: "include",
+  });
+  if (!res.ok) {
+    const data = await res.json();
+    throw new Error(data.error || "Failed to revoke token");
+  }
+};
+
+export interface SingleSignOnStatus {
+  enabled: boolean;
+  name: string;
+}
+
+export interface LinkedIdentity {
+  id: number;
+  issuer: string;
+  email: string;
+  createdAt: string;
+  lastLoginAt: string | null;
+}
+
+// Function to fetch whether sign-in through an OpenID provider is offered
+export const fetchSingleSignOn = async (): Promise<SingleSignOnStatus> => {
+  try {
+    const res = await fetch(`${siteConfig.domain}/api/oidc`);
+    if (!res.ok) throw new Error("Failed to fetch single sign-on status");
+    return await res.json();
+  } catch (error) {
+    console.error("Error fetching single sign-on status:", error);
+    return { enabled: false, name: "" };
+  }
+};
+
+// URL that starts a sign-in, or with link a link to the current account,
+// at the OpenID provider
+export const singleSignOnURL = (options: {
+  remember?: boolean;
+  link?: boolean;
+}) => {
+  const params = new URLSearchParams();
+  if (options.remember) params.set("remember", "1");
+  if (options.link) params.set("link", "1");
+  return `${siteConfig.domain}/api/oidc/login?${params}`;
+};
+
+// Function to list the provider accounts linked to the current user
+export const fetchLinkedIdentities = async (): Promise<LinkedIdentity[]> => {
+  try {
+    const res = await fetch(`${siteConfig.domain}/api/oidc/identities`, {
+      credentials: "include",
+    });
+    if (!res.ok) throw new Error("Failed to fetch linked accounts");
+    return await res.json();
+  } catch (error) {
+    console.error("Error fetching linked accounts:", error);
+    return [];
+  }
+};
+
+// Function to unlink a provider account
+export const unlinkIdentity = async (id: number): Promise<void> => {
+  const res = await fetch(`${siteConfig.domain}/api/oidc/identities/${id}`, {
+    method: "DELETE",
+    credentials: "include",
+  });
+  if (!res.ok) {
+    const data = await res.json();
+    throw new Error(data.error || "Failed to unlink account");
+  }
+};
@@ -21,9 +21,13 @@ export function initWebSocket(userId: number) {
     }
   };
 
-  ws.onclose = () => {
+  ws.onclose = (event) => {
     console.log("WebSocket closed for user", userId);
     ws = null;
+    // 1008 means the backend ended this session (logout or revoked elsewhere)
+    if (event.code === 1008) {
+      window.location.href = "/auth";
+    }
   };
 
   return ws;